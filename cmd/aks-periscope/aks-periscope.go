@@ -60,11 +60,26 @@ func main() {
 	osmCollector := collector.NewOsmCollector()
 	smiCollector := collector.NewSmiCollector()
 	podsCollector := collector.NewPodsContainerLogs(config)
+	containerRuntimeCollector := collector.NewContainerRuntimeCollector(config)
+	kernelCollector := collector.NewKernelCollector()
+	diskCollector := collector.NewDiskCollector()
+	kubeletConfigCollector := collector.NewKubeletConfigCollector(config)
+	certificatesCollector := collector.NewCertificatesCollector()
+	proxyCollector := collector.NewProxyCollector(config)
+	coreDNSCollector := collector.NewCoreDNSCollector(config)
+	cniCollector := collector.NewCNICollector(config)
+	conntrackCollector := collector.NewConntrackCollector()
+	nodeContainerLogsCollector := collector.NewNodeContainerLogsCollector()
+	eventsCollector := collector.NewEventsCollector(config)
+	nodeCollector := collector.NewNodeCollector(config)
+	perfSamplesCollector := collector.NewPerfSamplesCollector(config)
 
 	collectors := []interfaces.Collector{
 		dnsCollector,
 		kubeObjectsCollector,
 		networkOutboundCollector,
+		coreDNSCollector,
+		eventsCollector,
 	}
 
 	if contains(collectorList, "connectedCluster") {
@@ -76,6 +91,17 @@ func main() {
 		collectors = append(collectors, nodeLogsCollector)
 		collectors = append(collectors, kubeletCmdCollector)
 		collectors = append(collectors, systemPerfCollector)
+		collectors = append(collectors, containerRuntimeCollector)
+		collectors = append(collectors, kernelCollector)
+		collectors = append(collectors, diskCollector)
+		collectors = append(collectors, kubeletConfigCollector)
+		collectors = append(collectors, certificatesCollector)
+		collectors = append(collectors, proxyCollector)
+		collectors = append(collectors, cniCollector)
+		collectors = append(collectors, conntrackCollector)
+		collectors = append(collectors, nodeContainerLogsCollector)
+		collectors = append(collectors, nodeCollector)
+		collectors = append(collectors, perfSamplesCollector)
 	}
 
 	// OSM and SMI flags are mutually exclusive
@@ -110,35 +136,57 @@ func main() {
 
 	collectorGrp.Wait()
 
-	diagnosers := []interfaces.Diagnoser{
-		diagnoser.NewNetworkConfigDiagnoser(dnsCollector, kubeletCmdCollector),
-		diagnoser.NewNetworkOutboundDiagnoser(networkOutboundCollector),
+	networkConfigDiagnoser := diagnoser.NewNetworkConfigDiagnoser(dnsCollector, kubeletCmdCollector, kubeletConfigCollector, cniCollector)
+	networkOutboundDiagnoser := diagnoser.NewNetworkOutboundDiagnoser(networkOutboundCollector)
+
+	// Advanced diagnosers analyze the signals of basic diagnosers, so they run once the basic diagnosers are done
+	diagnoserStages := [][]interfaces.Diagnoser{
+		{
+			networkConfigDiagnoser,
+			networkOutboundDiagnoser,
+			diagnoser.NewRequiredEgressDiagnoser(networkOutboundCollector),
+			diagnoser.NewCertificatesDiagnoser(certificatesCollector),
+			diagnoser.NewProxyDiagnoser(proxyCollector),
+			diagnoser.NewDNSDiagnoser(dnsCollector),
+			diagnoser.NewCoreDNSDiagnoser(coreDNSCollector),
+			diagnoser.NewOvercommitDiagnoser(nodeCollector, systemPerfCollector),
+			diagnoser.NewSaturationDiagnoser(perfSamplesCollector),
+			diagnoser.NewCrashDiagnoser(nodeCollector, kernelCollector, systemPerfCollector, nodeContainerLogsCollector),
+			diagnoser.NewSchedulingDiagnoser(config),
+			diagnoser.NewImagePullDiagnoser(config, networkOutboundCollector),
+		},
+		{
+			diagnoser.NewIPExhaustionDiagnoser(networkConfigDiagnoser, cniCollector),
+			diagnoser.NewSNATDiagnoser(conntrackCollector, networkOutboundDiagnoser),
+		},
 	}
 
-	diagnoserGrp := new(sync.WaitGroup)
-
-	for _, d := range diagnosers {
-		dataProducers = append(dataProducers, d)
-		diagnoserGrp.Add(1)
-		go func(d interfaces.Diagnoser) {
-			defer diagnoserGrp.Done()
-
-			log.Printf("Diagnoser: %s, diagnose data", d.GetName())
-			err := d.Diagnose()
-			if err != nil {
-				log.Printf("Diagnoser: %s, diagnose data failed: %v", d.GetName(), err)
-				return
-			}
+	for _, diagnosers := range diagnoserStages {
+		diagnoserGrp := new(sync.WaitGroup)
+
+		for _, d := range diagnosers {
+			dataProducers = append(dataProducers, d)
+			diagnoserGrp.Add(1)
+			go func(d interfaces.Diagnoser) {
+				defer diagnoserGrp.Done()
+
+				log.Printf("Diagnoser: %s, diagnose data", d.GetName())
+				err := d.Diagnose()
+				if err != nil {
+					log.Printf("Diagnoser: %s, diagnose data failed: %v", d.GetName(), err)
+					return
+				}
+
+				log.Printf("Diagnoser: %s, export data", d.GetName())
+				if err = exp.Export(d); err != nil {
+					log.Printf("Diagnoser: %s, export data failed: %v", d.GetName(), err)
+				}
+			}(d)
+		}
 
-			log.Printf("Diagnoser: %s, export data", d.GetName())
-			if err = exp.Export(d); err != nil {
-				log.Printf("Diagnoser: %s, export data failed: %v", d.GetName(), err)
-			}
-		}(d)
+		diagnoserGrp.Wait()
 	}
 
-	diagnoserGrp.Wait()
-
 	zip, err := exporter.Zip(dataProducers)
 	if err != nil {
 		log.Printf("Could not zip data: %v", err)
@@ -148,6 +196,13 @@ func main() {
 		}
 	}
 
+	// Events keep being watched while AKS-Periscope runs as a daemonset, so they outlive their TTL in the API server
+	go func() {
+		if err := eventsCollector.Watch(exp); err != nil {
+			log.Printf("Collector: %s, watch data failed: %v", eventsCollector.GetName(), err)
+		}
+	}()
+
 	// TODO: Hack: for now AKS-Periscope is running as a deamonset so it shall not stop (or the pod will be restarted)
 	// Revert from https://github.com/Azure/aks-periscope/blob/b98d66a238e942158ef2628a9315b58937ff9c8f/cmd/aks-periscope/aks-periscope.go#L70
 	select {}
@@ -3,12 +3,14 @@ module github.com/Azure/aks-periscope
 go 1.15
 
 require (
+	github.com/Azure/azure-pipeline-go v0.2.1
 	github.com/Azure/azure-storage-blob-go v0.7.0
 	github.com/Azure/go-autorest/autorest/adal v0.9.14 // indirect
 	github.com/kr/pretty v0.2.1 // indirect
 	github.com/containerd/containerd v1.4.11 // indirect
 	github.com/onsi/gomega v1.13.0 // indirect
 	github.com/opencontainers/runc v1.0.0-rc95 // indirect
+	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781
 	helm.sh/helm/v3 v3.6.3
 	k8s.io/api v0.21.3
 	k8s.io/apimachinery v0.21.3
@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+// certificateDirectories lists the host directories holding the node certificates
+var certificateDirectories = []string{"/etc/kubernetes/certs", "/var/lib/kubelet/pki"}
+
+// certificateExtensions lists the file extensions which may contain PEM certificates
+var certificateExtensions = []string{".crt", ".pem", ".cer"}
+
+// CertificateInfo defines the public information of a certificate; private keys are never collected
+type CertificateInfo struct {
+	Path               string    `json:"path"`
+	Index              int       `json:"index"`
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	IsCA               bool      `json:"isCA"`
+	SubjectKeyID       string    `json:"subjectKeyId,omitempty"`
+	AuthorityKeyID     string    `json:"authorityKeyId,omitempty"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	IssuerPath         string    `json:"issuerPath,omitempty"`
+	IssuerVerified     *bool     `json:"issuerVerified,omitempty"`
+}
+
+// CertificatesCollector defines a Certificates Collector struct
+type CertificatesCollector struct {
+	data map[string]string
+}
+
+// NewCertificatesCollector is a constructor
+func NewCertificatesCollector() *CertificatesCollector {
+	return &CertificatesCollector{
+		data: make(map[string]string),
+	}
+}
+
+func (collector *CertificatesCollector) GetName() string {
+	return "certificates"
+}
+
+// Collect implements the interface method
+func (collector *CertificatesCollector) Collect() error {
+	// find exits with an error when a directory is missing or unreadable, the files it listed are still valid then
+	args := append([]string{"-c", `find -L "$@" -type f 2>/dev/null; true`, "find"}, certificateDirectories...)
+	output, err := utils.RunCommandOnHost("sh", args...)
+	if err != nil {
+		return fmt.Errorf("list certificate files: %w", err)
+	}
+
+	files := map[string][]byte{}
+	for _, path := range strings.Fields(output) {
+		if !isCertificateFile(path) {
+			continue
+		}
+
+		content, err := utils.RunCommandOnHost("cat", path)
+		if err != nil {
+			log.Printf("Failed to read certificate file %s: %v", path, err)
+			continue
+		}
+		files[path] = []byte(content)
+	}
+
+	dataBytes, err := json.Marshal(parseCertificates(files))
+	if err != nil {
+		return fmt.Errorf("marshal certificates: %w", err)
+	}
+
+	collector.data["certificates"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *CertificatesCollector) GetData() map[string]string {
+	return collector.data
+}
+
+func isCertificateFile(path string) bool {
+	extension := filepath.Ext(path)
+	for _, e := range certificateExtensions {
+		if extension == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCertificates decodes the CERTIFICATE blocks of each file, skipping any other PEM block such as private keys,
+// and links each certificate to the collected certificate which issued it
+func parseCertificates(files map[string][]byte) []CertificateInfo {
+	type parsedCertificate struct {
+		info        CertificateInfo
+		certificate *x509.Certificate
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	parsed := []parsedCertificate{}
+	for _, path := range paths {
+		rest := files[path]
+		index := 0
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				log.Printf("Failed to parse certificate %d in %s: %v", index, path, err)
+				index++
+				continue
+			}
+
+			info := CertificateInfo{
+				Path:               path,
+				Index:              index,
+				Subject:            certificate.Subject.String(),
+				Issuer:             certificate.Issuer.String(),
+				SerialNumber:       certificate.SerialNumber.String(),
+				DNSNames:           certificate.DNSNames,
+				NotBefore:          certificate.NotBefore,
+				NotAfter:           certificate.NotAfter,
+				IsCA:               certificate.IsCA,
+				SubjectKeyID:       hex.EncodeToString(certificate.SubjectKeyId),
+				AuthorityKeyID:     hex.EncodeToString(certificate.AuthorityKeyId),
+				SignatureAlgorithm: certificate.SignatureAlgorithm.String(),
+			}
+			for _, ip := range certificate.IPAddresses {
+				info.IPAddresses = append(info.IPAddresses, ip.String())
+			}
+
+			parsed = append(parsed, parsedCertificate{info: info, certificate: certificate})
+			index++
+		}
+	}
+
+	certificates := make([]CertificateInfo, 0, len(parsed))
+	for _, p := range parsed {
+		for _, issuer := range parsed {
+			if !bytes.Equal(p.certificate.RawIssuer, issuer.certificate.RawSubject) {
+				continue
+			}
+
+			var err error
+			if bytes.Equal(p.certificate.Raw, issuer.certificate.Raw) {
+				// Self-signed leaf certificates, such as the kubelet serving certificate, are not CAs
+				err = p.certificate.CheckSignature(p.certificate.SignatureAlgorithm, p.certificate.RawTBSCertificate, p.certificate.Signature)
+			} else {
+				err = p.certificate.CheckSignatureFrom(issuer.certificate)
+			}
+
+			verified := err == nil
+			p.info.IssuerPath = issuer.info.Path
+			p.info.IssuerVerified = &verified
+			if verified {
+				break
+			}
+		}
+
+		certificates = append(certificates, p.info)
+	}
+
+	return certificates
+}
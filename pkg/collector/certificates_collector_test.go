@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, subject string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: subject},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:              []string{subject},
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return certificate, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParseCertificates(t *testing.T) {
+	ca, caKey, caPEM := newTestCertificate(t, "ca", true, nil, nil)
+	_, _, clientPEM := newTestCertificate(t, "client", false, ca, caKey)
+
+	// A certificate claiming to be issued by "ca" but signed by another key with the same subject
+	rogueCA, rogueKey, _ := newTestCertificate(t, "ca", true, nil, nil)
+	_, _, roguePEM := newTestCertificate(t, "rogue", false, rogueCA, rogueKey)
+
+	keyBytes, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+
+	files := map[string][]byte{
+		"/etc/kubernetes/certs/ca.crt":                    caPEM,
+		"/etc/kubernetes/certs/rogue.crt":                 roguePEM,
+		"/var/lib/kubelet/pki/kubelet-client-current.pem": append(clientPEM, keyPEM...),
+	}
+
+	certificates := parseCertificates(files)
+	if len(certificates) != 3 {
+		t.Fatalf("len(parseCertificates()) = %v, want 3", len(certificates))
+	}
+
+	verified := map[string]bool{}
+	for _, certificate := range certificates {
+		if certificate.IssuerVerified == nil {
+			t.Fatalf("certificate %s has no issuer", certificate.Subject)
+		}
+		verified[certificate.Subject] = *certificate.IssuerVerified
+	}
+
+	want := map[string]bool{"CN=ca": true, "CN=client": true, "CN=rogue": false}
+	for subject, v := range want {
+		if verified[subject] != v {
+			t.Errorf("certificate %s verified = %v, want %v", subject, verified[subject], v)
+		}
+	}
+
+	dataBytes, err := json.Marshal(certificates)
+	if err != nil {
+		t.Fatalf("marshal certificates: %v", err)
+	}
+
+	if strings.Contains(string(dataBytes), "PRIVATE KEY") {
+		t.Errorf("collected certificates contain a private key")
+	}
+}
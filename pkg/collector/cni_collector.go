@@ -0,0 +1,409 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	cniConfigDir = "/etc/cni/net.d"
+	// azureCNIIPAMFile is the state of the azure-vnet-ipam plugin, holding the secondary IPs of the node reserved for pods
+	azureCNIIPAMFile = "/var/run/azure-vnet-ipam.json"
+)
+
+// ipAllocationFailureMessages lists lowercase fragments of the sandbox creation errors caused by a failure to allocate a pod IP
+var ipAllocationFailureMessages = []string{
+	"failed to allocate",
+	"no ip addresses available",
+	"no available addresses",
+	"address pool",
+	"insufficient ip",
+	"subnet is full",
+}
+
+// networkDaemonSetNames lists the DaemonSets deployed by the network plugins and network policy engines used on AKS
+var networkDaemonSetNames = map[string]bool{
+	"azure-cni-networkmonitor": true,
+	"azure-ip-masq-agent":      true,
+	"azure-npm":                true,
+	"cilium":                   true,
+	"calico-node":              true,
+	"kube-proxy":               true,
+}
+
+// CNIConfig defines a CNI configuration file of the node, the plugin types it chains and the IPAM plugin types they
+// allocate pod IPs with
+type CNIConfig struct {
+	Path        string   `json:"Path"`
+	Name        string   `json:"Name,omitempty"`
+	PluginTypes []string `json:"PluginTypes"`
+	IPAMTypes   []string `json:"IPAMTypes,omitempty"`
+	Error       string   `json:"Error,omitempty"`
+}
+
+// NetworkDaemonSet defines a DaemonSet deployed by a network plugin or network policy engine
+type NetworkDaemonSet struct {
+	Namespace string   `json:"Namespace"`
+	Name      string   `json:"Name"`
+	Images    []string `json:"Images"`
+	Desired   int32    `json:"Desired"`
+	Ready     int32    `json:"Ready"`
+}
+
+// AzureCNIIPAMPool defines an address pool of the Azure CNI IPAM state of the node
+type AzureCNIIPAMPool struct {
+	AddressSpace string `json:"AddressSpace"`
+	Subnet       string `json:"Subnet"`
+	Addresses    int    `json:"Addresses"`
+	InUse        int    `json:"InUse"`
+}
+
+// CNINode defines the pod capacity of a node and the number of pods using an IP of the pod network on it
+type CNINode struct {
+	Name            string `json:"Name"`
+	InternalIP      string `json:"InternalIP,omitempty"`
+	AllocatablePods int    `json:"AllocatablePods"`
+	Pods            int    `json:"Pods"`
+}
+
+// IPAllocationEvent defines a FailedCreatePodSandBox event caused by a failure to allocate a pod IP
+type IPAllocationEvent struct {
+	Namespace     string `json:"Namespace"`
+	Pod           string `json:"Pod"`
+	Node          string `json:"Node,omitempty"`
+	Count         int32  `json:"Count"`
+	LastTimestamp string `json:"LastTimestamp"`
+	Message       string `json:"Message"`
+}
+
+// CNICollector defines a CNI Collector struct
+type CNICollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewCNICollector is a constructor
+func NewCNICollector(config *restclient.Config) *CNICollector {
+	return &CNICollector{
+		kubeconfig: config,
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *CNICollector) GetName() string {
+	return "cni"
+}
+
+// Collect implements the interface method
+func (collector *CNICollector) Collect() error {
+	output, err := utils.RunCommandOnHost("find", cniConfigDir, "-maxdepth", "1", "-type", "f")
+	if err != nil {
+		collector.data["config"] = "Failed to list " + cniConfigDir + ": " + err.Error()
+	} else {
+		files := map[string]string{}
+		for _, path := range strings.Fields(output) {
+			content, err := utils.RunCommandOnHost("cat", path)
+			if err != nil {
+				log.Printf("Read CNI config %s failed: %v", path, err)
+				continue
+			}
+			files[path] = content
+			collector.data["netd_"+filepath.Base(path)] = content
+		}
+
+		dataBytes, err := json.Marshal(parseCNIConfigs(files))
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		collector.data["config"] = string(dataBytes)
+	}
+
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	ctx := context.Background()
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	// The IPAM state only exists on nodes of Azure CNI clusters
+	if content, err := utils.RunCommandOnHost("cat", azureCNIIPAMFile); err == nil {
+		collector.data["ipam"] = content
+
+		pools, err := parseAzureCNIIPAM(content)
+		if err != nil {
+			collector.data["ipam_pools"] = "Failed to parse " + azureCNIIPAMFile + ": " + err.Error()
+		} else {
+			dataBytes, err := json.Marshal(pools)
+			if err != nil {
+				return fmt.Errorf("marshal data: %w", err)
+			}
+			collector.data["ipam_pools"] = string(dataBytes)
+		}
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		collector.data["allocatable_pods"] = "Failed to list nodes: " + err.Error()
+	} else {
+		for _, node := range nodes.Items {
+			if node.Name == hostName {
+				collector.data["allocatable_pods"] = node.Status.Allocatable.Pods().String()
+			}
+		}
+
+		pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"})
+		if err != nil {
+			return fmt.Errorf("list pods: %w", err)
+		}
+
+		dataBytes, err := json.Marshal(getCNINodes(nodes.Items, pods.Items))
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		collector.data["cni_nodes"] = string(dataBytes)
+	}
+
+	events, err := clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "reason=FailedCreatePodSandBox"})
+	if err != nil {
+		return fmt.Errorf("list events: %w", err)
+	}
+
+	dataBytes, err := json.Marshal(getIPAllocationEvents(events.Items))
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["ip_allocation_events"] = string(dataBytes)
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list daemonsets: %w", err)
+	}
+
+	networkDaemonSets := []NetworkDaemonSet{}
+	for _, daemonSet := range daemonSets.Items {
+		if !networkDaemonSetNames[daemonSet.Name] {
+			continue
+		}
+
+		networkDaemonSet := NetworkDaemonSet{
+			Namespace: daemonSet.Namespace,
+			Name:      daemonSet.Name,
+			Images:    []string{},
+			Desired:   daemonSet.Status.DesiredNumberScheduled,
+			Ready:     daemonSet.Status.NumberReady,
+		}
+		for _, container := range daemonSet.Spec.Template.Spec.Containers {
+			networkDaemonSet.Images = append(networkDaemonSet.Images, container.Image)
+		}
+		networkDaemonSets = append(networkDaemonSets, networkDaemonSet)
+	}
+
+	dataBytes, err = json.Marshal(networkDaemonSets)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["daemonsets"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *CNICollector) GetData() map[string]string {
+	return collector.data
+}
+
+// parseCNIConfigs returns the plugin types of .conf and .conflist files, in the order the container runtime loads them
+func parseCNIConfigs(files map[string]string) []CNIConfig {
+	paths := []string{}
+	for path := range files {
+		if ext := filepath.Ext(path); ext == ".conf" || ext == ".conflist" || ext == ".json" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	configs := []CNIConfig{}
+	for _, path := range paths {
+		config := CNIConfig{Path: path, PluginTypes: []string{}}
+
+		type ipam struct {
+			Type string `json:"type"`
+		}
+		var content struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			IPAM    ipam   `json:"ipam"`
+			Plugins []struct {
+				Type string `json:"type"`
+				IPAM ipam   `json:"ipam"`
+			} `json:"plugins"`
+		}
+		if err := json.Unmarshal([]byte(files[path]), &content); err != nil {
+			config.Error = err.Error()
+			configs = append(configs, config)
+			continue
+		}
+
+		config.Name = content.Name
+		if content.Type != "" {
+			config.PluginTypes = append(config.PluginTypes, content.Type)
+		}
+		if content.IPAM.Type != "" {
+			config.IPAMTypes = append(config.IPAMTypes, content.IPAM.Type)
+		}
+		for _, plugin := range content.Plugins {
+			config.PluginTypes = append(config.PluginTypes, plugin.Type)
+			if plugin.IPAM.Type != "" {
+				config.IPAMTypes = append(config.IPAMTypes, plugin.IPAM.Type)
+			}
+		}
+		configs = append(configs, config)
+	}
+
+	return configs
+}
+
+// parseAzureCNIIPAM counts the addresses of each pool of the azure-vnet-ipam state, and the addresses assigned to pods
+func parseAzureCNIIPAM(content string) ([]AzureCNIIPAMPool, error) {
+	var state struct {
+		IPAM struct {
+			AddressSpaces map[string]struct {
+				Pools map[string]struct {
+					Subnet    net.IPNet `json:"Subnet"`
+					Addresses map[string]struct {
+						InUse bool `json:"InUse"`
+					} `json:"Addresses"`
+				} `json:"Pools"`
+			} `json:"AddressSpaces"`
+		} `json:"IPAM"`
+	}
+	if err := json.Unmarshal([]byte(content), &state); err != nil {
+		return nil, err
+	}
+
+	pools := []AzureCNIIPAMPool{}
+	for addressSpaceName, addressSpace := range state.IPAM.AddressSpaces {
+		for id, pool := range addressSpace.Pools {
+			ipamPool := AzureCNIIPAMPool{
+				AddressSpace: addressSpaceName,
+				Subnet:       id,
+				Addresses:    len(pool.Addresses),
+			}
+			if pool.Subnet.IP != nil && pool.Subnet.Mask != nil {
+				ipamPool.Subnet = pool.Subnet.String()
+			}
+			for _, address := range pool.Addresses {
+				if address.InUse {
+					ipamPool.InUse++
+				}
+			}
+			pools = append(pools, ipamPool)
+		}
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		if pools[i].AddressSpace != pools[j].AddressSpace {
+			return pools[i].AddressSpace < pools[j].AddressSpace
+		}
+		return pools[i].Subnet < pools[j].Subnet
+	})
+
+	return pools, nil
+}
+
+// getCNINodes counts the running and pending pods of each node which get an IP from the pod network, host network pods
+// using the IP of the node
+func getCNINodes(nodes []v1.Node, pods []v1.Pod) []CNINode {
+	podCounts := map[string]int{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && !pod.Spec.HostNetwork {
+			podCounts[pod.Spec.NodeName]++
+		}
+	}
+
+	cniNodes := []CNINode{}
+	for _, node := range nodes {
+		cniNode := CNINode{
+			Name:            node.Name,
+			AllocatablePods: int(node.Status.Allocatable.Pods().Value()),
+			Pods:            podCounts[node.Name],
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == v1.NodeInternalIP {
+				cniNode.InternalIP = address.Address
+				break
+			}
+		}
+		cniNodes = append(cniNodes, cniNode)
+	}
+
+	sort.Slice(cniNodes, func(i, j int) bool { return cniNodes[i].Name < cniNodes[j].Name })
+
+	return cniNodes
+}
+
+// getIPAllocationEvents returns the FailedCreatePodSandBox events of pods whose sandbox failed to get an IP
+func getIPAllocationEvents(events []v1.Event) []IPAllocationEvent {
+	ipAllocationEvents := []IPAllocationEvent{}
+	for _, event := range events {
+		if event.InvolvedObject.Kind != "Pod" || !isIPAllocationFailure(event.Message) {
+			continue
+		}
+
+		lastTimestamp := event.LastTimestamp.Time
+		if lastTimestamp.IsZero() {
+			lastTimestamp = event.EventTime.Time
+		}
+
+		node := event.Source.Host
+		if node == "" {
+			node = event.ReportingInstance
+		}
+
+		count := event.Count
+		if count == 0 {
+			count = 1
+		}
+
+		ipAllocationEvents = append(ipAllocationEvents, IPAllocationEvent{
+			Namespace:     event.InvolvedObject.Namespace,
+			Pod:           event.InvolvedObject.Name,
+			Node:          node,
+			Count:         count,
+			LastTimestamp: lastTimestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			Message:       event.Message,
+		})
+	}
+
+	sort.SliceStable(ipAllocationEvents, func(i, j int) bool {
+		return ipAllocationEvents[i].LastTimestamp > ipAllocationEvents[j].LastTimestamp
+	})
+
+	return ipAllocationEvents
+}
+
+func isIPAllocationFailure(message string) bool {
+	message = strings.ToLower(message)
+	for _, fragment := range ipAllocationFailureMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
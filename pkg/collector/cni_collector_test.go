@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCNIConfigs(t *testing.T) {
+	files := map[string]string{
+		"/etc/cni/net.d/10-azure.conflist": `{
+			"cniVersion": "0.3.0",
+			"name": "azure",
+			"plugins": [
+				{"type": "azure-vnet", "mode": "transparent", "ipam": {"type": "azure-vnet-ipam"}},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`,
+		"/etc/cni/net.d/10-calico.conflist": `{
+			"name": "k8s-pod-network",
+			"plugins": [
+				{"type": "calico", "ipam": {"type": "host-local", "subnet": "usePodCidr"}},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`,
+		"/etc/cni/net.d/05-bridge.conf":     `{"cniVersion": "0.3.1", "name": "kubenet", "type": "bridge", "ipam": {"type": "host-local"}}`,
+		"/etc/cni/net.d/99-broken.conflist": `{"plugins": [`,
+		"/etc/cni/net.d/azure-vnet.log":     "not a configuration",
+	}
+
+	want := []CNIConfig{
+		{Path: "/etc/cni/net.d/05-bridge.conf", Name: "kubenet", PluginTypes: []string{"bridge"}, IPAMTypes: []string{"host-local"}},
+		{Path: "/etc/cni/net.d/10-azure.conflist", Name: "azure", PluginTypes: []string{"azure-vnet", "portmap"}, IPAMTypes: []string{"azure-vnet-ipam"}},
+		{Path: "/etc/cni/net.d/10-calico.conflist", Name: "k8s-pod-network", PluginTypes: []string{"calico", "portmap"}, IPAMTypes: []string{"host-local"}},
+		{Path: "/etc/cni/net.d/99-broken.conflist", PluginTypes: []string{}, Error: "unexpected end of JSON input"},
+	}
+
+	if got := parseCNIConfigs(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCNIConfigs() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseAzureCNIIPAM(t *testing.T) {
+	content := `{
+		"IPAM": {
+			"AddressSpaces": {
+				"local": {
+					"Id": "local",
+					"Pools": {
+						"10.240.0.0/16": {
+							"Id": "10.240.0.0/16",
+							"IfName": "eth0",
+							"Subnet": {"IP": "10.240.0.0", "Mask": "//8AAA=="},
+							"Gateway": "10.240.0.1",
+							"Addresses": {
+								"10.240.0.5": {"ID": "", "Addr": "10.240.0.5", "InUse": true},
+								"10.240.0.6": {"ID": "", "Addr": "10.240.0.6", "InUse": false},
+								"10.240.0.7": {"ID": "", "Addr": "10.240.0.7", "InUse": true}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name    string
+		content string
+		want    []AzureCNIIPAMPool
+		wantErr bool
+	}{
+		{
+			name:    "pool with addresses in use",
+			content: content,
+			want:    []AzureCNIIPAMPool{{AddressSpace: "local", Subnet: "10.240.0.0/16", Addresses: 3, InUse: 2}},
+		},
+		{
+			name:    "empty state",
+			content: `{"IPAM": {"AddressSpaces": {}}}`,
+			want:    []AzureCNIIPAMPool{},
+		},
+		{
+			name:    "invalid state",
+			content: `{"IPAM": `,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAzureCNIIPAM(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAzureCNIIPAM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAzureCNIIPAM() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIPAllocationFailure(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{
+			message: `Failed to create pod sandbox: rpc error: code = Unknown desc = failed to setup network for sandbox "abc": plugin type="azure-vnet" failed (add): Failed to allocate address: No available addresses`,
+			want:    true,
+		},
+		{
+			message: `Failed to create pod sandbox: plugin type="bridge" failed (add): failed to allocate for range 0: no IP addresses available in range set: 10.244.1.1-10.244.1.254`,
+			want:    true,
+		},
+		{
+			message: `Failed to create pod sandbox: rpc error: code = Unknown desc = failed to get sandbox image "mcr.microsoft.com/oss/kubernetes/pause:3.5": i/o timeout`,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := isIPAllocationFailure(tt.message); got != tt.want {
+			t.Errorf("isIPAllocationFailure(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
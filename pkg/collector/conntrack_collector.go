@@ -0,0 +1,290 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	conntrackCountFile = "/proc/sys/net/netfilter/nf_conntrack_count"
+	conntrackMaxFile   = "/proc/sys/net/netfilter/nf_conntrack_max"
+	conntrackStatFile  = "/proc/net/stat/nf_conntrack"
+	conntrackTableFile = "/proc/net/nf_conntrack"
+	// conntrackTopDestinations defines the number of public destinations with the most connections which are kept
+	conntrackTopDestinations = 20
+)
+
+// privateNetworks lists the destinations which are not translated by the load balancer outbound rules
+var privateNetworks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"168.63.129.16/32",
+	"fc00::/7",
+	"fe80::/10",
+	"::1/128",
+}
+
+// ConntrackSample defines the conntrack table usage and the cumulative conntrack statistics of the node at a point in time
+type ConntrackSample struct {
+	TimeStamp    time.Time `json:"TimeStamp"`
+	Count        int       `json:"Count"`
+	Max          int       `json:"Max"`
+	InsertFailed uint64    `json:"InsertFailed"`
+	Drop         uint64    `json:"Drop"`
+	EarlyDrop    uint64    `json:"EarlyDrop"`
+}
+
+// ConntrackDestination defines the connections tracked by the node to a public destination
+type ConntrackDestination struct {
+	Protocol    string `json:"Protocol"`
+	Destination string `json:"Destination"`
+	Connections int    `json:"Connections"`
+	TimeWait    int    `json:"TimeWait,omitempty"`
+}
+
+// ConntrackCollector defines a Conntrack Collector struct
+type ConntrackCollector struct {
+	interval time.Duration
+	data     map[string]string
+}
+
+// NewConntrackCollector is a constructor
+func NewConntrackCollector() *ConntrackCollector {
+	return &ConntrackCollector{
+		interval: defaultNetworkOutboundInterval,
+		data:     make(map[string]string),
+	}
+}
+
+func (collector *ConntrackCollector) GetName() string {
+	return "conntrack"
+}
+
+// GetInterval returns the interval between two samples
+func (collector *ConntrackCollector) GetInterval() time.Duration {
+	return collector.interval
+}
+
+// Collect implements the interface method
+func (collector *ConntrackCollector) Collect() error {
+	// Conntrack is sampled alongside the network outbound probes, so both time series cover the same window
+	duration, err := getDurationFromEnv("DIAGNOSTIC_NETWORKOUTBOUND_DURATION", 0)
+	if err != nil {
+		return err
+	}
+
+	collector.interval, err = getDurationFromEnv("DIAGNOSTIC_NETWORKOUTBOUND_INTERVAL", defaultNetworkOutboundInterval)
+	if err != nil {
+		return err
+	}
+
+	if collector.interval == 0 {
+		return fmt.Errorf("DIAGNOSTIC_NETWORKOUTBOUND_INTERVAL must be positive")
+	}
+
+	samples := []string{}
+	peakCount := -1
+	var destinations []ConntrackDestination
+
+	ticker := time.NewTicker(collector.interval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(duration)
+	for {
+		sample, err := sampleConntrack(time.Now().Truncate(1 * time.Second))
+		if err != nil {
+			return err
+		}
+
+		dataBytes, err := json.Marshal(sample)
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		samples = append(samples, string(dataBytes))
+
+		// The connections are only listed when the table is at its fullest, the listing being expensive on busy nodes
+		if sample.Count > peakCount {
+			peakCount = sample.Count
+			if table, err := utils.RunCommandOnHost("cat", conntrackTableFile); err == nil {
+				destinations = parseConntrackDestinations(table, conntrackTopDestinations)
+			} else {
+				log.Printf("Read %s failed: %v", conntrackTableFile, err)
+			}
+		}
+
+		if time.Now().Add(collector.interval).After(deadline) {
+			break
+		}
+		<-ticker.C
+	}
+
+	collector.data["samples"] = strings.Join(samples, "\n")
+
+	if destinations != nil {
+		dataBytes, err := json.Marshal(destinations)
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		collector.data["destinations"] = string(dataBytes)
+	}
+
+	return nil
+}
+
+func (collector *ConntrackCollector) GetData() map[string]string {
+	return collector.data
+}
+
+func sampleConntrack(timeStamp time.Time) (*ConntrackSample, error) {
+	sample := &ConntrackSample{TimeStamp: timeStamp}
+
+	for file, value := range map[string]*int{conntrackCountFile: &sample.Count, conntrackMaxFile: &sample.Max} {
+		output, err := utils.RunCommandOnHost("cat", file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+
+		if *value, err = strconv.Atoi(strings.TrimSpace(output)); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+	}
+
+	output, err := utils.RunCommandOnHost("cat", conntrackStatFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", conntrackStatFile, err)
+	}
+
+	stats, err := parseConntrackStats(output)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", conntrackStatFile, err)
+	}
+
+	sample.InsertFailed = stats["insert_failed"]
+	sample.Drop = stats["drop"]
+	sample.EarlyDrop = stats["early_drop"]
+
+	return sample, nil
+}
+
+// parseConntrackStats sums the per CPU counters of /proc/net/stat/nf_conntrack, whose columns are named by its header
+// and whose values are hexadecimal
+func parseConntrackStats(content string) (map[string]uint64, error) {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("no statistics")
+	}
+
+	columns := strings.Fields(lines[0])
+	stats := map[string]uint64{}
+	for i, line := range lines[1:] {
+		values := strings.Fields(line)
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("line %d has %d values for %d columns", i+2, len(values), len(columns))
+		}
+
+		for j, column := range columns {
+			value, err := strconv.ParseUint(values[j], 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+2, err)
+			}
+
+			// The entries column is the size of the table, repeated on the line of every CPU
+			if column == "entries" {
+				stats[column] = value
+			} else {
+				stats[column] += value
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// parseConntrackDestinations counts the TCP and UDP connections to public destinations, in their original direction,
+// and returns the destinations with the most connections first
+func parseConntrackDestinations(content string, top int) []ConntrackDestination {
+	counts := map[string]*ConntrackDestination{}
+
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		protocol := fields[2]
+		if protocol != "tcp" && protocol != "udp" {
+			continue
+		}
+
+		var dst, dport, state string
+		for i, field := range fields {
+			switch {
+			case strings.HasPrefix(field, "dst=") && dst == "":
+				dst = strings.TrimPrefix(field, "dst=")
+			case strings.HasPrefix(field, "dport=") && dport == "":
+				dport = strings.TrimPrefix(field, "dport=")
+			case i == 5 && protocol == "tcp":
+				state = field
+			}
+		}
+
+		if dst == "" || dport == "" || isPrivateAddress(dst) {
+			continue
+		}
+
+		key := protocol + "/" + net.JoinHostPort(dst, dport)
+		destination, ok := counts[key]
+		if !ok {
+			destination = &ConntrackDestination{Protocol: protocol, Destination: net.JoinHostPort(dst, dport)}
+			counts[key] = destination
+		}
+		destination.Connections++
+		if state == "TIME_WAIT" {
+			destination.TimeWait++
+		}
+	}
+
+	destinations := []ConntrackDestination{}
+	for _, destination := range counts {
+		destinations = append(destinations, *destination)
+	}
+
+	sort.Slice(destinations, func(i, j int) bool {
+		if destinations[i].Connections != destinations[j].Connections {
+			return destinations[i].Connections > destinations[j].Connections
+		}
+		return destinations[i].Protocol+destinations[i].Destination < destinations[j].Protocol+destinations[j].Destination
+	})
+
+	if len(destinations) > top {
+		destinations = destinations[:top]
+	}
+
+	return destinations
+}
+
+func isPrivateAddress(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return true
+	}
+
+	for _, cidr := range privateNetworks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
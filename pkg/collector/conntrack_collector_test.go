@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConntrackStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]uint64
+		wantErr bool
+	}{
+		{
+			name: "per CPU counters",
+			content: `entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop icmp_error  expect_new expect_create expect_delete search_restart
+000001f4  00000000 00000000 00000000 00000010 00000000 00000000 00000000 00000000 00000002 00000001 00000000 00000000  00000000 00000000 00000000 00000000
+000001f4  00000000 00000000 00000000 00000001 00000000 00000000 00000000 00000000 0000000a 00000000 00000003 00000000  00000000 00000000 00000000 00000000
+`,
+			want: map[string]uint64{
+				"entries": 500, "clashres": 0, "found": 0, "new": 0, "invalid": 17, "ignore": 0, "delete": 0, "chainlength": 0,
+				"insert": 0, "insert_failed": 12, "drop": 1, "early_drop": 3, "icmp_error": 0, "expect_new": 0, "expect_create": 0,
+				"expect_delete": 0, "search_restart": 0,
+			},
+		},
+		{
+			name:    "no statistics",
+			content: "entries insert_failed drop\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing values",
+			content: "entries insert_failed drop\n000001f4 00000001\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConntrackStats(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConntrackStats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConntrackStats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConntrackDestinations(t *testing.T) {
+	content := `ipv4     2 tcp      6 86399 ESTABLISHED src=10.244.0.12 dst=20.50.2.1 sport=41234 dport=443 src=20.50.2.1 dst=10.240.0.4 sport=443 dport=41234 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 tcp      6 110 TIME_WAIT src=10.244.0.12 dst=20.50.2.1 sport=41236 dport=443 src=20.50.2.1 dst=10.240.0.4 sport=443 dport=41236 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 tcp      6 86399 ESTABLISHED src=10.240.0.4 dst=13.107.42.16 sport=50000 dport=443 src=13.107.42.16 dst=10.240.0.4 sport=443 dport=50000 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 udp      17 20 src=10.244.0.12 dst=10.0.0.10 sport=53000 dport=53 src=10.244.0.5 dst=10.244.0.12 sport=53 dport=53000 mark=0 zone=0 use=2
+ipv4     2 udp      17 25 src=10.240.0.4 dst=91.189.91.157 sport=123 dport=123 src=91.189.91.157 dst=10.240.0.4 sport=123 dport=123 mark=0 zone=0 use=2
+ipv4     2 tcp      6 86399 ESTABLISHED src=10.240.0.4 dst=168.63.129.16 sport=50002 dport=80 src=168.63.129.16 dst=10.240.0.4 sport=80 dport=50002 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 icmp     1 29 src=10.240.0.4 dst=20.50.2.1 type=8 code=0 id=1 src=20.50.2.1 dst=10.240.0.4 type=0 code=0 id=1 mark=0 zone=0 use=2
+`
+
+	want := []ConntrackDestination{
+		{Protocol: "tcp", Destination: "20.50.2.1:443", Connections: 2, TimeWait: 1},
+		{Protocol: "tcp", Destination: "13.107.42.16:443", Connections: 1},
+	}
+
+	if got := parseConntrackDestinations(content, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseConntrackDestinations() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,349 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// criEndpoints lists the CRI sockets probed on the host, in order of preference
+var criEndpoints = []string{
+	"/run/containerd/containerd.sock",
+	"/var/run/dockershim.sock",
+}
+
+// ContainerRuntimeSandbox defines a pod sandbox as reported by the container runtime
+type ContainerRuntimeSandbox struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	UID       string    `json:"uid"`
+	Attempt   int       `json:"attempt"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ContainerRuntimeContainer defines a container as reported by the container runtime
+type ContainerRuntimeContainer struct {
+	ID           string    `json:"id"`
+	SandboxID    string    `json:"podSandboxId"`
+	Name         string    `json:"name"`
+	PodName      string    `json:"podName"`
+	PodNamespace string    `json:"podNamespace"`
+	PodUID       string    `json:"podUid"`
+	Attempt      int       `json:"attempt"`
+	State        string    `json:"state"`
+	Image        string    `json:"image"`
+	ImageRef     string    `json:"imageRef"`
+	ExitCode     *int32    `json:"exitCode,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ContainerRuntimePodCorrelation compares the pods known by the runtime with the pods the API server schedules to the node
+type ContainerRuntimePodCorrelation struct {
+	NodeName         string   `json:"nodeName"`
+	MatchedPods      []string `json:"matchedPods"`
+	MissingOnRuntime []string `json:"missingOnRuntime"`
+	UnknownToAPI     []string `json:"unknownToApi"`
+}
+
+// ContainerRuntimeCollector defines a Container Runtime Collector struct
+type ContainerRuntimeCollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+type criMetadata struct {
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	Namespace string `json:"namespace"`
+	Attempt   int    `json:"attempt"`
+}
+
+type criPodSandboxList struct {
+	Items []struct {
+		ID        string      `json:"id"`
+		Metadata  criMetadata `json:"metadata"`
+		State     string      `json:"state"`
+		CreatedAt string      `json:"createdAt"`
+	} `json:"items"`
+}
+
+type criContainerList struct {
+	Containers []struct {
+		ID           string      `json:"id"`
+		PodSandboxID string      `json:"podSandboxId"`
+		Metadata     criMetadata `json:"metadata"`
+		Image        struct {
+			Image string `json:"image"`
+		} `json:"image"`
+		ImageRef  string            `json:"imageRef"`
+		State     string            `json:"state"`
+		CreatedAt string            `json:"createdAt"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"containers"`
+}
+
+type criContainerInspect struct {
+	Status struct {
+		ExitCode int32  `json:"exitCode"`
+		Reason   string `json:"reason"`
+	} `json:"status"`
+}
+
+// NewContainerRuntimeCollector is a constructor
+func NewContainerRuntimeCollector(config *restclient.Config) *ContainerRuntimeCollector {
+	return &ContainerRuntimeCollector{
+		data:       make(map[string]string),
+		kubeconfig: config,
+	}
+}
+
+func (collector *ContainerRuntimeCollector) GetName() string {
+	return "containerruntime"
+}
+
+// Collect implements the interface method
+func (collector *ContainerRuntimeCollector) Collect() error {
+	endpoint, err := getCRIEndpoint()
+	if err != nil {
+		return err
+	}
+
+	// The output of commands on the host includes their stderr, so the warnings of crictl, such as the missing image
+	// endpoint, are discarded to keep its JSON output parseable
+	crictl := func(arg ...string) (string, error) {
+		return utils.RunCommandOnHost("sh", append([]string{"-c", `exec crictl "$@" 2>/dev/null`, "crictl", "--runtime-endpoint", endpoint}, arg...)...)
+	}
+
+	for key, args := range map[string][]string{
+		"version":     {"version"},
+		"info":        {"info"},
+		"imagefsinfo": {"imagefsinfo"},
+	} {
+		output, err := crictl(args...)
+		if err != nil {
+			output = fmt.Sprintf("Failed to run crictl %s: %v", args[0], err)
+			log.Print(output)
+		}
+		collector.data[key] = output
+	}
+
+	config, err := utils.RunCommandOnHost("cat", "/etc/containerd/config.toml")
+	if err != nil {
+		config = fmt.Sprintf("Failed to read containerd config: %v", err)
+	}
+	collector.data["containerd_config"] = config
+
+	output, err := crictl("pods", "-o", "json")
+	if err != nil {
+		return fmt.Errorf("list pod sandboxes: %w", err)
+	}
+
+	sandboxes, err := parseCRIPodSandboxes(output)
+	if err != nil {
+		return err
+	}
+
+	output, err = crictl("ps", "-a", "-o", "json")
+	if err != nil {
+		return fmt.Errorf("list containers: %w", err)
+	}
+
+	containers, err := parseCRIContainers(output)
+	if err != nil {
+		return err
+	}
+
+	for i := range containers {
+		if containers[i].State == "CONTAINER_RUNNING" {
+			continue
+		}
+
+		inspect, err := crictl("inspect", containers[i].ID)
+		if err != nil {
+			log.Printf("Failed to inspect container %s: %v", containers[i].ID, err)
+			continue
+		}
+
+		var status criContainerInspect
+		if err := json.Unmarshal([]byte(inspect), &status); err != nil {
+			log.Printf("Failed to unmarshal container %s status: %v", containers[i].ID, err)
+			continue
+		}
+
+		exitCode := status.Status.ExitCode
+		containers[i].ExitCode = &exitCode
+		containers[i].Reason = status.Status.Reason
+	}
+
+	sandboxesBytes, err := json.Marshal(sandboxes)
+	if err != nil {
+		return fmt.Errorf("marshal pod sandboxes: %w", err)
+	}
+	collector.data["containerruntime_pods"] = string(sandboxesBytes)
+
+	containersBytes, err := json.Marshal(containers)
+	if err != nil {
+		return fmt.Errorf("marshal containers: %w", err)
+	}
+	collector.data["containerruntime_containers"] = string(containersBytes)
+
+	correlation, err := collector.correlatePods(sandboxes)
+	if err != nil {
+		log.Printf("Failed to correlate runtime pods with the API server: %v", err)
+		return nil
+	}
+
+	correlationBytes, err := json.Marshal(correlation)
+	if err != nil {
+		return fmt.Errorf("marshal pod correlation: %w", err)
+	}
+	collector.data["correlation"] = string(correlationBytes)
+
+	return nil
+}
+
+func (collector *ContainerRuntimeCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// correlatePods compares the ready sandboxes on the node with the pods the API server has scheduled to it
+func (collector *ContainerRuntimeCollector) correlatePods(sandboxes []ContainerRuntimeSandbox) (*ContainerRuntimePodCorrelation, error) {
+	nodeName, err := utils.GetHostName()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	podList, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list pods on node %s: %w", nodeName, err)
+	}
+
+	apiPods := map[string]string{}
+	for _, pod := range podList.Items {
+		apiPods[string(pod.UID)] = pod.Namespace + "/" + pod.Name
+	}
+
+	return correlateRuntimePods(nodeName, sandboxes, apiPods), nil
+}
+
+func correlateRuntimePods(nodeName string, sandboxes []ContainerRuntimeSandbox, apiPods map[string]string) *ContainerRuntimePodCorrelation {
+	correlation := &ContainerRuntimePodCorrelation{
+		NodeName:         nodeName,
+		MatchedPods:      []string{},
+		MissingOnRuntime: []string{},
+		UnknownToAPI:     []string{},
+	}
+
+	runtimePods := map[string]bool{}
+	for _, sandbox := range sandboxes {
+		if sandbox.State != "SANDBOX_READY" {
+			continue
+		}
+
+		runtimePods[sandbox.UID] = true
+		if name, ok := apiPods[sandbox.UID]; ok {
+			correlation.MatchedPods = append(correlation.MatchedPods, name)
+		} else {
+			correlation.UnknownToAPI = append(correlation.UnknownToAPI, sandbox.Namespace+"/"+sandbox.Name)
+		}
+	}
+
+	for uid, name := range apiPods {
+		if !runtimePods[uid] {
+			correlation.MissingOnRuntime = append(correlation.MissingOnRuntime, name)
+		}
+	}
+
+	sort.Strings(correlation.MatchedPods)
+	sort.Strings(correlation.MissingOnRuntime)
+	sort.Strings(correlation.UnknownToAPI)
+
+	return correlation
+}
+
+func getCRIEndpoint() (string, error) {
+	for _, socket := range criEndpoints {
+		if _, err := utils.RunCommandOnHost("test", "-S", socket); err == nil {
+			return "unix://" + socket, nil
+		}
+	}
+
+	return "", fmt.Errorf("no container runtime socket found in %s", strings.Join(criEndpoints, ", "))
+}
+
+func parseCRIPodSandboxes(output string) ([]ContainerRuntimeSandbox, error) {
+	var list criPodSandboxList
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("unmarshal pod sandboxes: %w", err)
+	}
+
+	sandboxes := make([]ContainerRuntimeSandbox, 0, len(list.Items))
+	for _, item := range list.Items {
+		sandboxes = append(sandboxes, ContainerRuntimeSandbox{
+			ID:        item.ID,
+			Name:      item.Metadata.Name,
+			Namespace: item.Metadata.Namespace,
+			UID:       item.Metadata.UID,
+			Attempt:   item.Metadata.Attempt,
+			State:     item.State,
+			CreatedAt: parseCRITimestamp(item.CreatedAt),
+		})
+	}
+
+	return sandboxes, nil
+}
+
+func parseCRIContainers(output string) ([]ContainerRuntimeContainer, error) {
+	var list criContainerList
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("unmarshal containers: %w", err)
+	}
+
+	containers := make([]ContainerRuntimeContainer, 0, len(list.Containers))
+	for _, item := range list.Containers {
+		containers = append(containers, ContainerRuntimeContainer{
+			ID:           item.ID,
+			SandboxID:    item.PodSandboxID,
+			Name:         item.Metadata.Name,
+			PodName:      item.Labels["io.kubernetes.pod.name"],
+			PodNamespace: item.Labels["io.kubernetes.pod.namespace"],
+			PodUID:       item.Labels["io.kubernetes.pod.uid"],
+			Attempt:      item.Metadata.Attempt,
+			State:        item.State,
+			Image:        item.Image.Image,
+			ImageRef:     item.ImageRef,
+			CreatedAt:    parseCRITimestamp(item.CreatedAt),
+		})
+	}
+
+	return containers, nil
+}
+
+// parseCRITimestamp converts the nanoseconds since epoch reported by crictl to a time
+func parseCRITimestamp(value string) time.Time {
+	var nanoseconds int64
+	if _, err := fmt.Sscan(value, &nanoseconds); err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanoseconds).UTC()
+}
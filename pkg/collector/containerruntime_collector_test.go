@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCorrelateRuntimePods(t *testing.T) {
+	tests := []struct {
+		name    string
+		pods    string
+		apiPods map[string]string
+		want    *ContainerRuntimePodCorrelation
+		wantErr bool
+	}{
+		{
+			name: "runtime and api server agree",
+			pods: `{"items":[{"id":"a1","metadata":{"name":"coredns","uid":"uid-1","namespace":"kube-system","attempt":0},"state":"SANDBOX_READY","createdAt":"1634551200000000000"}]}`,
+			apiPods: map[string]string{
+				"uid-1": "kube-system/coredns",
+			},
+			want: &ContainerRuntimePodCorrelation{
+				NodeName:         "node",
+				MatchedPods:      []string{"kube-system/coredns"},
+				MissingOnRuntime: []string{},
+				UnknownToAPI:     []string{},
+			},
+		},
+		{
+			name: "pods missing on either side",
+			pods: `{"items":[{"id":"a1","metadata":{"name":"orphan","uid":"uid-2","namespace":"default"},"state":"SANDBOX_READY","createdAt":"0"},{"id":"a2","metadata":{"name":"old","uid":"uid-3","namespace":"default"},"state":"SANDBOX_NOTREADY","createdAt":"0"}]}`,
+			apiPods: map[string]string{
+				"uid-1": "kube-system/coredns",
+				"uid-3": "default/old",
+			},
+			want: &ContainerRuntimePodCorrelation{
+				NodeName:         "node",
+				MatchedPods:      []string{},
+				MissingOnRuntime: []string{"default/old", "kube-system/coredns"},
+				UnknownToAPI:     []string{"default/orphan"},
+			},
+		},
+		{
+			name:    "invalid crictl output",
+			pods:    "not json",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandboxes, err := parseCRIPodSandboxes(tt.pods)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCRIPodSandboxes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := correlateRuntimePods("node", sandboxes, tt.apiPods)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("correlateRuntimePods() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	coreDNSNamespace     = "kube-system"
+	coreDNSLabelSelector = "k8s-app=kube-dns"
+	coreDNSServiceName   = "kube-dns"
+	coreDNSMetricsPort   = "9153"
+	coreDNSLogTailLines  = 1000
+)
+
+// CoreDNSEndpoints defines the addresses CoreDNS is reachable at from the cluster
+type CoreDNSEndpoints struct {
+	ServiceIP string   `json:"ServiceIP"`
+	PodIPs    []string `json:"PodIPs"`
+}
+
+// CoreDNSForwardTarget defines the result of querying an upstream nameserver of a forward plugin
+type CoreDNSForwardTarget struct {
+	Source     string  `json:"Source"`
+	Zone       string  `json:"Zone"`
+	Target     string  `json:"Target"`
+	ResolvConf string  `json:"ResolvConf,omitempty"`
+	Status     string  `json:"Status"`
+	LatencyMs  float64 `json:"LatencyMs,omitempty"`
+	Error      string  `json:"Error,omitempty"`
+}
+
+// CoreDNSCollector defines a CoreDNS Collector struct
+type CoreDNSCollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewCoreDNSCollector is a constructor
+func NewCoreDNSCollector(config *restclient.Config) *CoreDNSCollector {
+	return &CoreDNSCollector{
+		kubeconfig: config,
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *CoreDNSCollector) GetName() string {
+	return "coredns"
+}
+
+// Collect implements the interface method
+func (collector *CoreDNSCollector) Collect() error {
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	// CoreDNS is cluster-wide, so a single pod of the DaemonSet collects it
+	if clusterScope, err := utils.IsClusterScopeInstance(clientset); err != nil {
+		log.Printf("Check cluster scope instance failed, CoreDNS is collected: %v", err)
+	} else if !clusterScope {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	configMaps := map[string]map[string]string{}
+	for _, name := range []string{"coredns", "coredns-custom"} {
+		configMap, err := clientset.CoreV1().ConfigMaps(coreDNSNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Printf("Get ConfigMap %s failed: %v", name, err)
+			}
+			continue
+		}
+
+		configMaps[name] = configMap.Data
+		dataBytes, err := json.Marshal(configMap.Data)
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		collector.data["configmap_"+name] = string(dataBytes)
+	}
+
+	endpoints := CoreDNSEndpoints{PodIPs: []string{}}
+	if service, err := clientset.CoreV1().Services(coreDNSNamespace).Get(ctx, coreDNSServiceName, metav1.GetOptions{}); err == nil {
+		endpoints.ServiceIP = service.Spec.ClusterIP
+	} else {
+		log.Printf("Get Service %s failed: %v", coreDNSServiceName, err)
+	}
+
+	pods, err := clientset.CoreV1().Pods(coreDNSNamespace).List(ctx, metav1.ListOptions{LabelSelector: coreDNSLabelSelector})
+	if err != nil {
+		return fmt.Errorf("list CoreDNS pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP != "" {
+			endpoints.PodIPs = append(endpoints.PodIPs, pod.Status.PodIP)
+		}
+
+		logs, err := getCoreDNSLogs(clientset, &pod)
+		if err != nil {
+			logs = err.Error()
+		}
+		collector.data["logs_"+pod.Name] = logs
+
+		metrics, err := clientset.CoreV1().Pods(coreDNSNamespace).ProxyGet("http", pod.Name, coreDNSMetricsPort, "metrics", nil).DoRaw(ctx)
+		if err != nil {
+			collector.data["metrics_"+pod.Name] = "Failed to get metrics: " + err.Error()
+		} else {
+			collector.data["metrics_"+pod.Name] = string(metrics)
+		}
+	}
+
+	dataBytes, err := json.Marshal(endpoints)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["endpoints"] = string(dataBytes)
+
+	blocks, err := ParseCoreDNSConfigMaps(configMaps["coredns"], configMaps["coredns-custom"])
+	if err != nil {
+		log.Printf("Parse CoreDNS configuration failed: %v", err)
+		return nil
+	}
+
+	nodeResolvConf, err := utils.ReadNodeResolvConf()
+	if err != nil {
+		log.Printf("Read node resolv.conf failed, resolv.conf forward targets are skipped: %v", err)
+	}
+
+	dataBytes, err = json.Marshal(probeCoreDNSForwardTargets(blocks, nodeResolvConf))
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["forward"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *CoreDNSCollector) GetData() map[string]string {
+	return collector.data
+}
+
+func getCoreDNSLogs(clientset *kubernetes.Clientset, pod *v1.Pod) (string, error) {
+	tailLines := int64(coreDNSLogTailLines)
+	logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{TailLines: &tailLines}).DoRaw(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("get logs of pod %s: %w", pod.Name, err)
+	}
+
+	return string(logs), nil
+}
+
+// GetCorefileForwardTargets returns the upstream nameservers of a forward plugin, the first argument being its zone
+func GetCorefileForwardTargets(plugin *CorefilePlugin) []string {
+	if plugin.Name != "forward" || len(plugin.Args) < 2 {
+		return []string{}
+	}
+	return plugin.Args[1:]
+}
+
+// getCoreDNSForwardTargets lists the upstream nameservers of the forward plugins. CoreDNS pods use the Default DNS
+// policy, so a resolv.conf target is the resolv.conf the kubelet gives them from the node, and its nameservers are
+// queried in its place
+func getCoreDNSForwardTargets(blocks []CorefileServerBlock, nodeResolvConf *utils.ResolvConf) []CoreDNSForwardTarget {
+	targets := []CoreDNSForwardTarget{}
+	for _, block := range blocks {
+		for i := range block.Plugins {
+			for _, target := range GetCorefileForwardTargets(&block.Plugins[i]) {
+				forwardTarget := CoreDNSForwardTarget{
+					Source: block.Source,
+					Zone:   block.Plugins[i].Args[0],
+					Target: target,
+				}
+
+				if !strings.HasPrefix(target, "/") || nodeResolvConf == nil {
+					targets = append(targets, forwardTarget)
+					continue
+				}
+
+				for _, nameserver := range nodeResolvConf.Effective().Nameservers {
+					forwardTarget.Target = nameserver
+					forwardTarget.ResolvConf = target
+					targets = append(targets, forwardTarget)
+				}
+			}
+		}
+	}
+
+	return targets
+}
+
+// probeCoreDNSForwardTargets queries every upstream nameserver of the forward plugins, from the pod network
+func probeCoreDNSForwardTargets(blocks []CorefileServerBlock, nodeResolvConf *utils.ResolvConf) []CoreDNSForwardTarget {
+	targets := getCoreDNSForwardTargets(blocks, nodeResolvConf)
+
+	probeGrp := new(sync.WaitGroup)
+	for i := range targets {
+		probeGrp.Add(1)
+		go func(target *CoreDNSForwardTarget) {
+			defer probeGrp.Done()
+
+			address, err := getCoreDNSForwardAddress(target.Target)
+			if err != nil {
+				target.Status = "Invalid"
+				target.Error = err.Error()
+				return
+			}
+			if address == "" {
+				target.Status = "Skipped"
+				return
+			}
+
+			query := "mcr.microsoft.com."
+			if zone := strings.TrimSuffix(target.Zone, "."); zone != "" {
+				query = zone + "."
+			}
+
+			attempt := queryDNS(query, address, "udp")
+			target.Status = attempt.Status
+			target.LatencyMs = attempt.LatencyMs
+			target.Error = attempt.Error
+		}(&targets[i])
+	}
+	probeGrp.Wait()
+
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].Source < targets[j].Source })
+
+	return targets
+}
+
+// getCoreDNSForwardAddress returns the host:port to query for a forward target, or an empty address for targets
+// which cannot be queried from periscope, such as unread resolv.conf files or DNS over TLS
+func getCoreDNSForwardAddress(target string) (string, error) {
+	if strings.HasPrefix(target, "/") || strings.HasPrefix(target, "tls://") {
+		return "", nil
+	}
+
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != "dns" {
+			return "", nil
+		}
+		target = u.Host
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = target, "53"
+	}
+
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("%s is not an IP address", host)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+func TestGetCoreDNSForwardTargets(t *testing.T) {
+	custom := map[string]string{
+		"corp.server": "corp.contoso.com:53 {\n    errors\n    forward . 10.1.0.4 tls://10.1.0.5\n}\n",
+	}
+
+	blocks, err := ParseCoreDNSConfigMaps(map[string]string{"Corefile": testCorefile}, custom)
+	if err != nil {
+		t.Fatalf("ParseCoreDNSConfigMaps() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		nodeResolvConf *utils.ResolvConf
+		want           []string
+	}{
+		{
+			name:           "node resolv.conf not read",
+			nodeResolvConf: nil,
+			want:           []string{"/etc/resolv.conf", "10.1.0.4", "tls://10.1.0.5"},
+		},
+		{
+			name:           "node resolv.conf",
+			nodeResolvConf: utils.ParseResolvConf("nameserver 168.63.129.16\n"),
+			want:           []string{"168.63.129.16", "10.1.0.4", "tls://10.1.0.5"},
+		},
+		{
+			name: "systemd-resolved stub",
+			nodeResolvConf: &utils.ResolvConf{
+				Nameservers:             []string{"127.0.0.53"},
+				SystemdResolvedUpstream: utils.ParseResolvConf("nameserver 10.2.0.4\nnameserver 10.2.0.5\n"),
+			},
+			want: []string{"10.2.0.4", "10.2.0.5", "10.1.0.4", "tls://10.1.0.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, target := range getCoreDNSForwardTargets(blocks, tt.nodeResolvConf) {
+				got = append(got, target.Target)
+				if target.ResolvConf != "" && target.ResolvConf != "/etc/resolv.conf" {
+					t.Errorf("getCoreDNSForwardTargets() resolv.conf = %v, want /etc/resolv.conf", target.ResolvConf)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getCoreDNSForwardTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CorefileServerBlock defines a server block of a Corefile
+type CorefileServerBlock struct {
+	Source  string           `json:"Source"`
+	Keys    []string         `json:"Keys"`
+	Plugins []CorefilePlugin `json:"Plugins"`
+}
+
+// CorefilePlugin defines a plugin directive of a server block, with the raw lines of its own block if any
+type CorefilePlugin struct {
+	Name  string   `json:"Name"`
+	Args  []string `json:"Args,omitempty"`
+	Block []string `json:"Block,omitempty"`
+}
+
+// HasPlugin returns true when the server block enables the named plugin
+func (block *CorefileServerBlock) HasPlugin(name string) bool {
+	for _, plugin := range block.Plugins {
+		if plugin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Zones returns the zones served by the server block, without scheme and port
+func (block *CorefileServerBlock) Zones() []string {
+	zones := []string{}
+	for _, key := range block.Keys {
+		zone := key
+		if i := strings.Index(zone, "://"); i >= 0 {
+			zone = zone[i+3:]
+		}
+		if i := strings.LastIndex(zone, ":"); i >= 0 {
+			zone = zone[:i]
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// ParseCoreDNSConfigMaps returns the server blocks of the coredns ConfigMap Corefile, followed by the server blocks of
+// the *.server keys of the coredns-custom ConfigMap; *.override keys are added to the plugins of the default block
+func ParseCoreDNSConfigMaps(coredns map[string]string, custom map[string]string) ([]CorefileServerBlock, error) {
+	blocks, err := ParseCorefile("coredns/Corefile", coredns["Corefile"])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for key := range custom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		source := "coredns-custom/" + key
+		switch {
+		case strings.HasSuffix(key, ".server"):
+			customBlocks, err := ParseCorefile(source, custom[key])
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, customBlocks...)
+		case strings.HasSuffix(key, ".override"):
+			// An override is a list of plugins, parse it as the body of a server block
+			overrideBlocks, err := ParseCorefile(source, ". {\n"+custom[key]+"\n}")
+			if err != nil {
+				return nil, err
+			}
+			for i := range blocks {
+				if blocks[i].Source == "coredns/Corefile" && isCorefileRootBlock(&blocks[i]) {
+					blocks[i].Plugins = append(blocks[i].Plugins, overrideBlocks[0].Plugins...)
+				}
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+func isCorefileRootBlock(block *CorefileServerBlock) bool {
+	for _, zone := range block.Zones() {
+		if zone == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCorefile parses the server blocks of a Corefile
+func ParseCorefile(source string, content string) ([]CorefileServerBlock, error) {
+	blocks := []CorefileServerBlock{}
+	keys := []string{}
+	depth := 0
+
+	var block *CorefileServerBlock
+	var plugin *CorefilePlugin
+
+	for number, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		tokens := tokenizeCorefileLine(line)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		switch depth {
+		case 0:
+			// Top level imports, such as the coredns-custom *.server snippets, are parsed separately
+			if tokens[0] == "import" && len(keys) == 0 {
+				continue
+			}
+
+			for _, token := range tokens {
+				switch token {
+				case "{":
+					if len(keys) == 0 {
+						return nil, fmt.Errorf("%s:%d: server block without keys", source, number+1)
+					}
+					blocks = append(blocks, CorefileServerBlock{Source: source, Keys: keys, Plugins: []CorefilePlugin{}})
+					block = &blocks[len(blocks)-1]
+					keys = []string{}
+					depth = 1
+				case "}":
+					return nil, fmt.Errorf("%s:%d: unexpected }", source, number+1)
+				default:
+					if depth != 0 {
+						return nil, fmt.Errorf("%s:%d: unexpected %s after {", source, number+1, token)
+					}
+					keys = append(keys, token)
+				}
+			}
+		case 1:
+			if tokens[0] == "}" {
+				if len(tokens) > 1 {
+					return nil, fmt.Errorf("%s:%d: unexpected %s after }", source, number+1, tokens[1])
+				}
+				depth = 0
+				continue
+			}
+
+			block.Plugins = append(block.Plugins, CorefilePlugin{Name: tokens[0]})
+			plugin = &block.Plugins[len(block.Plugins)-1]
+			lineTokens := []string{}
+			for _, token := range tokens[1:] {
+				switch {
+				case depth == 0:
+					return nil, fmt.Errorf("%s:%d: unexpected %s after }", source, number+1, token)
+				case token == "{":
+					depth++
+				case token == "}":
+					// Closes the block of the plugin, such as health { lameduck 5s }, or the server block
+					depth--
+				case depth > 1:
+					lineTokens = append(lineTokens, token)
+				default:
+					plugin.Args = append(plugin.Args, token)
+				}
+			}
+			if len(lineTokens) > 0 {
+				plugin.Block = append(plugin.Block, strings.Join(lineTokens, " "))
+			}
+		default:
+			lineTokens := []string{}
+			for _, token := range tokens {
+				switch token {
+				case "{":
+					depth++
+				case "}":
+					depth--
+				default:
+					lineTokens = append(lineTokens, token)
+				}
+			}
+			if len(lineTokens) > 0 {
+				plugin.Block = append(plugin.Block, strings.Join(lineTokens, " "))
+			}
+		}
+	}
+
+	if depth != 0 || len(keys) != 0 {
+		return nil, fmt.Errorf("%s: unterminated server block", source)
+	}
+
+	return blocks, nil
+}
+
+// tokenizeCorefileLine splits a line into tokens, with opening and closing braces as tokens of their own
+func tokenizeCorefileLine(line string) []string {
+	tokens := []string{}
+	for _, field := range strings.Fields(line) {
+		if field != "{" && strings.HasSuffix(field, "{") && !strings.HasPrefix(field, "{$") {
+			tokens = append(tokens, strings.TrimSuffix(field, "{"), "{")
+			continue
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
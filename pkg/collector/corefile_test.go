@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testCorefile = `.:53 {
+    errors
+    ready
+    health { lameduck 5s }
+    kubernetes cluster.local in-addr.arpa ip6.arpa {
+      pods insecure
+      fallthrough in-addr.arpa ip6.arpa
+    }
+    prometheus :9153
+    forward . /etc/resolv.conf # upstream nameservers of the node
+    cache 30
+    loop
+    reload
+    loadbalance
+    import custom/*.override
+}
+import custom/*.server
+`
+
+func TestParseCoreDNSConfigMaps(t *testing.T) {
+	custom := map[string]string{
+		"log.override":  "log",
+		"corp.server":   "corp.contoso.com:53 {\n    errors\n    forward . 10.1.0.4 10.1.0.5\n}\n",
+		"local.server":  "cluster.local{\n    forward . 10.1.0.4\n}",
+		"ignored.other": "anything",
+	}
+
+	blocks, err := ParseCoreDNSConfigMaps(map[string]string{"Corefile": testCorefile}, custom)
+	if err != nil {
+		t.Fatalf("ParseCoreDNSConfigMaps() error = %v", err)
+	}
+
+	if len(blocks) != 3 {
+		t.Fatalf("len(ParseCoreDNSConfigMaps()) = %v, want 3", len(blocks))
+	}
+
+	root := blocks[0]
+	if !reflect.DeepEqual(root.Zones(), []string{"."}) {
+		t.Errorf("Zones() = %v, want [.]", root.Zones())
+	}
+
+	names := []string{}
+	for _, plugin := range root.Plugins {
+		names = append(names, plugin.Name)
+	}
+	wantNames := []string{"errors", "ready", "health", "kubernetes", "prometheus", "forward", "cache", "loop", "reload", "loadbalance", "import", "log"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("plugins = %v, want %v", names, wantNames)
+	}
+
+	if health := root.Plugins[2]; len(health.Args) != 0 || !reflect.DeepEqual(health.Block, []string{"lameduck 5s"}) {
+		t.Errorf("health plugin = %+v", health)
+	}
+
+	kubernetes := root.Plugins[3]
+	if !reflect.DeepEqual(kubernetes.Args, []string{"cluster.local", "in-addr.arpa", "ip6.arpa"}) || len(kubernetes.Block) != 2 {
+		t.Errorf("kubernetes plugin = %+v", kubernetes)
+	}
+
+	if forward := root.Plugins[5]; !reflect.DeepEqual(forward.Args, []string{".", "/etc/resolv.conf"}) {
+		t.Errorf("forward plugin = %+v", forward)
+	}
+
+	if blocks[1].Source != "coredns-custom/corp.server" || !reflect.DeepEqual(blocks[1].Zones(), []string{"corp.contoso.com"}) {
+		t.Errorf("custom block = %+v", blocks[1])
+	}
+
+	if !reflect.DeepEqual(blocks[2].Zones(), []string{"cluster.local"}) || blocks[2].HasPlugin("cache") {
+		t.Errorf("custom block = %+v", blocks[2])
+	}
+}
+
+func TestParseCorefileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "unterminated block",
+			content: ".:53 {\n    errors\n",
+		},
+		{
+			name:    "plugin after the closing brace",
+			content: ".:53 {\n    errors } cache\n",
+		},
+		{
+			name:    "unexpected closing brace",
+			content: "}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCorefile("Corefile", tt.content); err == nil {
+				t.Errorf("ParseCorefile() error = nil, want an error")
+			}
+		})
+	}
+}
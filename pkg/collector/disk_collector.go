@@ -0,0 +1,319 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	defaultImageGCHighThresholdPercent = 85
+	defaultImageGCLowThresholdPercent  = 80
+	largestDirectoriesCount            = 10
+)
+
+// defaultEvictionHard mirrors the kubelet default hard eviction thresholds
+var defaultEvictionHard = map[string]string{
+	"memory.available":  "100Mi",
+	"nodefs.available":  "10%",
+	"nodefs.inodesFree": "5%",
+	"imagefs.available": "15%",
+}
+
+// FilesystemUsage defines the space and inode usage of a mounted filesystem
+type FilesystemUsage struct {
+	Filesystem        string `json:"filesystem"`
+	MountPoint        string `json:"mountPoint"`
+	SizeBytes         int64  `json:"sizeBytes"`
+	UsedBytes         int64  `json:"usedBytes"`
+	AvailableBytes    int64  `json:"availableBytes"`
+	UsedPercent       int    `json:"usedPercent"`
+	Inodes            int64  `json:"inodes"`
+	InodesUsed        int64  `json:"inodesUsed"`
+	InodesFree        int64  `json:"inodesFree"`
+	InodesUsedPercent int    `json:"inodesUsedPercent"`
+}
+
+// DirectoryUsage defines the disk usage of a directory
+type DirectoryUsage struct {
+	Path      string           `json:"path"`
+	SizeBytes int64            `json:"sizeBytes"`
+	Largest   []DirectoryUsage `json:"largest,omitempty"`
+}
+
+// DiskUsage defines the node disk usage together with the kubelet thresholds it is evaluated against
+type DiskUsage struct {
+	Filesystems                 []FilesystemUsage `json:"filesystems"`
+	Directories                 []DirectoryUsage  `json:"directories"`
+	NodeFSMountPoint            string            `json:"nodefsMountPoint"`
+	ImageFSMountPoint           string            `json:"imagefsMountPoint"`
+	ImageGCHighThresholdPercent int               `json:"imageGCHighThresholdPercent"`
+	ImageGCLowThresholdPercent  int               `json:"imageGCLowThresholdPercent"`
+	EvictionHard                map[string]string `json:"evictionHard"`
+	EvictionSoft                map[string]string `json:"evictionSoft,omitempty"`
+}
+
+// DiskCollector defines a Disk Collector struct
+type DiskCollector struct {
+	data map[string]string
+}
+
+// NewDiskCollector is a constructor
+func NewDiskCollector() *DiskCollector {
+	return &DiskCollector{
+		data: make(map[string]string),
+	}
+}
+
+func (collector *DiskCollector) GetName() string {
+	return "disk"
+}
+
+// Collect implements the interface method
+func (collector *DiskCollector) Collect() error {
+	commands := map[string][]string{
+		"df":        {"df", "-h"},
+		"df_inodes": {"df", "-i"},
+		"mounts":    {"cat", "/proc/self/mounts"},
+	}
+
+	for key, command := range commands {
+		output, err := utils.RunCommandOnHost(command[0], command[1:]...)
+		if err != nil {
+			output = fmt.Sprintf("Failed to run %s: %v", strings.Join(command, " "), err)
+			log.Print(output)
+		}
+		collector.data[key] = output
+	}
+
+	blocks, err := utils.RunCommandOnHost("df", "-P", "-B1")
+	if err != nil {
+		return fmt.Errorf("get filesystem usage: %w", err)
+	}
+
+	inodes, err := utils.RunCommandOnHost("df", "-P", "-i")
+	if err != nil {
+		return fmt.Errorf("get filesystem inode usage: %w", err)
+	}
+
+	usage := DiskUsage{
+		Filesystems: parseDf(blocks, inodes),
+		Directories: []DirectoryUsage{},
+	}
+
+	imageFSPath := ""
+	for _, path := range []string{"/var/lib/kubelet", "/var/lib/containerd", "/var/lib/docker", "/var/log"} {
+		if _, err := utils.RunCommandOnHost("test", "-d", path); err != nil {
+			continue
+		}
+
+		if imageFSPath == "" && (path == "/var/lib/containerd" || path == "/var/lib/docker") {
+			imageFSPath = path
+		}
+
+		// du exits with an error when files are removed during the walk, which is frequent under the kubelet and
+		// container runtime directories, its output is still valid then
+		output, err := utils.RunCommandOnHost("sh", "-c", `du -x -B1 -d 2 "$0" 2>/dev/null; true`, path)
+		if err != nil || output == "" {
+			log.Printf("Failed to get disk usage of %s: %v", path, err)
+			continue
+		}
+
+		usage.Directories = append(usage.Directories, parseDu(path, output, largestDirectoriesCount))
+	}
+
+	usage.NodeFSMountPoint = getMountPoint("/var/lib/kubelet")
+	if imageFSPath != "" {
+		usage.ImageFSMountPoint = getMountPoint(imageFSPath)
+	}
+
+	if err := setKubeletDiskThresholds(&usage); err != nil {
+		log.Printf("Failed to read kubelet disk thresholds, using kubelet defaults: %v", err)
+	}
+
+	dataBytes, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal disk usage: %w", err)
+	}
+
+	collector.data["usage"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *DiskCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// setKubeletDiskThresholds reads the image GC and eviction thresholds from the kubelet config file and flags
+func setKubeletDiskThresholds(usage *DiskUsage) error {
+	usage.ImageGCHighThresholdPercent = defaultImageGCHighThresholdPercent
+	usage.ImageGCLowThresholdPercent = defaultImageGCLowThresholdPercent
+	usage.EvictionHard = defaultEvictionHard
+
+	commandLine, err := utils.GetKubeletCommandLine()
+	if err != nil {
+		return err
+	}
+
+	flags := utils.ParseKubeletFlags(commandLine)
+
+	// Flags take precedence over the config file, as they do in kubelet
+	if path, ok := flags["config"]; ok {
+		config, err := utils.ReadKubeletConfigFile(path)
+		if err != nil {
+			log.Printf("Failed to read kubelet config file: %v", err)
+		} else {
+			applyKubeletConfigDiskThresholds(usage, config)
+		}
+	}
+
+	applyKubeletFlagDiskThresholds(usage, flags)
+
+	return nil
+}
+
+func applyKubeletConfigDiskThresholds(usage *DiskUsage, config map[string]interface{}) {
+	if value, ok := config["imageGCHighThresholdPercent"].(float64); ok {
+		usage.ImageGCHighThresholdPercent = int(value)
+	}
+
+	if value, ok := config["imageGCLowThresholdPercent"].(float64); ok {
+		usage.ImageGCLowThresholdPercent = int(value)
+	}
+
+	for key, thresholds := range map[string]*map[string]string{"evictionHard": &usage.EvictionHard, "evictionSoft": &usage.EvictionSoft} {
+		values, ok := config[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		*thresholds = map[string]string{}
+		for signal, value := range values {
+			(*thresholds)[signal] = fmt.Sprint(value)
+		}
+	}
+}
+
+func applyKubeletFlagDiskThresholds(usage *DiskUsage, flags map[string]string) {
+	if value, err := strconv.Atoi(flags["image-gc-high-threshold"]); err == nil {
+		usage.ImageGCHighThresholdPercent = value
+	}
+
+	if value, err := strconv.Atoi(flags["image-gc-low-threshold"]); err == nil {
+		usage.ImageGCLowThresholdPercent = value
+	}
+
+	if value, ok := flags["eviction-hard"]; ok {
+		usage.EvictionHard = utils.ParseEvictionThresholds(value)
+	}
+
+	if value, ok := flags["eviction-soft"]; ok {
+		usage.EvictionSoft = utils.ParseEvictionThresholds(value)
+	}
+}
+
+// getMountPoint returns the mount point of the filesystem holding path on host
+func getMountPoint(path string) string {
+	output, err := utils.RunCommandOnHost("df", "-P", path)
+	if err != nil {
+		return ""
+	}
+
+	rows := dfRows(output)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	return rows[len(rows)-1][5]
+}
+
+// parseDf joins the POSIX output of "df -B1" and "df -i" by mount point
+func parseDf(blocks string, inodes string) []FilesystemUsage {
+	filesystems := []FilesystemUsage{}
+	byMountPoint := map[string]int{}
+
+	for _, fields := range dfRows(blocks) {
+		usage := FilesystemUsage{
+			Filesystem: fields[0],
+			MountPoint: fields[5],
+		}
+		usage.SizeBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+		usage.UsedBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+		usage.AvailableBytes, _ = strconv.ParseInt(fields[3], 10, 64)
+		usage.UsedPercent, _ = strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+
+		byMountPoint[usage.MountPoint] = len(filesystems)
+		filesystems = append(filesystems, usage)
+	}
+
+	for _, fields := range dfRows(inodes) {
+		i, ok := byMountPoint[fields[5]]
+		if !ok {
+			continue
+		}
+
+		filesystems[i].Inodes, _ = strconv.ParseInt(fields[1], 10, 64)
+		filesystems[i].InodesUsed, _ = strconv.ParseInt(fields[2], 10, 64)
+		filesystems[i].InodesFree, _ = strconv.ParseInt(fields[3], 10, 64)
+		filesystems[i].InodesUsedPercent, _ = strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+	}
+
+	return filesystems
+}
+
+func dfRows(output string) [][]string {
+	rows := [][]string{}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		// Mount points may contain spaces
+		fields[5] = strings.Join(fields[5:], " ")
+		rows = append(rows, fields[:6])
+	}
+
+	return rows
+}
+
+// parseDu returns the total size of root and its largest sub directories from a "du -B1" output
+func parseDu(root string, output string, count int) DirectoryUsage {
+	usage := DirectoryUsage{Path: root, Largest: []DirectoryUsage{}}
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if parts[1] == root {
+			usage.SizeBytes = size
+			continue
+		}
+
+		usage.Largest = append(usage.Largest, DirectoryUsage{Path: parts[1], SizeBytes: size})
+	}
+
+	sort.Slice(usage.Largest, func(i, j int) bool {
+		return usage.Largest[i].SizeBytes > usage.Largest[j].SizeBytes
+	})
+
+	if len(usage.Largest) > count {
+		usage.Largest = usage.Largest[:count]
+	}
+
+	return usage
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDf(t *testing.T) {
+	blocks := `Filesystem        1-blocks        Used   Available Capacity Mounted on
+/dev/sda1      133003395072 40057802752 92929015808      31% /
+tmpfs            4127240192           0  4127240192       0% /dev/shm
+`
+	inodes := `Filesystem       Inodes  IUsed    IFree IUse% Mounted on
+/dev/sda1      16515072 600000 15915072    4% /
+tmpfs           1007627      1  1007626    1% /dev/shm
+`
+
+	want := []FilesystemUsage{
+		{
+			Filesystem:        "/dev/sda1",
+			MountPoint:        "/",
+			SizeBytes:         133003395072,
+			UsedBytes:         40057802752,
+			AvailableBytes:    92929015808,
+			UsedPercent:       31,
+			Inodes:            16515072,
+			InodesUsed:        600000,
+			InodesFree:        15915072,
+			InodesUsedPercent: 4,
+		},
+		{
+			Filesystem:        "tmpfs",
+			MountPoint:        "/dev/shm",
+			SizeBytes:         4127240192,
+			AvailableBytes:    4127240192,
+			Inodes:            1007627,
+			InodesUsed:        1,
+			InodesFree:        1007626,
+			InodesUsedPercent: 1,
+		},
+	}
+
+	got := parseDf(blocks, inodes)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDf() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseDu(t *testing.T) {
+	output := "100\t/var/log/azure/a\n300\t/var/log/journal\n200\t/var/log/pods\n700\t/var/log\n"
+
+	want := DirectoryUsage{
+		Path:      "/var/log",
+		SizeBytes: 700,
+		Largest: []DirectoryUsage{
+			{Path: "/var/log/journal", SizeBytes: 300},
+			{Path: "/var/log/pods", SizeBytes: 200},
+		},
+	}
+
+	got := parseDu("/var/log", output, 2)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDu() = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyKubeletDiskThresholds(t *testing.T) {
+	usage := DiskUsage{
+		ImageGCHighThresholdPercent: defaultImageGCHighThresholdPercent,
+		ImageGCLowThresholdPercent:  defaultImageGCLowThresholdPercent,
+		EvictionHard:                defaultEvictionHard,
+	}
+
+	applyKubeletConfigDiskThresholds(&usage, map[string]interface{}{
+		"imageGCHighThresholdPercent": float64(90),
+		"evictionHard": map[string]interface{}{
+			"nodefs.available": "5%",
+		},
+	})
+	applyKubeletFlagDiskThresholds(&usage, map[string]string{
+		"image-gc-low-threshold": "70",
+		"eviction-soft":          "memory.available<500Mi",
+	})
+
+	want := DiskUsage{
+		ImageGCHighThresholdPercent: 90,
+		ImageGCLowThresholdPercent:  70,
+		EvictionHard:                map[string]string{"nodefs.available": "5%"},
+		EvictionSoft:                map[string]string{"memory.available": "500Mi"},
+	}
+
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("thresholds = %+v, want %+v", usage, want)
+	}
+}
@@ -1,6 +1,9 @@
 package collector
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/Azure/aks-periscope/pkg/utils"
 )
 
@@ -22,20 +25,40 @@ func (collector *DNSCollector) GetName() string {
 
 // Collect implements the interface method
 func (collector *DNSCollector) Collect() error {
-	output, err := utils.ReadFileContent("/etchostlogs/resolv.conf")
+	resolvConfs := map[string]*utils.ResolvConf{}
+
+	output, err := utils.ReadFileContent(utils.HostResolvConfFile)
 	if err != nil {
 		output = err.Error()
 	}
 
 	collector.data["virtualmachine"] = output
 
-	output, err = utils.ReadFileContent("/etc/resolv.conf")
+	output, err = utils.ReadFileContent(utils.SystemdResolvedResolvConfFile)
+	if err == nil {
+		collector.data["systemd-resolved"] = output
+	}
+
+	if resolvConf, err := utils.ReadNodeResolvConf(); err == nil {
+		resolvConfs["virtualmachine"] = resolvConf.Effective()
+	}
+
+	output, err = utils.ReadFileContent(utils.ContainerResolvConfFile)
 	if err != nil {
 		output = err.Error()
+	} else {
+		resolvConfs["kubernetes"] = utils.ParseResolvConf(output)
 	}
 
 	collector.data["kubernetes"] = output
 
+	dataBytes, err := json.Marshal(resolveDNSNames(getDNSNames(), resolvConfs))
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+
+	collector.data["resolution"] = string(dataBytes)
+
 	return nil
 }
 
@@ -0,0 +1,324 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsQueryTimeout = 5 * time.Second
+	// dnsUDPMaxSize is the maximum size of a DNS message over UDP without EDNS0
+	dnsUDPMaxSize = 512
+)
+
+// defaultDNSNames lists the names resolved when none are configured, the API server FQDN is always added
+var defaultDNSNames = []string{
+	"kubernetes.default.svc",
+	"mcr.microsoft.com",
+}
+
+// DNSQueryAttempt defines the result of one query sent while resolving a name
+type DNSQueryAttempt struct {
+	Query     string   `json:"Query"`
+	Status    string   `json:"Status"`
+	Truncated bool     `json:"Truncated,omitempty"`
+	Answers   []string `json:"Answers,omitempty"`
+	LatencyMs float64  `json:"LatencyMs"`
+	Error     string   `json:"Error,omitempty"`
+}
+
+// DNSResolution defines the result of resolving a name against a single nameserver over a single protocol
+type DNSResolution struct {
+	Name       string            `json:"Name"`
+	ResolvConf string            `json:"ResolvConf"`
+	Nameserver string            `json:"Nameserver"`
+	Protocol   string            `json:"Protocol"`
+	Status     string            `json:"Status"`
+	Query      string            `json:"Query,omitempty"`
+	Answers    []string          `json:"Answers,omitempty"`
+	Truncated  bool              `json:"Truncated,omitempty"`
+	LatencyMs  float64           `json:"LatencyMs"`
+	Attempts   []DNSQueryAttempt `json:"Attempts"`
+}
+
+// getDNSNames returns the names configured in DIAGNOSTIC_DNS_NAMES, or the default ones, along with the API server FQDN
+func getDNSNames() []string {
+	names := strings.Fields(os.Getenv("DIAGNOSTIC_DNS_NAMES"))
+	if len(names) == 0 {
+		names = defaultDNSNames
+	}
+
+	if fqdn, err := getAPIServerFQDN(); err == nil && net.ParseIP(fqdn) == nil {
+		names = append(names, fqdn)
+	}
+
+	return names
+}
+
+// isClusterLocalDNSName returns true for names only the cluster DNS is expected to resolve
+func isClusterLocalDNSName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	return strings.HasSuffix(name, ".svc") || strings.HasSuffix(name, ".cluster.local")
+}
+
+// resolveDNSNames resolves each name against every nameserver of each resolv.conf, individually over UDP and TCP
+func resolveDNSNames(names []string, resolvConfs map[string]*utils.ResolvConf) []DNSResolution {
+	resolutions := []DNSResolution{}
+	resolutionsLock := new(sync.Mutex)
+	resolveGrp := new(sync.WaitGroup)
+
+	for source, resolvConf := range resolvConfs {
+		for _, name := range names {
+			if source != "kubernetes" && isClusterLocalDNSName(name) {
+				continue
+			}
+
+			for _, nameserver := range resolvConf.Nameservers {
+				for _, protocol := range []string{"udp", "tcp"} {
+					resolveGrp.Add(1)
+					go func(source string, resolvConf *utils.ResolvConf, name string, nameserver string, protocol string) {
+						defer resolveGrp.Done()
+
+						resolution := resolveDNSName(name, resolvConf, nameserver, protocol)
+						resolution.ResolvConf = source
+
+						resolutionsLock.Lock()
+						resolutions = append(resolutions, resolution)
+						resolutionsLock.Unlock()
+					}(source, resolvConf, name, nameserver, protocol)
+				}
+			}
+		}
+	}
+	resolveGrp.Wait()
+
+	return resolutions
+}
+
+// resolveDNSName resolves name against a single nameserver the way the stub resolver would, honoring search and ndots
+func resolveDNSName(name string, resolvConf *utils.ResolvConf, nameserver string, protocol string) DNSResolution {
+	resolution := DNSResolution{
+		Name:       name,
+		Nameserver: nameserver,
+		Protocol:   protocol,
+		Attempts:   []DNSQueryAttempt{},
+	}
+
+	if ip := net.ParseIP(nameserver); ip != nil && ip.IsLoopback() {
+		resolution.Status = "Skipped"
+		resolution.Attempts = append(resolution.Attempts, DNSQueryAttempt{Status: "Skipped", Error: "loopback nameserver is not reachable from the pod network"})
+		return resolution
+	}
+
+	address := nameserver
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		address = net.JoinHostPort(nameserver, "53")
+	}
+
+	for _, query := range getDNSSearchQueries(name, resolvConf.Search, resolvConf.Ndots) {
+		attempt := queryDNS(query, address, protocol)
+		resolution.Attempts = append(resolution.Attempts, attempt)
+		resolution.LatencyMs += attempt.LatencyMs
+		resolution.Status = attempt.Status
+		resolution.Query = attempt.Query
+		resolution.Answers = attempt.Answers
+		resolution.Truncated = resolution.Truncated || attempt.Truncated
+
+		// Like the stub resolver, move to the next candidate only when the name does not exist or has no address
+		noData := attempt.Status == "NOERROR" && len(attempt.Answers) == 0 && !attempt.Truncated
+		if attempt.Status != "NXDOMAIN" && !noData {
+			break
+		}
+	}
+
+	return resolution
+}
+
+// getDNSSearchQueries returns the fully qualified queries for name in the order the stub resolver sends them
+func getDNSSearchQueries(name string, search []string, ndots int) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+
+	queries := []string{}
+	dots := strings.Count(name, ".")
+	if dots >= ndots {
+		queries = append(queries, name+".")
+	}
+	for _, domain := range search {
+		queries = append(queries, name+"."+strings.TrimSuffix(domain, ".")+".")
+	}
+	if dots < ndots {
+		queries = append(queries, name+".")
+	}
+
+	return queries
+}
+
+// queryDNS sends an A query for the fully qualified query name to address over protocol
+func queryDNS(query string, address string, protocol string) DNSQueryAttempt {
+	attempt := DNSQueryAttempt{Query: query}
+
+	start := time.Now()
+	response, err := exchangeDNS(query, address, protocol)
+	attempt.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		attempt.Status = "Error"
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			attempt.Status = "Timeout"
+		}
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	if err := parseDNSResponse(response, &attempt); err != nil {
+		attempt.Status = "Error"
+		attempt.Error = err.Error()
+	}
+
+	return attempt
+}
+
+func exchangeDNS(query string, address string, protocol string) ([]byte, error) {
+	name, err := dnsmessage.NewName(query)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uint16(rand.Uint32())
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	request, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout(protocol, address, dnsQueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(dnsQueryTimeout)); err != nil {
+		return nil, err
+	}
+
+	var response []byte
+	if protocol == "tcp" {
+		// Messages over TCP are prefixed with their length
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(request)))
+		if _, err := conn.Write(append(length, request...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		response = make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		response = make([]byte, dnsUDPMaxSize)
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		response = response[:n]
+	}
+
+	if len(response) < 2 || binary.BigEndian.Uint16(response) != id {
+		return nil, fmt.Errorf("response id does not match the query")
+	}
+
+	return response, nil
+}
+
+func parseDNSResponse(response []byte, attempt *DNSQueryAttempt) error {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response)
+	if err != nil {
+		return err
+	}
+
+	attempt.Status = getDNSRCodeName(header.RCode)
+	attempt.Truncated = header.Truncated
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return err
+	}
+
+	for {
+		answerHeader, err := parser.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			// A truncated response may end in the middle of the answer section
+			if header.Truncated {
+				return nil
+			}
+			return err
+		}
+
+		switch answerHeader.Type {
+		case dnsmessage.TypeA:
+			resource, err := parser.AResource()
+			if err != nil {
+				return err
+			}
+			attempt.Answers = append(attempt.Answers, net.IP(resource.A[:]).String())
+		case dnsmessage.TypeCNAME:
+			resource, err := parser.CNAMEResource()
+			if err != nil {
+				return err
+			}
+			attempt.Answers = append(attempt.Answers, "CNAME "+resource.CNAME.String())
+		default:
+			if err := parser.SkipAnswer(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func getDNSRCodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE%d", rcode)
+	}
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestGetDNSSearchQueries(t *testing.T) {
+	search := []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}
+
+	tests := []struct {
+		name  string
+		query string
+		ndots int
+		want  []string
+	}{
+		{
+			name:  "fewer dots than ndots",
+			query: "kubernetes.default.svc",
+			ndots: 5,
+			want: []string{
+				"kubernetes.default.svc.default.svc.cluster.local.",
+				"kubernetes.default.svc.svc.cluster.local.",
+				"kubernetes.default.svc.cluster.local.",
+				"kubernetes.default.svc.",
+			},
+		},
+		{
+			name:  "at least ndots dots",
+			query: "mcr.microsoft.com",
+			ndots: 1,
+			want: []string{
+				"mcr.microsoft.com.",
+				"mcr.microsoft.com.default.svc.cluster.local.",
+				"mcr.microsoft.com.svc.cluster.local.",
+				"mcr.microsoft.com.cluster.local.",
+			},
+		},
+		{
+			name:  "fully qualified",
+			query: "mcr.microsoft.com.",
+			ndots: 5,
+			want:  []string{"mcr.microsoft.com."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getDNSSearchQueries(tt.query, search, tt.ndots); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDNSSearchQueries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// answerTestDNSQuery answers kubernetes.default.svc.cluster.local, fails servfail.example, truncates big.example
+// over UDP and answers NXDOMAIN to any other query
+func answerTestDNSQuery(t *testing.T, request []byte, tcp bool) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(request)
+	if err != nil {
+		t.Errorf("parse query: %v", err)
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		t.Errorf("parse question: %v", err)
+		return nil
+	}
+
+	header.Response = true
+	answers := []dnsmessage.AResource{}
+	switch question.Name.String() {
+	case "kubernetes.default.svc.cluster.local.":
+		answers = append(answers, dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	case "servfail.example.":
+		header.RCode = dnsmessage.RCodeServerFailure
+	case "big.example.":
+		if tcp {
+			for i := 0; i < 64; i++ {
+				answers = append(answers, dnsmessage.AResource{A: [4]byte{10, 1, 0, byte(i)}})
+			}
+		} else {
+			header.Truncated = true
+		}
+	default:
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	builder := dnsmessage.NewBuilder(nil, header)
+	builder.StartQuestions()
+	builder.Question(question)
+	builder.StartAnswers()
+	for _, answer := range answers {
+		builder.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 30}, answer)
+	}
+	response, err := builder.Finish()
+	if err != nil {
+		t.Errorf("build response: %v", err)
+	}
+
+	return response
+}
+
+// newTestDNSServer serves answerTestDNSQuery over UDP and TCP on the same local port
+func newTestDNSServer(t *testing.T) (string, func()) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		packetConn.Close()
+		t.Skipf("Listen on the UDP port: %v", err)
+	}
+
+	go func() {
+		buffer := make([]byte, dnsUDPMaxSize)
+		for {
+			n, addr, err := packetConn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			packetConn.WriteTo(answerTestDNSQuery(t, buffer[:n], false), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			length := make([]byte, 2)
+			if _, err := io.ReadFull(conn, length); err == nil {
+				request := make([]byte, binary.BigEndian.Uint16(length))
+				if _, err := io.ReadFull(conn, request); err == nil {
+					response := answerTestDNSQuery(t, request, true)
+					binary.BigEndian.PutUint16(length, uint16(len(response)))
+					conn.Write(append(length, response...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return packetConn.LocalAddr().String(), func() {
+		packetConn.Close()
+		listener.Close()
+	}
+}
+
+func TestResolveDNSName(t *testing.T) {
+	address, stop := newTestDNSServer(t)
+	defer stop()
+
+	resolvConf := utils.ParseResolvConf("nameserver 10.0.0.10\nsearch default.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n")
+
+	tests := []struct {
+		name          string
+		query         string
+		protocol      string
+		wantStatus    string
+		wantAttempts  int
+		wantAnswers   int
+		wantTruncated bool
+	}{
+		{
+			name:         "search domains",
+			query:        "kubernetes.default.svc",
+			protocol:     "udp",
+			wantStatus:   "NOERROR",
+			wantAttempts: 3,
+			wantAnswers:  1,
+		},
+		{
+			name:         "server failure stops the search",
+			query:        "servfail.example.",
+			protocol:     "udp",
+			wantStatus:   "SERVFAIL",
+			wantAttempts: 1,
+		},
+		{
+			name:          "truncated over udp",
+			query:         "big.example.",
+			protocol:      "udp",
+			wantStatus:    "NOERROR",
+			wantAttempts:  1,
+			wantTruncated: true,
+		},
+		{
+			name:         "complete over tcp",
+			query:        "big.example.",
+			protocol:     "tcp",
+			wantStatus:   "NOERROR",
+			wantAttempts: 1,
+			wantAnswers:  64,
+		},
+		{
+			name:         "name does not exist",
+			query:        "missing",
+			protocol:     "tcp",
+			wantStatus:   "NXDOMAIN",
+			wantAttempts: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveDNSName(tt.query, resolvConf, address, tt.protocol)
+			if got.Status != tt.wantStatus || len(got.Attempts) != tt.wantAttempts || len(got.Answers) != tt.wantAnswers || got.Truncated != tt.wantTruncated {
+				t.Errorf("resolveDNSName() = %+v, want status %v, %v attempts, %v answers, truncated %v", got, tt.wantStatus, tt.wantAttempts, tt.wantAnswers, tt.wantTruncated)
+			}
+		})
+	}
+}
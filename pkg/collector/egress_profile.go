@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// NetworkOutboundEgressProfileKey is the data key holding the egress profile results of NetworkOutboundCollector
+	NetworkOutboundEgressProfileKey = "egressprofile"
+
+	defaultEgressProfileName = "aks-required-egress"
+	kubeletKubeconfigFile    = "/var/lib/kubelet/kubeconfig"
+
+	apiServerFQDNPlaceholder = "{apiServerFQDN}"
+	locationPlaceholder      = "{location}"
+)
+
+// EgressRule defines an outbound endpoint nodes must be able to reach
+type EgressRule struct {
+	FQDN     string `json:"FQDN"`
+	Port     int    `json:"Port"`
+	Protocol string `json:"Protocol"`
+	Purpose  string `json:"Purpose"`
+}
+
+// EgressProfile defines a versioned list of required egress rules
+type EgressProfile struct {
+	Name    string       `json:"Name"`
+	Version string       `json:"Version"`
+	Rules   []EgressRule `json:"Rules"`
+}
+
+// EgressRuleResult defines the result of checking an egress rule from the node and from the pod network
+type EgressRuleResult struct {
+	EgressRule
+	Endpoint  string                 `json:"Endpoint"`
+	FromNode  string                 `json:"FromNode"`
+	FromPod   string                 `json:"FromPod"`
+	PodStages []NetworkOutboundStage `json:"PodStages,omitempty"`
+}
+
+// EgressProfileResult defines the results of checking every rule of an egress profile
+type EgressProfileResult struct {
+	Profile string             `json:"Profile"`
+	Version string             `json:"Version"`
+	Rules   []EgressRuleResult `json:"Rules"`
+}
+
+// egressProfiles lists the built-in egress profiles by name
+var egressProfiles = map[string]EgressProfile{
+	defaultEgressProfileName: {
+		Name: defaultEgressProfileName,
+		// Azure global required network rules and FQDN/application rules for AKS
+		// https://docs.microsoft.com/en-us/azure/aks/limit-egress-traffic
+		Version: "2021-10-01",
+		Rules: []EgressRule{
+			{FQDN: apiServerFQDNPlaceholder, Port: 443, Protocol: "TCP", Purpose: "Communication between the nodes and the API server"},
+			{FQDN: "mcr.microsoft.com", Port: 443, Protocol: "TCP", Purpose: "Microsoft Container Registry images"},
+			{FQDN: locationPlaceholder + ".data.mcr.microsoft.com", Port: 443, Protocol: "TCP", Purpose: "Microsoft Container Registry storage backed by the Azure CDN (*.data.mcr.microsoft.com)"},
+			{FQDN: "management.azure.com", Port: 443, Protocol: "TCP", Purpose: "Kubernetes operations against the Azure API"},
+			{FQDN: "login.microsoftonline.com", Port: 443, Protocol: "TCP", Purpose: "Azure Active Directory authentication"},
+			{FQDN: "packages.microsoft.com", Port: 443, Protocol: "TCP", Purpose: "Cached apt-get operations such as Moby, PowerShell and Azure CLI"},
+			{FQDN: "acs-mirror.azureedge.net", Port: 443, Protocol: "TCP", Purpose: "Binaries such as kubenet and Azure CNI"},
+			{FQDN: "ntp.ubuntu.com", Port: 123, Protocol: "UDP", Purpose: "Network time synchronization for Linux nodes"},
+		},
+	},
+}
+
+// getEgressProfile returns the built-in profile with the given name; "none" disables the profile checks
+func getEgressProfile(name string) (*EgressProfile, error) {
+	if name == "" {
+		name = defaultEgressProfileName
+	}
+
+	if strings.EqualFold(name, "none") {
+		return nil, nil
+	}
+
+	profile, ok := egressProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown egress profile %s", name)
+	}
+
+	return &profile, nil
+}
+
+// checkEgressProfile checks every rule of the profile from the node and from the pod network namespace
+func checkEgressProfile(profile *EgressProfile, proxyConfig *utils.ProxyConfig) *EgressProfileResult {
+	placeholders := map[string]string{}
+	if fqdn, err := getAPIServerFQDN(); err == nil {
+		placeholders[apiServerFQDNPlaceholder] = fqdn
+	}
+	if location, err := getAzureLocation(); err == nil {
+		placeholders[locationPlaceholder] = location
+	}
+
+	result := &EgressProfileResult{
+		Profile: profile.Name,
+		Version: profile.Version,
+		Rules:   make([]EgressRuleResult, len(profile.Rules)),
+	}
+
+	checkGrp := new(sync.WaitGroup)
+	for i, rule := range profile.Rules {
+		checkGrp.Add(1)
+		go func(i int, rule EgressRule) {
+			defer checkGrp.Done()
+			result.Rules[i] = checkEgressRule(rule, placeholders, proxyConfig)
+		}(i, rule)
+	}
+	checkGrp.Wait()
+
+	return result
+}
+
+func checkEgressRule(rule EgressRule, placeholders map[string]string, proxyConfig *utils.ProxyConfig) EgressRuleResult {
+	result := EgressRuleResult{EgressRule: rule}
+
+	host := rule.FQDN
+	for placeholder, value := range placeholders {
+		host = strings.Replace(host, placeholder, value, -1)
+	}
+
+	if strings.Contains(host, "{") {
+		result.FromNode = "Skipped: cannot resolve " + host
+		result.FromPod = result.FromNode
+		return result
+	}
+
+	port := strconv.Itoa(rule.Port)
+	result.Endpoint = net.JoinHostPort(host, port)
+
+	if rule.Protocol == "UDP" {
+		// The NTP request is sent from the node by bash, which waits for the 48 bytes of the response
+		if _, err := utils.RunCommandOnHost("timeout", "5", "bash", "-c", `exec 3<>"/dev/udp/$0/$1" && printf '\x1b%47s' '' | tr ' ' '\000' >&3 && head -c 48 <&3 >/dev/null`, host, port); err != nil {
+			result.FromNode = "Error: " + err.Error()
+		} else {
+			result.FromNode = "Connected"
+		}
+		if err := probeNTP(result.Endpoint); err != nil {
+			result.FromPod = "Error: " + err.Error()
+		} else {
+			result.FromPod = "Connected"
+		}
+		return result
+	}
+
+	probe := &networkOutboundProbe{host: host, port: port, tls: rule.Port == 443}
+	probe.setProxy(proxyConfig)
+
+	// The host name and port are passed as positional parameters so they are never interpreted by the shell
+	if proxyURL, err := probe.getProxyURL(); err == nil && proxyURL != nil {
+		result.FromNode = "Skipped: reached through proxy " + proxyURL.Host + ", checked from the pod network"
+	} else if _, err := utils.RunCommandOnHost("timeout", "5", "bash", "-c", `exec 3<>"/dev/tcp/$0/$1"`, host, port); err != nil {
+		result.FromNode = "Error: " + err.Error()
+	} else {
+		result.FromNode = "Connected"
+	}
+
+	stages, failedStage, err := probe.run()
+	result.PodStages = stages
+	if err != nil {
+		result.FromPod = "Error: " + failedStage + ": " + err.Error()
+	} else {
+		result.FromPod = "Connected"
+	}
+
+	return result
+}
+
+// getAPIServerFQDN returns the API server host name the kubelet connects to
+func getAPIServerFQDN() (string, error) {
+	metadata, err := readKubeconfigMetadata(kubeletKubeconfigFile)
+	if err != nil {
+		return "", err
+	}
+
+	for _, cluster := range metadata.Clusters {
+		u, err := url.Parse(cluster.Server)
+		if err == nil && u.Hostname() != "" {
+			return u.Hostname(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no API server found in %s", kubeletKubeconfigFile)
+}
+
+// getAzureLocation returns the Azure region of the node from the cloud provider configuration
+func getAzureLocation() (string, error) {
+	content, err := utils.RunCommandOnHost("cat", "/etc/kubernetes/azure.json")
+	if err != nil {
+		return "", err
+	}
+
+	var azure utils.Azure
+	if err := json.Unmarshal([]byte(content), &azure); err != nil {
+		return "", fmt.Errorf("unmarshal azure.json: %w", err)
+	}
+
+	if azure.Location == "" {
+		return "", fmt.Errorf("no location found in azure.json")
+	}
+
+	return azure.Location, nil
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+func TestGetEgressProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "default profile",
+			profile:  "",
+			wantName: defaultEgressProfileName,
+		},
+		{
+			name:     "disabled",
+			profile:  "none",
+			wantName: "",
+		},
+		{
+			name:    "unknown profile",
+			profile: "aks-egress-v0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getEgressProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getEgressProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			gotName := ""
+			if got != nil {
+				gotName = got.Name
+			}
+			if gotName != tt.wantName {
+				t.Errorf("getEgressProfile() = %v, want %v", gotName, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestCheckEgressRuleUnresolvedPlaceholder(t *testing.T) {
+	rule := EgressRule{FQDN: locationPlaceholder + ".data.mcr.microsoft.com", Port: 443, Protocol: "TCP"}
+
+	got := checkEgressRule(rule, map[string]string{apiServerFQDNPlaceholder: "myaks.hcp.eastus.azmk8s.io"}, &utils.ProxyConfig{})
+	if !strings.HasPrefix(got.FromNode, "Skipped") || !strings.HasPrefix(got.FromPod, "Skipped") {
+		t.Errorf("checkEgressRule() = %+v, want both checks skipped", got)
+	}
+	if got.Endpoint != "" {
+		t.Errorf("checkEgressRule() endpoint = %v, want empty", got.Endpoint)
+	}
+}
@@ -0,0 +1,399 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/interfaces"
+	"github.com/Azure/aks-periscope/pkg/utils"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultEventsWatchInterval = time.Minute
+	// maxEventObjects defines the number of events kept in memory by the watch, the oldest being forgotten first
+	maxEventObjects = 10000
+)
+
+// EventRecord defines the occurrences of an event, deduplicated across the Event objects reporting it
+type EventRecord struct {
+	Namespace           string    `json:"Namespace"`
+	Type                string    `json:"Type"`
+	Reason              string    `json:"Reason"`
+	Object              string    `json:"Object"`
+	ReportingController string    `json:"ReportingController,omitempty"`
+	Note                string    `json:"Note"`
+	Count               int32     `json:"Count"`
+	FirstTimestamp      time.Time `json:"FirstTimestamp"`
+	LastTimestamp       time.Time `json:"LastTimestamp"`
+}
+
+// EventsCollector defines an Events Collector struct
+type EventsCollector struct {
+	kubeconfig *restclient.Config
+
+	mutex    sync.Mutex
+	events   map[types.UID]EventRecord
+	exported map[string]EventRecord
+	data     map[string]string
+}
+
+// NewEventsCollector is a constructor
+func NewEventsCollector(config *restclient.Config) *EventsCollector {
+	return &EventsCollector{
+		kubeconfig: config,
+		events:     make(map[types.UID]EventRecord),
+		exported:   make(map[string]EventRecord),
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *EventsCollector) GetName() string {
+	return "events"
+}
+
+// Collect implements the interface method
+func (collector *EventsCollector) Collect() error {
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	if !isEventsInstance(clientset) {
+		return nil
+	}
+
+	for _, namespace := range getEventsNamespaces() {
+		events, err := clientset.EventsV1().Events(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("list events: %w", err)
+		}
+
+		collector.mutex.Lock()
+		for i := range events.Items {
+			collector.events[events.Items[i].UID] = newEventRecord(&events.Items[i])
+		}
+		collector.mutex.Unlock()
+	}
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	records := dedupeEventRecords(collector.events)
+	for _, record := range records {
+		collector.exported[record.key()] = record
+	}
+
+	data, err := formatEventRecords(records, true)
+	if err != nil {
+		return err
+	}
+	collector.data = data
+
+	return nil
+}
+
+func (collector *EventsCollector) GetData() map[string]string {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	return collector.data
+}
+
+// Watch keeps watching events when DIAGNOSTIC_EVENTS_WATCH is enabled, and periodically exports the events which
+// occurred since the previous export, so events are kept after the API server deletes them
+func (collector *EventsCollector) Watch(exporter interfaces.Exporter) error {
+	if enabled, _ := strconv.ParseBool(os.Getenv("DIAGNOSTIC_EVENTS_WATCH")); !enabled {
+		return nil
+	}
+
+	interval, err := getDurationFromEnv("DIAGNOSTIC_EVENTS_WATCH_INTERVAL", defaultEventsWatchInterval)
+	if err != nil {
+		return err
+	}
+
+	if interval == 0 {
+		return fmt.Errorf("DIAGNOSTIC_EVENTS_WATCH_INTERVAL must be positive")
+	}
+
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	if !isEventsInstance(clientset) {
+		return nil
+	}
+
+	onEvent := func(obj interface{}) {
+		event, ok := obj.(*eventsv1.Event)
+		if !ok {
+			return
+		}
+
+		collector.mutex.Lock()
+		defer collector.mutex.Unlock()
+		collector.events[event.UID] = newEventRecord(event)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	for _, namespace := range getEventsNamespaces() {
+		factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+		// Deleted events are deliberately kept
+		factory.Events().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    onEvent,
+			UpdateFunc: func(oldObj, newObj interface{}) { onEvent(newObj) },
+		})
+		factory.Start(stopCh)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		data, err := collector.getWatchedData()
+		if err != nil {
+			log.Printf("Format watched events failed: %v", err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+
+		if err := exporter.Export(&eventsUpdate{data: data}); err != nil {
+			log.Printf("Export watched events failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// getWatchedData returns the records which are new or occurred again since the previous export, formatted to be
+// appended to the exported files, or nil when there are none
+func (collector *EventsCollector) getWatchedData() (map[string]string, error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	forgetOldestEvents(collector.events, maxEventObjects)
+
+	updated := []EventRecord{}
+	kept := map[string]bool{}
+	for _, record := range dedupeEventRecords(collector.events) {
+		kept[record.key()] = true
+		exported, ok := collector.exported[record.key()]
+		if ok && exported.Count == record.Count && exported.LastTimestamp.Equal(record.LastTimestamp) {
+			continue
+		}
+		collector.exported[record.key()] = record
+		updated = append(updated, record)
+	}
+
+	// The records of forgotten events are forgotten as well, so the exported records stay bounded by the watched ones
+	for key := range collector.exported {
+		if !kept[key] {
+			delete(collector.exported, key)
+		}
+	}
+
+	if len(updated) == 0 {
+		return nil, nil
+	}
+
+	return formatEventRecords(updated, false)
+}
+
+// eventsUpdate defines the events exported by the watch, appended to the files of the events collector
+type eventsUpdate struct {
+	data map[string]string
+}
+
+func (update *eventsUpdate) GetName() string {
+	return "events"
+}
+
+func (update *eventsUpdate) GetData() map[string]string {
+	return update.data
+}
+
+// isEventsInstance tells whether this pod collects the events, which are cluster-wide so a single pod of the
+// DaemonSet collects them. The events are collected anyway when the pods of the DaemonSet cannot be listed
+func isEventsInstance(clientset kubernetes.Interface) bool {
+	clusterScope, err := utils.IsClusterScopeInstance(clientset)
+	if err != nil {
+		log.Printf("Check cluster scope instance failed, events are collected: %v", err)
+		return true
+	}
+
+	return clusterScope
+}
+
+// getEventsNamespaces returns the namespaces of DIAGNOSTIC_EVENTS_LIST, all namespaces when it is empty or *
+func getEventsNamespaces() []string {
+	namespaces := strings.Fields(os.Getenv("DIAGNOSTIC_EVENTS_LIST"))
+	for _, namespace := range namespaces {
+		if namespace == "*" {
+			return []string{metav1.NamespaceAll}
+		}
+	}
+
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+
+	return namespaces
+}
+
+// newEventRecord returns the occurrences of an event, falling back to the fields of the core/v1 API for the events
+// reported through it
+func newEventRecord(event *eventsv1.Event) EventRecord {
+	record := EventRecord{
+		Namespace:           event.Namespace,
+		Type:                event.Type,
+		Reason:              event.Reason,
+		Object:              strings.ToLower(event.Regarding.Kind) + "/" + event.Regarding.Name,
+		ReportingController: event.ReportingController,
+		Note:                event.Note,
+		Count:               1,
+	}
+
+	if record.ReportingController == "" {
+		record.ReportingController = event.DeprecatedSource.Component
+	}
+
+	for _, timestamp := range []time.Time{event.DeprecatedFirstTimestamp.Time, event.EventTime.Time, event.CreationTimestamp.Time} {
+		if !timestamp.IsZero() {
+			record.FirstTimestamp = timestamp
+			break
+		}
+	}
+
+	var seriesLastObservedTime time.Time
+	if event.Series != nil {
+		seriesLastObservedTime = event.Series.LastObservedTime.Time
+	}
+	for _, timestamp := range []time.Time{seriesLastObservedTime, event.DeprecatedLastTimestamp.Time, record.FirstTimestamp} {
+		if !timestamp.IsZero() {
+			record.LastTimestamp = timestamp
+			break
+		}
+	}
+
+	if event.Series != nil && event.Series.Count > 0 {
+		record.Count = event.Series.Count
+	} else if event.DeprecatedCount > 0 {
+		record.Count = event.DeprecatedCount
+	}
+
+	return record
+}
+
+func (record *EventRecord) key() string {
+	return strings.Join([]string{record.Namespace, record.Object, record.Type, record.Reason, record.ReportingController, record.Note}, "\x00")
+}
+
+// dedupeEventRecords merges the records of the Event objects reporting the same event, and sorts them from the
+// oldest to the most recent occurrence
+func dedupeEventRecords(events map[types.UID]EventRecord) []EventRecord {
+	merged := map[string]*EventRecord{}
+	for _, event := range events {
+		record, ok := merged[event.key()]
+		if !ok {
+			copied := event
+			merged[event.key()] = &copied
+			continue
+		}
+
+		record.Count += event.Count
+		if event.FirstTimestamp.Before(record.FirstTimestamp) {
+			record.FirstTimestamp = event.FirstTimestamp
+		}
+		if event.LastTimestamp.After(record.LastTimestamp) {
+			record.LastTimestamp = event.LastTimestamp
+		}
+	}
+
+	records := []EventRecord{}
+	for _, record := range merged {
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].LastTimestamp.Equal(records[j].LastTimestamp) {
+			return records[i].LastTimestamp.Before(records[j].LastTimestamp)
+		}
+		return records[i].key() < records[j].key()
+	})
+
+	return records
+}
+
+// forgetOldestEvents removes the events which occurred last the longest ago, down to max events
+func forgetOldestEvents(events map[types.UID]EventRecord, max int) {
+	if len(events) <= max {
+		return
+	}
+
+	uids := []types.UID{}
+	for uid := range events {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return events[uids[i]].LastTimestamp.Before(events[uids[j]].LastTimestamp) })
+
+	for _, uid := range uids[:len(uids)-max] {
+		delete(events, uid)
+	}
+}
+
+// formatEventRecords writes the records as a table similar to kubectl get events, and as one JSON object per line
+func formatEventRecords(records []EventRecord, header bool) (map[string]string, error) {
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	if header {
+		fmt.Fprintln(writer, "LAST SEEN\tFIRST SEEN\tNAMESPACE\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	}
+
+	lines := []string{}
+	for _, record := range records {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			record.LastTimestamp.UTC().Format(time.RFC3339),
+			record.FirstTimestamp.UTC().Format(time.RFC3339),
+			record.Namespace,
+			record.Type,
+			record.Reason,
+			record.Object,
+			record.Count,
+			strings.ReplaceAll(record.Note, "\n", " "))
+
+		dataBytes, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("marshal data: %w", err)
+		}
+		lines = append(lines, string(dataBytes)+"\n")
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("format events table: %w", err)
+	}
+
+	return map[string]string{
+		"table":  table.String(),
+		"ndjson": strings.Join(lines, ""),
+	}, nil
+}
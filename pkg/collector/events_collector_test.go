@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestNewEventRecord(t *testing.T) {
+	first := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	last := first.Add(10 * time.Minute)
+
+	tests := []struct {
+		name      string
+		event     *eventsv1.Event
+		wantCount int32
+		wantFirst time.Time
+		wantLast  time.Time
+	}{
+		{
+			name: "event series",
+			event: &eventsv1.Event{
+				EventTime: metav1.NewMicroTime(first),
+				Series:    &eventsv1.EventSeries{Count: 4, LastObservedTime: metav1.NewMicroTime(last)},
+			},
+			wantCount: 4,
+			wantFirst: first,
+			wantLast:  last,
+		},
+		{
+			name: "event reported through core/v1",
+			event: &eventsv1.Event{
+				DeprecatedFirstTimestamp: metav1.NewTime(first),
+				DeprecatedLastTimestamp:  metav1.NewTime(last),
+				DeprecatedCount:          7,
+			},
+			wantCount: 7,
+			wantFirst: first,
+			wantLast:  last,
+		},
+		{
+			name:      "single event",
+			event:     &eventsv1.Event{EventTime: metav1.NewMicroTime(first)},
+			wantCount: 1,
+			wantFirst: first,
+			wantLast:  first,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.Regarding = v1.ObjectReference{Kind: "Pod", Name: "web-0"}
+			got := newEventRecord(tt.event)
+			if got.Object != "pod/web-0" || got.Count != tt.wantCount || !got.FirstTimestamp.Equal(tt.wantFirst) || !got.LastTimestamp.Equal(tt.wantLast) {
+				t.Errorf("newEventRecord() = %+v, want count %d from %v to %v", got, tt.wantCount, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestDedupeEventRecords(t *testing.T) {
+	t0 := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	pulling := EventRecord{Namespace: "default", Type: "Normal", Reason: "Pulling", Object: "pod/web-0", Note: "Pulling image", Count: 1}
+	backOff := EventRecord{Namespace: "default", Type: "Warning", Reason: "BackOff", Object: "pod/web-0", Note: "Back-off pulling image", Count: 3}
+
+	events := map[types.UID]EventRecord{}
+	for uid, record := range map[string]struct {
+		record EventRecord
+		first  time.Duration
+		last   time.Duration
+	}{
+		"a": {record: backOff, first: 1 * time.Minute, last: 5 * time.Minute},
+		"b": {record: pulling, first: 0, last: 0},
+		"c": {record: backOff, first: 6 * time.Minute, last: 8 * time.Minute},
+	} {
+		record.record.FirstTimestamp = t0.Add(record.first)
+		record.record.LastTimestamp = t0.Add(record.last)
+		events[types.UID(uid)] = record.record
+	}
+
+	got := dedupeEventRecords(events)
+	if len(got) != 2 {
+		t.Fatalf("dedupeEventRecords() = %+v, want 2 records", got)
+	}
+	if got[0].Reason != "Pulling" || got[1].Reason != "BackOff" {
+		t.Errorf("dedupeEventRecords() reasons = %s, %s, want Pulling, BackOff", got[0].Reason, got[1].Reason)
+	}
+	if got[1].Count != 6 || !got[1].FirstTimestamp.Equal(t0.Add(time.Minute)) || !got[1].LastTimestamp.Equal(t0.Add(8*time.Minute)) {
+		t.Errorf("dedupeEventRecords() merged = %+v, want count 6 from %v to %v", got[1], t0.Add(time.Minute), t0.Add(8*time.Minute))
+	}
+}
+
+func TestGetWatchedData(t *testing.T) {
+	t0 := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	record := EventRecord{Namespace: "default", Type: "Warning", Reason: "Unhealthy", Object: "pod/web-0", Note: "Readiness probe failed", Count: 1, FirstTimestamp: t0, LastTimestamp: t0}
+
+	collector := NewEventsCollector(nil)
+	collector.events["a"] = record
+
+	data, err := collector.getWatchedData()
+	if err != nil {
+		t.Fatalf("getWatchedData() error = %v", err)
+	}
+	if data == nil || strings.Count(data["ndjson"], "\n") != 1 || strings.Contains(data["table"], "LAST SEEN") {
+		t.Errorf("getWatchedData() = %v, want the new event without header", data)
+	}
+
+	if data, _ := collector.getWatchedData(); data != nil {
+		t.Errorf("getWatchedData() = %v, want nil when no event occurred again", data)
+	}
+
+	record.Count = 2
+	record.LastTimestamp = t0.Add(time.Minute)
+	collector.events["a"] = record
+
+	data, err = collector.getWatchedData()
+	if err != nil {
+		t.Fatalf("getWatchedData() error = %v", err)
+	}
+	if data == nil || !strings.Contains(data["ndjson"], `"Count":2`) {
+		t.Errorf("getWatchedData() = %v, want the event which occurred again", data)
+	}
+
+	delete(collector.events, "a")
+	if data, _ := collector.getWatchedData(); data != nil || len(collector.exported) != 0 {
+		t.Errorf("getWatchedData() = %v with %d exported records, want the forgotten event to be forgotten", data, len(collector.exported))
+	}
+}
+
+func TestForgetOldestEvents(t *testing.T) {
+	t0 := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	events := map[types.UID]EventRecord{
+		"old":    {LastTimestamp: t0},
+		"recent": {LastTimestamp: t0.Add(2 * time.Hour)},
+		"middle": {LastTimestamp: t0.Add(time.Hour)},
+	}
+
+	forgetOldestEvents(events, 2)
+
+	if _, ok := events["old"]; ok || len(events) != 2 {
+		t.Errorf("forgetOldestEvents() kept %v, want the 2 most recent events", events)
+	}
+}
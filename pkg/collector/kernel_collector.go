@@ -0,0 +1,236 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+var (
+	dmesgLineRegex     = regexp.MustCompile(`^\[\s*(\d+\.\d+)\]\s?(.*)$`)
+	oomKillInfoRegex   = regexp.MustCompile(`oom-kill:(\S+)`)
+	oomKilledRegex     = regexp.MustCompile(`(Memory cgroup out of memory|Out of memory)[^:]*: Kill(?:ed)? process (\d+) \(([^)]*)\)(?:.*anon-rss:(\d+)kB)?`)
+	cgroupPodUIDRegex  = regexp.MustCompile(`pod([0-9a-fA-F]{8}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{12})`)
+	containerScopeTrim = []string{"cri-containerd-", "docker-", "crio-"}
+)
+
+// OOMKillRecord defines an OOM kill parsed from the kernel ring buffer
+type OOMKillRecord struct {
+	TimeStamp   time.Time `json:"TimeStamp"`
+	Scope       string    `json:"Scope"`
+	Process     string    `json:"Process"`
+	PID         int       `json:"PID"`
+	AnonRSSKB   int64     `json:"AnonRSSKB,omitempty"`
+	Constraint  string    `json:"Constraint,omitempty"`
+	Cgroup      string    `json:"Cgroup,omitempty"`
+	PodUID      string    `json:"PodUID,omitempty"`
+	ContainerID string    `json:"ContainerID,omitempty"`
+}
+
+// KernelCollector defines a Kernel Collector struct
+type KernelCollector struct {
+	data map[string]string
+}
+
+// NewKernelCollector is a constructor
+func NewKernelCollector() *KernelCollector {
+	return &KernelCollector{
+		data: make(map[string]string),
+	}
+}
+
+func (collector *KernelCollector) GetName() string {
+	return "kernel"
+}
+
+// Collect implements the interface method
+func (collector *KernelCollector) Collect() error {
+	commands := map[string][]string{
+		"sysctl":          {"sysctl", "-a"},
+		"modules":         {"lsmod"},
+		"uname":           {"uname", "-a"},
+		"os-release":      {"cat", "/etc/os-release"},
+		"cmdline":         {"cat", "/proc/cmdline"},
+		"pressure_cpu":    {"cat", "/proc/pressure/cpu"},
+		"pressure_memory": {"cat", "/proc/pressure/memory"},
+		"pressure_io":     {"cat", "/proc/pressure/io"},
+	}
+
+	for key, command := range commands {
+		output, err := utils.RunCommandOnHost(command[0], command[1:]...)
+		if err != nil {
+			output = fmt.Sprintf("Failed to run %s: %v", strings.Join(command, " "), err)
+			log.Print(output)
+		}
+		collector.data[key] = output
+	}
+
+	dmesg, err := utils.RunCommandOnHost("dmesg")
+	if err != nil {
+		return fmt.Errorf("read kernel ring buffer: %w", err)
+	}
+
+	uptime, err := utils.RunCommandOnHost("cat", "/proc/uptime")
+	if err != nil {
+		return fmt.Errorf("read uptime: %w", err)
+	}
+
+	bootTime, err := getBootTime(uptime, time.Now())
+	if err != nil {
+		return err
+	}
+
+	normalized := normalizeDmesg(dmesg, bootTime)
+	collector.data["dmesg"] = normalized
+
+	dataBytes, err := json.Marshal(ParseOOMKills(normalized))
+	if err != nil {
+		return fmt.Errorf("marshal oom kills: %w", err)
+	}
+	collector.data["oomkills"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *KernelCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// ParseOOMKills extracts the OOM kill records from a dmesg output normalized by the kernel collector
+func ParseOOMKills(dmesg string) []OOMKillRecord {
+	records := []OOMKillRecord{}
+	oomKillInfo := map[int]map[string]string{}
+
+	for _, line := range strings.Split(dmesg, "\n") {
+		timeStamp, message := splitNormalizedDmesgLine(line)
+
+		if match := oomKillInfoRegex.FindStringSubmatch(message); match != nil {
+			info := map[string]string{}
+			for _, field := range strings.Split(match[1], ",") {
+				parts := strings.SplitN(field, "=", 2)
+				if len(parts) == 2 {
+					info[parts[0]] = parts[1]
+				}
+			}
+
+			if pid, err := strconv.Atoi(info["pid"]); err == nil {
+				oomKillInfo[pid] = info
+			}
+			continue
+		}
+
+		match := oomKilledRegex.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+
+		pid, _ := strconv.Atoi(match[2])
+		record := OOMKillRecord{
+			TimeStamp: timeStamp,
+			Scope:     "node",
+			Process:   match[3],
+			PID:       pid,
+		}
+
+		if strings.HasPrefix(match[1], "Memory cgroup") {
+			record.Scope = "cgroup"
+		}
+
+		if match[4] != "" {
+			record.AnonRSSKB, _ = strconv.ParseInt(match[4], 10, 64)
+		}
+
+		if info, ok := oomKillInfo[pid]; ok {
+			record.Constraint = info["constraint"]
+			record.Cgroup = info["task_memcg"]
+			if record.Constraint == "CONSTRAINT_MEMCG" {
+				record.Scope = "cgroup"
+			}
+			delete(oomKillInfo, pid)
+		}
+
+		record.PodUID, record.ContainerID = parseKubernetesCgroup(record.Cgroup)
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// parseKubernetesCgroup extracts the pod UID and container ID from a cgroupfs or systemd kubepods cgroup path
+func parseKubernetesCgroup(cgroup string) (string, string) {
+	match := cgroupPodUIDRegex.FindStringSubmatch(cgroup)
+	if match == nil {
+		return "", ""
+	}
+
+	podUID := strings.ReplaceAll(match[1], "_", "-")
+
+	segments := strings.Split(strings.TrimSuffix(cgroup, "/"), "/")
+	containerID := segments[len(segments)-1]
+	if strings.Contains(containerID, match[1]) {
+		return podUID, ""
+	}
+
+	containerID = strings.TrimSuffix(containerID, ".scope")
+	for _, prefix := range containerScopeTrim {
+		containerID = strings.TrimPrefix(containerID, prefix)
+	}
+
+	return podUID, containerID
+}
+
+// getBootTime computes the wall-clock boot time from the content of /proc/uptime
+func getBootTime(uptime string, now time.Time) (time.Time, error) {
+	fields := strings.Fields(uptime)
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("unexpected uptime format: %q", uptime)
+	}
+
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse uptime: %w", err)
+	}
+
+	return now.Add(-time.Duration(seconds * float64(time.Second))), nil
+}
+
+// normalizeDmesg replaces the seconds since boot prefix of each dmesg line by an RFC3339 wall-clock timestamp
+func normalizeDmesg(dmesg string, bootTime time.Time) string {
+	lines := strings.Split(strings.TrimSuffix(dmesg, "\n"), "\n")
+	for i, line := range lines {
+		match := dmesgLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+
+		timeStamp := bootTime.Add(time.Duration(seconds * float64(time.Second))).UTC()
+		lines[i] = timeStamp.Format(time.RFC3339Nano) + " " + match[2]
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func splitNormalizedDmesgLine(line string) (time.Time, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, line
+	}
+
+	timeStamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, line
+	}
+
+	return timeStamp, parts[1]
+}
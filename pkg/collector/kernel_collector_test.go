@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOOMKills(t *testing.T) {
+	bootTime := time.Date(2021, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		dmesg string
+		want  []OOMKillRecord
+	}{
+		{
+			name:  "no oom kills",
+			dmesg: "[    0.000000] Linux version 5.4.0-1059-azure\n",
+			want:  []OOMKillRecord{},
+		},
+		{
+			name: "cgroup oom kill with systemd cgroup driver",
+			dmesg: "[  120.500000] stress invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=939\n" +
+				"[  120.600000] oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=cri-containerd-abc.scope,mems_allowed=0,oom_memcg=/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice/cri-containerd-abc.scope,task_memcg=/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice/cri-containerd-abc.scope,task=stress,pid=4242,uid=0\n" +
+				"[  120.700000] Memory cgroup out of memory: Killed process 4242 (stress) total-vm:268812kB, anon-rss:262168kB, file-rss:4kB, shmem-rss:0kB, UID:0 pgtables:560kB oom_score_adj:939\n",
+			want: []OOMKillRecord{
+				{
+					TimeStamp:   bootTime.Add(120700 * time.Millisecond),
+					Scope:       "cgroup",
+					Process:     "stress",
+					PID:         4242,
+					AnonRSSKB:   262168,
+					Constraint:  "CONSTRAINT_MEMCG",
+					Cgroup:      "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice/cri-containerd-abc.scope",
+					PodUID:      "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0",
+					ContainerID: "abc",
+				},
+			},
+		},
+		{
+			name:  "node oom kill",
+			dmesg: "[ 3600.000000] Out of memory: Killed process 77 (java) total-vm:1000kB, anon-rss:900kB, file-rss:0kB, shmem-rss:0kB\n",
+			want: []OOMKillRecord{
+				{
+					TimeStamp: bootTime.Add(time.Hour),
+					Scope:     "node",
+					Process:   "java",
+					PID:       77,
+					AnonRSSKB: 900,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseOOMKills(normalizeDmesg(tt.dmesg, bootTime))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOOMKills() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBootTime(t *testing.T) {
+	now := time.Date(2021, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	got, err := getBootTime("3600.50 7000.00\n", now)
+	if err != nil {
+		t.Fatalf("getBootTime() error = %v", err)
+	}
+
+	want := now.Add(-3600500 * time.Millisecond)
+	if !got.Equal(want) {
+		t.Errorf("getBootTime() = %v, want %v", got, want)
+	}
+
+	if _, err := getBootTime("", now); err == nil {
+		t.Errorf("getBootTime() expected error for empty uptime")
+	}
+}
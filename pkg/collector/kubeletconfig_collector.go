@@ -0,0 +1,329 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeletFlagKind defines how a kubelet flag value maps to its config file field
+type kubeletFlagKind int
+
+const (
+	kubeletFlagString kubeletFlagKind = iota
+	kubeletFlagInt
+	kubeletFlagBool
+	kubeletFlagList
+	kubeletFlagMap
+	kubeletFlagThresholds
+)
+
+type kubeletFlagField struct {
+	field string
+	kind  kubeletFlagKind
+}
+
+// kubeletFlagFields maps the kubelet flags commonly set on AKS nodes to their KubeletConfiguration fields
+var kubeletFlagFields = map[string]kubeletFlagField{
+	"max-pods":                          {"maxPods", kubeletFlagInt},
+	"pod-max-pids":                      {"podPidsLimit", kubeletFlagInt},
+	"cluster-dns":                       {"clusterDNS", kubeletFlagList},
+	"cluster-domain":                    {"clusterDomain", kubeletFlagString},
+	"cgroup-driver":                     {"cgroupDriver", kubeletFlagString},
+	"image-gc-high-threshold":           {"imageGCHighThresholdPercent", kubeletFlagInt},
+	"image-gc-low-threshold":            {"imageGCLowThresholdPercent", kubeletFlagInt},
+	"eviction-hard":                     {"evictionHard", kubeletFlagThresholds},
+	"eviction-soft":                     {"evictionSoft", kubeletFlagThresholds},
+	"kube-reserved":                     {"kubeReserved", kubeletFlagMap},
+	"system-reserved":                   {"systemReserved", kubeletFlagMap},
+	"enforce-node-allocatable":          {"enforceNodeAllocatable", kubeletFlagList},
+	"feature-gates":                     {"featureGates", kubeletFlagMap},
+	"read-only-port":                    {"readOnlyPort", kubeletFlagInt},
+	"protect-kernel-defaults":           {"protectKernelDefaults", kubeletFlagBool},
+	"rotate-certificates":               {"rotateCertificates", kubeletFlagBool},
+	"serialize-image-pulls":             {"serializeImagePulls", kubeletFlagBool},
+	"node-status-update-frequency":      {"nodeStatusUpdateFrequency", kubeletFlagString},
+	"streaming-connection-idle-timeout": {"streamingConnectionIdleTimeout", kubeletFlagString},
+	"tls-cipher-suites":                 {"tlsCipherSuites", kubeletFlagList},
+	"tls-cert-file":                     {"tlsCertFile", kubeletFlagString},
+	"tls-private-key-file":              {"tlsPrivateKeyFile", kubeletFlagString},
+}
+
+// KubeletSetting defines an effective kubelet setting and where it was read from
+type KubeletSetting struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// KubeconfigMetadata defines the non-sensitive content of a kubeconfig file
+type KubeconfigMetadata struct {
+	Path           string              `json:"path"`
+	CurrentContext string              `json:"currentContext"`
+	Clusters       []KubeconfigCluster `json:"clusters"`
+	Users          []KubeconfigUser    `json:"users"`
+}
+
+// KubeconfigCluster defines the non-sensitive content of a kubeconfig cluster
+type KubeconfigCluster struct {
+	Name                    string `json:"name"`
+	Server                  string `json:"server"`
+	CertificateAuthority    string `json:"certificateAuthority,omitempty"`
+	HasCertificateAuthority bool   `json:"hasCertificateAuthorityData"`
+	InsecureSkipTLSVerify   bool   `json:"insecureSkipTLSVerify"`
+}
+
+// KubeconfigUser defines how a kubeconfig user authenticates, without its credentials
+type KubeconfigUser struct {
+	Name              string   `json:"name"`
+	AuthMethods       []string `json:"authMethods"`
+	ClientCertificate string   `json:"clientCertificate,omitempty"`
+	TokenFile         string   `json:"tokenFile,omitempty"`
+	ExecCommand       string   `json:"execCommand,omitempty"`
+}
+
+// KubeletConfigCollector defines a KubeletConfig Collector struct
+type KubeletConfigCollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewKubeletConfigCollector is a constructor
+func NewKubeletConfigCollector(config *restclient.Config) *KubeletConfigCollector {
+	return &KubeletConfigCollector{
+		data:       make(map[string]string),
+		kubeconfig: config,
+	}
+}
+
+func (collector *KubeletConfigCollector) GetName() string {
+	return "kubeletconfig"
+}
+
+// Collect implements the interface method
+func (collector *KubeletConfigCollector) Collect() error {
+	commandLine, err := utils.GetKubeletCommandLine()
+	if err != nil {
+		return err
+	}
+
+	flags := utils.ParseKubeletFlags(commandLine)
+	effective := map[string]KubeletSetting{}
+
+	if path, ok := flags["config"]; ok {
+		content, err := utils.RunCommandOnHost("cat", path)
+		if err != nil {
+			content = fmt.Sprintf("Failed to read kubelet config file %s: %v", path, err)
+			log.Print(content)
+		}
+		collector.data["config_file"] = content
+
+		config, err := utils.ReadKubeletConfigFile(path)
+		if err != nil {
+			log.Printf("Failed to decode kubelet config file: %v", err)
+		} else {
+			mergeKubeletSettings(effective, config, "config-file")
+		}
+	}
+
+	mergeKubeletSettings(effective, kubeletFlagsToConfig(flags), "flag")
+
+	nodeName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	configz, err := getNodeProxy(clientset, nodeName, "configz")
+	if err != nil {
+		log.Printf("Failed to get kubelet configz: %v", err)
+	} else {
+		collector.data["configz"] = string(configz)
+
+		var live struct {
+			KubeletConfig map[string]interface{} `json:"kubeletconfig"`
+		}
+		if err := json.Unmarshal(configz, &live); err != nil {
+			log.Printf("Failed to unmarshal kubelet configz: %v", err)
+		} else {
+			mergeKubeletSettings(effective, live.KubeletConfig, "configz")
+		}
+	}
+
+	healthz, err := getNodeProxy(clientset, nodeName, "healthz")
+	if err != nil {
+		healthz = []byte(fmt.Sprintf("Failed to get kubelet healthz: %v", err))
+		log.Print(string(healthz))
+	}
+	collector.data["healthz"] = string(healthz)
+
+	kubeconfigs := []KubeconfigMetadata{}
+	for _, flag := range []string{"kubeconfig", "bootstrap-kubeconfig"} {
+		path, ok := flags[flag]
+		if !ok {
+			continue
+		}
+
+		metadata, err := readKubeconfigMetadata(path)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", flag, err)
+			continue
+		}
+		kubeconfigs = append(kubeconfigs, *metadata)
+	}
+
+	kubeconfigsBytes, err := json.Marshal(kubeconfigs)
+	if err != nil {
+		return fmt.Errorf("marshal kubeconfig metadata: %w", err)
+	}
+	collector.data["kubeconfigs"] = string(kubeconfigsBytes)
+
+	effectiveBytes, err := json.Marshal(effective)
+	if err != nil {
+		return fmt.Errorf("marshal effective kubelet config: %w", err)
+	}
+	collector.data["effective"] = string(effectiveBytes)
+
+	return nil
+}
+
+func (collector *KubeletConfigCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// getNodeProxy gets a kubelet endpoint through the API server node proxy
+func getNodeProxy(clientset *kubernetes.Clientset, nodeName string, path string) ([]byte, error) {
+	return clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix(path).
+		DoRaw(context.TODO())
+}
+
+// mergeKubeletSettings overrides the effective settings with the top level fields of config
+func mergeKubeletSettings(effective map[string]KubeletSetting, config map[string]interface{}, source string) {
+	for key, value := range config {
+		effective[key] = KubeletSetting{Value: value, Source: source}
+	}
+}
+
+// kubeletFlagsToConfig converts the known kubelet flags to their config file fields; unknown flags keep their flag name
+func kubeletFlagsToConfig(flags map[string]string) map[string]interface{} {
+	config := map[string]interface{}{}
+
+	for flag, value := range flags {
+		field, ok := kubeletFlagFields[flag]
+		if !ok {
+			config["--"+flag] = value
+			continue
+		}
+
+		switch field.kind {
+		case kubeletFlagInt:
+			if i, err := strconv.Atoi(value); err == nil {
+				config[field.field] = i
+			} else {
+				config[field.field] = value
+			}
+		case kubeletFlagBool:
+			config[field.field] = value == "true"
+		case kubeletFlagList:
+			config[field.field] = strings.Split(value, ",")
+		case kubeletFlagMap:
+			values := map[string]string{}
+			for _, pair := range strings.Split(value, ",") {
+				parts := strings.SplitN(pair, "=", 2)
+				if len(parts) == 2 {
+					values[parts[0]] = parts[1]
+				}
+			}
+			config[field.field] = values
+		case kubeletFlagThresholds:
+			config[field.field] = utils.ParseEvictionThresholds(value)
+		default:
+			config[field.field] = value
+		}
+	}
+
+	return config
+}
+
+// readKubeconfigMetadata reads a kubeconfig file from host and strips its credentials
+func readKubeconfigMetadata(path string) (*KubeconfigMetadata, error) {
+	content, err := utils.RunCommandOnHost("cat", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKubeconfigMetadata(path, []byte(content))
+}
+
+func parseKubeconfigMetadata(path string, content []byte) (*KubeconfigMetadata, error) {
+	config, err := clientcmd.Load(content)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig %s: %w", path, err)
+	}
+
+	metadata := &KubeconfigMetadata{
+		Path:           path,
+		CurrentContext: config.CurrentContext,
+		Clusters:       []KubeconfigCluster{},
+		Users:          []KubeconfigUser{},
+	}
+
+	for name, cluster := range config.Clusters {
+		metadata.Clusters = append(metadata.Clusters, KubeconfigCluster{
+			Name:                    name,
+			Server:                  cluster.Server,
+			CertificateAuthority:    cluster.CertificateAuthority,
+			HasCertificateAuthority: len(cluster.CertificateAuthorityData) > 0,
+			InsecureSkipTLSVerify:   cluster.InsecureSkipTLSVerify,
+		})
+	}
+
+	for name, authInfo := range config.AuthInfos {
+		user := KubeconfigUser{
+			Name:              name,
+			AuthMethods:       []string{},
+			ClientCertificate: authInfo.ClientCertificate,
+			TokenFile:         authInfo.TokenFile,
+		}
+
+		if authInfo.ClientCertificate != "" || len(authInfo.ClientCertificateData) > 0 {
+			user.AuthMethods = append(user.AuthMethods, "client-certificate")
+		}
+		if authInfo.Token != "" || authInfo.TokenFile != "" {
+			user.AuthMethods = append(user.AuthMethods, "token")
+		}
+		if authInfo.Username != "" {
+			user.AuthMethods = append(user.AuthMethods, "basic")
+		}
+		if authInfo.Exec != nil {
+			user.AuthMethods = append(user.AuthMethods, "exec")
+			user.ExecCommand = authInfo.Exec.Command
+		}
+		if authInfo.AuthProvider != nil {
+			user.AuthMethods = append(user.AuthMethods, "auth-provider")
+		}
+
+		metadata.Users = append(metadata.Users, user)
+	}
+
+	sort.Slice(metadata.Clusters, func(i, j int) bool { return metadata.Clusters[i].Name < metadata.Clusters[j].Name })
+	sort.Slice(metadata.Users, func(i, j int) bool { return metadata.Users[i].Name < metadata.Users[j].Name })
+
+	return metadata, nil
+}
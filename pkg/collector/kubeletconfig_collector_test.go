@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKubeletFlagsToConfig(t *testing.T) {
+	flags := map[string]string{
+		"max-pods":            "30",
+		"cluster-dns":         "10.0.0.10",
+		"eviction-hard":       "memory.available<750Mi,nodefs.available<10%",
+		"feature-gates":       "RotateKubeletServerCertificate=true",
+		"anonymous-auth":      "false",
+		"rotate-certificates": "true",
+	}
+
+	want := map[string]interface{}{
+		"maxPods":            30,
+		"clusterDNS":         []string{"10.0.0.10"},
+		"evictionHard":       map[string]string{"memory.available": "750Mi", "nodefs.available": "10%"},
+		"featureGates":       map[string]string{"RotateKubeletServerCertificate": "true"},
+		"--anonymous-auth":   "false",
+		"rotateCertificates": true,
+	}
+
+	got := kubeletFlagsToConfig(flags)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kubeletFlagsToConfig() = %+v, want %+v", got, want)
+	}
+
+	effective := map[string]KubeletSetting{}
+	mergeKubeletSettings(effective, map[string]interface{}{"maxPods": 110, "cgroupDriver": "cgroupfs"}, "config-file")
+	mergeKubeletSettings(effective, got, "flag")
+
+	if effective["maxPods"].Source != "flag" || effective["cgroupDriver"].Source != "config-file" {
+		t.Errorf("mergeKubeletSettings() = %+v, want flags to override the config file", effective)
+	}
+}
+
+func TestParseKubeconfigMetadata(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: localcluster
+  cluster:
+    certificate-authority: /etc/kubernetes/certs/ca.crt
+    server: https://mycluster-dns-12345678.hcp.eastus.azmk8s.io:443
+users:
+- name: client
+  user:
+    client-certificate: /etc/kubernetes/certs/client.crt
+    client-key: /etc/kubernetes/certs/client.key
+- name: bootstrap
+  user:
+    token: super-secret-token
+contexts:
+- name: localclustercontext
+  context:
+    cluster: localcluster
+    user: client
+current-context: localclustercontext
+`
+
+	metadata, err := parseKubeconfigMetadata("/var/lib/kubelet/kubeconfig", []byte(kubeconfig))
+	if err != nil {
+		t.Fatalf("parseKubeconfigMetadata() error = %v", err)
+	}
+
+	want := &KubeconfigMetadata{
+		Path:           "/var/lib/kubelet/kubeconfig",
+		CurrentContext: "localclustercontext",
+		Clusters: []KubeconfigCluster{
+			{
+				Name:                 "localcluster",
+				Server:               "https://mycluster-dns-12345678.hcp.eastus.azmk8s.io:443",
+				CertificateAuthority: "/etc/kubernetes/certs/ca.crt",
+			},
+		},
+		Users: []KubeconfigUser{
+			{Name: "bootstrap", AuthMethods: []string{"token"}},
+			{Name: "client", AuthMethods: []string{"client-certificate"}, ClientCertificate: "/etc/kubernetes/certs/client.crt"},
+		},
+	}
+
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("parseKubeconfigMetadata() = %+v, want %+v", metadata, want)
+	}
+
+	dataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+
+	if strings.Contains(string(dataBytes), "super-secret-token") {
+		t.Errorf("kubeconfig metadata leaks credentials: %s", dataBytes)
+	}
+}
@@ -3,10 +3,32 @@ package collector
 import (
 	"encoding/json"
 	"fmt"
-	"net"
+	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	defaultNetworkOutboundInterval = 5 * time.Second
+	networkOutboundDialTimeout     = 5 * time.Second
 )
 
+// defaultNetworkOutboundTypes lists the targets probed when none are configured
+var defaultNetworkOutboundTypes = []networkOutboundType{
+	{
+		Type: "AKS API Server",
+		URL:  "tls://kubernetes.default.svc.cluster.local:443",
+	},
+	{
+		Type: "Microsoft Container Registry",
+		URL:  "https://mcr.microsoft.com/v2/",
+	},
+}
+
 type networkOutboundType struct {
 	Type string `json:"Type"`
 	URL  string `json:"URL"`
@@ -16,18 +38,22 @@ type networkOutboundType struct {
 type NetworkOutboundDatum struct {
 	TimeStamp time.Time `json:"TimeStamp"`
 	networkOutboundType
-	Status string `json:"Status"`
+	Status      string                 `json:"Status"`
+	FailedStage string                 `json:"FailedStage,omitempty"`
+	Stages      []NetworkOutboundStage `json:"Stages"`
 }
 
 // NetworkOutboundCollector defines a NetworkOutbound Collector struct
 type NetworkOutboundCollector struct {
-	data map[string]string
+	interval time.Duration
+	data     map[string]string
 }
 
 // NewNetworkOutboundCollector is a constructor
 func NewNetworkOutboundCollector() *NetworkOutboundCollector {
 	return &NetworkOutboundCollector{
-		data: make(map[string]string),
+		interval: defaultNetworkOutboundInterval,
+		data:     make(map[string]string),
 	}
 }
 
@@ -35,55 +61,95 @@ func (collector *NetworkOutboundCollector) GetName() string {
 	return "networkoutbound"
 }
 
+// GetInterval returns the interval between two probes of the same target
+func (collector *NetworkOutboundCollector) GetInterval() time.Duration {
+	return collector.interval
+}
+
 // Collect implements the interface method
 func (collector *NetworkOutboundCollector) Collect() error {
-	outboundTypes := []networkOutboundType{}
-	outboundTypes = append(outboundTypes,
-		networkOutboundType{
-			Type: "Internet",
-			URL:  "google.com:80",
-		},
-	)
-	outboundTypes = append(outboundTypes,
-		networkOutboundType{
-			Type: "AKS API Server",
-			URL:  "kubernetes.default.svc.cluster.local:443",
-		},
-	)
-	outboundTypes = append(outboundTypes,
-		networkOutboundType{
-			Type: "Azure Container Registry",
-			URL:  "azurecr.io:80",
-		},
-	)
-	outboundTypes = append(outboundTypes,
-		networkOutboundType{
-			Type: "Microsoft Container Registry",
-			URL:  "mcr.microsoft.com:80",
-		},
-	)
-
-	for _, outboundType := range outboundTypes {
-		timeout := time.Duration(5 * time.Second)
-		_, err := net.DialTimeout("tcp", outboundType.URL, timeout)
-
-		status := "Connected"
-		if err != nil {
-			status = "Error: " + err.Error()
+	outboundTypes := parseNetworkOutboundTypes(os.Getenv("DIAGNOSTIC_NETWORKOUTBOUND_TARGETS"))
+	if len(outboundTypes) == 0 {
+		outboundTypes = defaultNetworkOutboundTypes
+	}
+
+	duration, err := getDurationFromEnv("DIAGNOSTIC_NETWORKOUTBOUND_DURATION", 0)
+	if err != nil {
+		return err
+	}
+
+	collector.interval, err = getDurationFromEnv("DIAGNOSTIC_NETWORKOUTBOUND_INTERVAL", defaultNetworkOutboundInterval)
+	if err != nil {
+		return err
+	}
+
+	if collector.interval == 0 {
+		return fmt.Errorf("DIAGNOSTIC_NETWORKOUTBOUND_INTERVAL must be positive")
+	}
+
+	proxyConfig := utils.GetProxyConfig()
+
+	profile, err := getEgressProfile(os.Getenv("DIAGNOSTIC_NETWORKOUTBOUND_PROFILE"))
+	if err != nil {
+		return err
+	}
+
+	var profileResult *EgressProfileResult
+	profileGrp := new(sync.WaitGroup)
+	if profile != nil {
+		profileGrp.Add(1)
+		go func() {
+			defer profileGrp.Done()
+			profileResult = checkEgressProfile(profile, proxyConfig)
+		}()
+	}
+
+	timeSeries := make([][]string, len(outboundTypes))
+
+	ticker := time.NewTicker(collector.interval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(duration)
+	for {
+		timeStamp := time.Now().Truncate(1 * time.Second)
+
+		probeGrp := new(sync.WaitGroup)
+		errs := make([]error, len(outboundTypes))
+		for i, outboundType := range outboundTypes {
+			probeGrp.Add(1)
+			go func(i int, outboundType networkOutboundType) {
+				defer probeGrp.Done()
+
+				var dataBytes []byte
+				dataBytes, errs[i] = json.Marshal(probeNetworkOutbound(outboundType, timeStamp, proxyConfig))
+				timeSeries[i] = append(timeSeries[i], string(dataBytes))
+			}(i, outboundType)
 		}
+		probeGrp.Wait()
 
-		data := &NetworkOutboundDatum{
-			TimeStamp:           time.Now().Truncate(1 * time.Second),
-			networkOutboundType: outboundType,
-			Status:              status,
+		for _, err := range errs {
+			if err != nil {
+				return fmt.Errorf("marshal data: %w", err)
+			}
 		}
 
-		dataBytes, err := json.Marshal(data)
+		if time.Now().Add(collector.interval).After(deadline) {
+			break
+		}
+		<-ticker.C
+	}
+
+	for i, outboundType := range outboundTypes {
+		collector.data[outboundType.Type] = strings.Join(timeSeries[i], "\n")
+	}
+
+	profileGrp.Wait()
+	if profileResult != nil {
+		dataBytes, err := json.Marshal(profileResult)
 		if err != nil {
 			return fmt.Errorf("marshal data: %w", err)
 		}
-
-		collector.data[outboundType.Type] = string(dataBytes)
+		collector.data[NetworkOutboundEgressProfileKey] = string(dataBytes)
 	}
 
 	return nil
@@ -92,3 +158,66 @@ func (collector *NetworkOutboundCollector) Collect() error {
 func (collector *NetworkOutboundCollector) GetData() map[string]string {
 	return collector.data
 }
+
+func probeNetworkOutbound(outboundType networkOutboundType, timeStamp time.Time, proxyConfig *utils.ProxyConfig) *NetworkOutboundDatum {
+	datum := &NetworkOutboundDatum{
+		TimeStamp:           timeStamp,
+		networkOutboundType: outboundType,
+		Status:              "Connected",
+	}
+
+	probe, err := parseNetworkOutboundProbe(outboundType.URL)
+	if err != nil {
+		datum.Status = "Error: " + err.Error()
+		return datum
+	}
+	probe.setProxy(proxyConfig)
+
+	datum.Stages, datum.FailedStage, err = probe.run()
+	if err != nil {
+		datum.Status = "Error: " + datum.FailedStage + ": " + err.Error()
+	}
+
+	return datum
+}
+
+// parseNetworkOutboundTypes parses a whitespace separated list of [name=]target, where target is
+// host:port, tls://host:port or https://host[:port]/path[#expected status]
+func parseNetworkOutboundTypes(targets string) []networkOutboundType {
+	outboundTypes := []networkOutboundType{}
+	for _, target := range strings.Fields(targets) {
+		outboundType := networkOutboundType{Type: target, URL: target}
+		if parts := strings.SplitN(target, "=", 2); len(parts) == 2 {
+			outboundType.Type = parts[0]
+			outboundType.URL = parts[1]
+		}
+
+		if _, err := parseNetworkOutboundProbe(outboundType.URL); err != nil {
+			log.Printf("Ignoring network outbound target %q: %v", target, err)
+			continue
+		}
+
+		outboundTypes = append(outboundTypes, outboundType)
+	}
+
+	return outboundTypes
+}
+
+// getDurationFromEnv parses a duration environment variable, returning defaultValue when it is not set
+func getDurationFromEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", key, err)
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("%s must not be negative: %s", key, value)
+	}
+
+	return duration, nil
+}
@@ -1,7 +1,13 @@
 package collector
 
 import (
+	"encoding/json"
+	"net"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewNetworkOutboundCollector(t *testing.T) {
@@ -41,3 +47,89 @@ func TestNewNetworkOutboundCollector(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNetworkOutboundTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets string
+		want    []networkOutboundType
+	}{
+		{
+			name:    "no targets",
+			targets: "",
+			want:    []networkOutboundType{},
+		},
+		{
+			name:    "named and unnamed targets",
+			targets: "myacr=myacr.azurecr.io:443  10.0.0.4:3128\n",
+			want: []networkOutboundType{
+				{Type: "myacr", URL: "myacr.azurecr.io:443"},
+				{Type: "10.0.0.4:3128", URL: "10.0.0.4:3128"},
+			},
+		},
+		{
+			name:    "target without port",
+			targets: "mcr.microsoft.com",
+			want:    []networkOutboundType{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseNetworkOutboundTypes(tt.targets)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetworkOutboundTypes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkOutboundCollectorTimeSeries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	env := map[string]string{
+		"DIAGNOSTIC_NETWORKOUTBOUND_TARGETS":  "local=" + listener.Addr().String(),
+		"DIAGNOSTIC_NETWORKOUTBOUND_DURATION": "2s",
+		"DIAGNOSTIC_NETWORKOUTBOUND_INTERVAL": "1s",
+		"DIAGNOSTIC_NETWORKOUTBOUND_PROFILE":  "none",
+	}
+	for key, value := range env {
+		if err := os.Setenv(key, value); err != nil {
+			t.Fatalf("Setenv: %v", err)
+		}
+		defer os.Unsetenv(key)
+	}
+
+	c := NewNetworkOutboundCollector()
+	if err := c.Collect(); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	lines := strings.Split(c.GetData()["local"], "\n")
+	if len(lines) < 2 {
+		t.Fatalf("len(time series) = %v, want at least 2", len(lines))
+	}
+
+	for _, line := range lines {
+		var datum NetworkOutboundDatum
+		if err := json.Unmarshal([]byte(line), &datum); err != nil {
+			t.Fatalf("unmarshal time series: %v", err)
+		}
+
+		if datum.Status != "Connected" {
+			t.Errorf("Status = %v, want Connected", datum.Status)
+		}
+	}
+
+	if _, ok := c.GetData()[NetworkOutboundEgressProfileKey]; ok {
+		t.Errorf("GetData() contains %s with the egress profile disabled", NetworkOutboundEgressProfileKey)
+	}
+
+	if c.GetInterval() != time.Second {
+		t.Errorf("GetInterval() = %v, want %v", c.GetInterval(), time.Second)
+	}
+}
@@ -0,0 +1,444 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	networkOutboundStageSucceeded = "Succeeded"
+	networkOutboundStageFailed    = "Failed"
+	networkOutboundStageSkipped   = "Skipped"
+
+	// serviceAccountCAFile is trusted in addition to the system roots, so the API server can be validated
+	serviceAccountCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// NetworkOutboundStage defines the result of one stage of a network outbound probe
+type NetworkOutboundStage struct {
+	Stage            string                       `json:"Stage"`
+	Status           string                       `json:"Status"`
+	DurationMs       float64                      `json:"DurationMs"`
+	Error            string                       `json:"Error,omitempty"`
+	Resolver         string                       `json:"Resolver,omitempty"`
+	Addresses        []string                     `json:"Addresses,omitempty"`
+	PeerCertificates []NetworkOutboundCertificate `json:"PeerCertificates,omitempty"`
+	StatusCode       int                          `json:"StatusCode,omitempty"`
+}
+
+// NetworkOutboundCertificate defines a certificate presented during a TLS handshake
+type NetworkOutboundCertificate struct {
+	Subject  string    `json:"Subject"`
+	Issuer   string    `json:"Issuer"`
+	DNSNames []string  `json:"DNSNames,omitempty"`
+	NotAfter time.Time `json:"NotAfter"`
+}
+
+// networkOutboundProbe defines the stages to run against a network outbound target
+type networkOutboundProbe struct {
+	host           string
+	port           string
+	tls            bool
+	http           bool
+	path           string
+	expectedStatus int
+	proxy          func(*url.URL) (*url.URL, error)
+	trustedCA      []byte
+}
+
+// parseNetworkOutboundProbe parses a target of the form host:port, tls://host:port or https://host[:port]/path[#status]
+func parseNetworkOutboundProbe(target string) (*networkOutboundProbe, error) {
+	if !strings.Contains(target, "://") {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, err
+		}
+		return &networkOutboundProbe{host: host, port: port}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := &networkOutboundProbe{host: u.Hostname(), port: u.Port(), tls: true}
+	switch u.Scheme {
+	case "tls":
+		if probe.port == "" {
+			return nil, fmt.Errorf("missing port in tls target %s", target)
+		}
+	case "https":
+		probe.http = true
+		probe.path = u.EscapedPath()
+		if u.RawQuery != "" {
+			probe.path += "?" + u.RawQuery
+		}
+		if probe.path == "" {
+			probe.path = "/"
+		}
+		if probe.port == "" {
+			probe.port = "443"
+		}
+		if u.Fragment != "" {
+			if probe.expectedStatus, err = strconv.Atoi(u.Fragment); err != nil {
+				return nil, fmt.Errorf("invalid expected status in %s: %w", target, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s in %s", u.Scheme, target)
+	}
+
+	if probe.host == "" {
+		return nil, fmt.Errorf("missing host in %s", target)
+	}
+
+	return probe, nil
+}
+
+// run probes the target stage by stage, stopping at the first stage the connection depends on which fails
+func (probe *networkOutboundProbe) run() ([]NetworkOutboundStage, string, error) {
+	stages := []NetworkOutboundStage{}
+	target := net.JoinHostPort(probe.host, probe.port)
+
+	proxyURL, err := probe.getProxyURL()
+	if err != nil {
+		return stages, "proxy", err
+	}
+
+	address := probe.host
+	if net.ParseIP(probe.host) == nil {
+		clusterStage := resolveNetworkOutbound("dns-cluster", "cluster", net.DefaultResolver, probe.host)
+		stages = append(stages, clusterStage)
+		stages = append(stages, resolveNetworkOutboundWithNodeResolver(probe.host))
+
+		// Behind a proxy the target is resolved by the proxy, local resolution is informational only
+		if proxyURL == nil {
+			if clusterStage.Status != networkOutboundStageSucceeded {
+				return stages, "dns", fmt.Errorf("%s", clusterStage.Error)
+			}
+			address = clusterStage.Addresses[0]
+		}
+	}
+
+	dialAddress := net.JoinHostPort(address, probe.port)
+	if proxyURL != nil {
+		dialAddress = proxyURL.Host
+	}
+
+	tcpStage, conn := dialNetworkOutbound(dialAddress)
+	stages = append(stages, tcpStage)
+	if conn == nil {
+		return stages, "tcp", fmt.Errorf("%s", tcpStage.Error)
+	}
+	defer conn.Close()
+
+	if proxyURL != nil {
+		connectStage := connectNetworkOutbound(conn, proxyURL, target)
+		stages = append(stages, connectStage)
+		if connectStage.Status != networkOutboundStageSucceeded {
+			return stages, "connect", fmt.Errorf("%s", connectStage.Error)
+		}
+	}
+
+	if !probe.tls {
+		return stages, "", nil
+	}
+
+	tlsStage, tlsConn := handshakeNetworkOutbound(conn, probe.host, probe.trustedCA)
+	stages = append(stages, tlsStage)
+	if tlsStage.Status != networkOutboundStageSucceeded {
+		return stages, "tls", fmt.Errorf("%s", tlsStage.Error)
+	}
+
+	if !probe.http {
+		return stages, "", nil
+	}
+
+	httpStage := requestNetworkOutbound(tlsConn, probe.host, probe.path, probe.expectedStatus)
+	stages = append(stages, httpStage)
+	if httpStage.Status != networkOutboundStageSucceeded {
+		return stages, "http", fmt.Errorf("%s", httpStage.Error)
+	}
+
+	return stages, "", nil
+}
+
+// setProxy routes the probe through the proxy of proxyConfig, if any
+func (probe *networkOutboundProbe) setProxy(proxyConfig *utils.ProxyConfig) {
+	if proxyConfig == nil || !proxyConfig.Enabled() {
+		return
+	}
+
+	probe.proxy = proxyConfig.ProxyFunc()
+	probe.trustedCA = proxyConfig.TrustedCA
+}
+
+// getProxyURL returns the proxy the target is reached through, or nil when it is reached directly
+func (probe *networkOutboundProbe) getProxyURL() (*url.URL, error) {
+	if probe.proxy == nil {
+		return nil, nil
+	}
+
+	proxyURL, err := probe.proxy(&url.URL{Scheme: "https", Host: net.JoinHostPort(probe.host, probe.port)})
+	if err != nil || proxyURL == nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported proxy scheme %s", proxyURL.Scheme)
+	}
+
+	if proxyURL.Port() == "" {
+		proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+
+	return proxyURL, nil
+}
+
+func newNetworkOutboundStage(stage string, start time.Time, err error) NetworkOutboundStage {
+	result := NetworkOutboundStage{
+		Stage:      stage,
+		Status:     networkOutboundStageSucceeded,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = networkOutboundStageFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func resolveNetworkOutbound(stage string, resolverName string, resolver *net.Resolver, host string) NetworkOutboundStage {
+	ctx, cancel := context.WithTimeout(context.Background(), networkOutboundDialTimeout)
+	defer cancel()
+
+	start := time.Now()
+	addresses, err := resolver.LookupHost(ctx, host)
+	result := newNetworkOutboundStage(stage, start, err)
+	result.Resolver = resolverName
+	result.Addresses = addresses
+
+	return result
+}
+
+// resolveNetworkOutboundWithNodeResolver resolves host against the first nameserver of the node resolv.conf,
+// following the systemd-resolved stub to its upstream nameservers
+func resolveNetworkOutboundWithNodeResolver(host string) NetworkOutboundStage {
+	nameservers := []string{}
+	if resolvConf, err := utils.ReadNodeResolvConf(); err == nil {
+		for _, nameserver := range resolvConf.Effective().Nameservers {
+			if !net.ParseIP(nameserver).IsLoopback() {
+				nameservers = append(nameservers, nameserver)
+			}
+		}
+	}
+
+	if len(nameservers) == 0 {
+		return NetworkOutboundStage{Stage: "dns-node", Status: networkOutboundStageSkipped, Error: "no node nameserver reachable from the pod network"}
+	}
+
+	nameserver := net.JoinHostPort(nameservers[0], "53")
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, nameserver)
+		},
+	}
+
+	return resolveNetworkOutbound("dns-node", nameserver, resolver, host)
+}
+
+func dialNetworkOutbound(address string) (NetworkOutboundStage, net.Conn) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, networkOutboundDialTimeout)
+	result := newNetworkOutboundStage("tcp", start, err)
+	result.Addresses = []string{address}
+
+	return result, conn
+}
+
+// connectNetworkOutbound asks the HTTP proxy to open a tunnel to target over the established connection
+func connectNetworkOutbound(conn net.Conn, proxyURL *url.URL, target string) NetworkOutboundStage {
+	start := time.Now()
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: http.Header{"User-Agent": []string{"aks-periscope"}},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(networkOutboundDialTimeout)); err != nil {
+		return newNetworkOutboundStage("connect", start, err)
+	}
+
+	if err := request.Write(conn); err != nil {
+		return newNetworkOutboundStage("connect", start, err)
+	}
+
+	// The proxy sends nothing beyond its response before the TLS client hello, so no tunnel data is buffered
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		return newNetworkOutboundStage("connect", start, err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("proxy returned %s", response.Status)
+	}
+
+	result := newNetworkOutboundStage("connect", start, err)
+	result.Addresses = []string{proxyURL.Host}
+	result.StatusCode = response.StatusCode
+
+	return result
+}
+
+// handshakeNetworkOutbound performs a TLS handshake with SNI set to host and validates the presented chain against
+// the system roots, the service account CA and trustedCA, recording the chain even when it is not trusted, e.g. when
+// re-signed by an intercepting proxy
+func handshakeNetworkOutbound(conn net.Conn, host string, trustedCA []byte) (NetworkOutboundStage, *tls.Conn) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if ca, err := ioutil.ReadFile(serviceAccountCAFile); err == nil {
+		roots.AppendCertsFromPEM(ca)
+	}
+	if len(trustedCA) > 0 {
+		roots.AppendCertsFromPEM(trustedCA)
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+
+	if err := conn.SetDeadline(time.Now().Add(networkOutboundDialTimeout)); err != nil {
+		return newNetworkOutboundStage("tls", time.Now(), err), nil
+	}
+
+	start := time.Now()
+	err = tlsConn.Handshake()
+	if err == nil {
+		err = verifyNetworkOutboundChain(tlsConn.ConnectionState().PeerCertificates, host, roots)
+	}
+
+	result := newNetworkOutboundStage("tls", start, err)
+	for _, certificate := range tlsConn.ConnectionState().PeerCertificates {
+		result.PeerCertificates = append(result.PeerCertificates, NetworkOutboundCertificate{
+			Subject:  certificate.Subject.String(),
+			Issuer:   certificate.Issuer.String(),
+			DNSNames: certificate.DNSNames,
+			NotAfter: certificate.NotAfter,
+		})
+	}
+
+	return result, tlsConn
+}
+
+func verifyNetworkOutboundChain(certificates []*x509.Certificate, host string, roots *x509.CertPool) error {
+	if len(certificates) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
+
+// requestNetworkOutbound sends an HTTP GET request over the established TLS connection
+func requestNetworkOutbound(conn *tls.Conn, host string, path string, expectedStatus int) NetworkOutboundStage {
+	start := time.Now()
+
+	request, err := http.NewRequest(http.MethodGet, "https://"+host+path, nil)
+	if err != nil {
+		return newNetworkOutboundStage("http", start, err)
+	}
+	request.Header.Set("User-Agent", "aks-periscope")
+	request.Close = true
+
+	if err := conn.SetDeadline(time.Now().Add(networkOutboundDialTimeout)); err != nil {
+		return newNetworkOutboundStage("http", start, err)
+	}
+
+	if err := request.Write(conn); err != nil {
+		return newNetworkOutboundStage("http", start, err)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		return newNetworkOutboundStage("http", start, err)
+	}
+	response.Body.Close()
+
+	if expectedStatus != 0 && response.StatusCode != expectedStatus {
+		err = fmt.Errorf("unexpected status %d, want %d", response.StatusCode, expectedStatus)
+	}
+
+	result := newNetworkOutboundStage("http", start, err)
+	result.StatusCode = response.StatusCode
+
+	return result
+}
+
+// probeNTP sends an NTP client request over UDP and waits for the server response
+func probeNTP(address string) error {
+	conn, err := net.DialTimeout("udp", address, networkOutboundDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(networkOutboundDialTimeout)); err != nil {
+		return err
+	}
+
+	// LI = 0, VN = 3, Mode = 3 (client)
+	request := make([]byte, 48)
+	request[0] = 0x1b
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	if err != nil {
+		return err
+	}
+
+	if n < 48 || response[0]&0x7 != 4 {
+		return fmt.Errorf("invalid NTP response from %s", address)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetworkOutboundProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    *networkOutboundProbe
+		wantErr bool
+	}{
+		{
+			name:   "tcp target",
+			target: "mcr.microsoft.com:443",
+			want:   &networkOutboundProbe{host: "mcr.microsoft.com", port: "443"},
+		},
+		{
+			name:   "tls target",
+			target: "tls://10.0.0.1:443",
+			want:   &networkOutboundProbe{host: "10.0.0.1", port: "443", tls: true},
+		},
+		{
+			name:   "https target with expected status",
+			target: "https://mcr.microsoft.com/v2/?x=1#200",
+			want:   &networkOutboundProbe{host: "mcr.microsoft.com", port: "443", tls: true, http: true, path: "/v2/?x=1", expectedStatus: 200},
+		},
+		{
+			name:    "tls target without port",
+			target:  "tls://mcr.microsoft.com",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported scheme",
+			target:  "http://mcr.microsoft.com",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNetworkOutboundProbe(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNetworkOutboundProbe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetworkOutboundProbe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkOutboundProbeStages(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "https://")
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatalf("SplitHostPort: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		probe           *networkOutboundProbe
+		wantFailedStage string
+		wantStages      []string
+	}{
+		{
+			name:            "tcp only",
+			probe:           &networkOutboundProbe{host: host, port: port},
+			wantFailedStage: "",
+			wantStages:      []string{"tcp"},
+		},
+		{
+			name:            "untrusted certificate",
+			probe:           &networkOutboundProbe{host: host, port: port, tls: true, http: true, path: "/"},
+			wantFailedStage: "tls",
+			wantStages:      []string{"tcp", "tls"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, failedStage, _ := tt.probe.run()
+			if failedStage != tt.wantFailedStage {
+				t.Errorf("run() failed stage = %q, want %q", failedStage, tt.wantFailedStage)
+			}
+
+			names := []string{}
+			for _, stage := range stages {
+				names = append(names, stage.Stage)
+			}
+			if !reflect.DeepEqual(names, tt.wantStages) {
+				t.Errorf("run() stages = %v, want %v", names, tt.wantStages)
+			}
+		})
+	}
+
+	tcpStage, conn := dialNetworkOutbound(address)
+	if conn == nil {
+		t.Fatalf("dial: %s", tcpStage.Error)
+	}
+	defer conn.Close()
+
+	tlsStage, tlsConn := handshakeNetworkOutbound(conn, host, nil)
+	if len(tlsStage.PeerCertificates) == 0 {
+		t.Fatalf("handshake did not record the presented certificates: %+v", tlsStage)
+	}
+
+	httpStage := requestNetworkOutbound(tlsConn, host, "/", http.StatusOK)
+	if httpStage.Status != networkOutboundStageFailed || httpStage.StatusCode != http.StatusUnauthorized {
+		t.Errorf("requestNetworkOutbound() = %+v, want a failed stage with status 401", httpStage)
+	}
+}
+
+// newTestConnectProxy starts an HTTP proxy tunnelling CONNECT requests to allowed targets only
+func newTestConnectProxy(t *testing.T, allowed string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				request, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || request.Method != http.MethodConnect || request.Host != allowed {
+					io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\n\r\n")
+					return
+				}
+
+				target, err := net.Dial("tcp", request.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer target.Close()
+
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}(conn)
+		}
+	}()
+
+	return listener
+}
+
+func TestNetworkOutboundProbeThroughProxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "https://")
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatalf("SplitHostPort: %v", err)
+	}
+
+	proxy := newTestConnectProxy(t, address)
+	defer proxy.Close()
+
+	proxyFunc := func(*url.URL) (*url.URL, error) {
+		return &url.URL{Scheme: "http", Host: proxy.Addr().String()}, nil
+	}
+	trustedCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	tests := []struct {
+		name            string
+		probe           *networkOutboundProbe
+		wantFailedStage string
+		wantStages      []string
+	}{
+		{
+			name:            "tunnel with trusted proxy CA",
+			probe:           &networkOutboundProbe{host: host, port: port, tls: true, http: true, path: "/", expectedStatus: http.StatusOK, proxy: proxyFunc, trustedCA: trustedCA},
+			wantFailedStage: "",
+			wantStages:      []string{"tcp", "connect", "tls", "http"},
+		},
+		{
+			name:            "tunnel denied by proxy",
+			probe:           &networkOutboundProbe{host: host, port: "1", tls: true, proxy: proxyFunc},
+			wantFailedStage: "connect",
+			wantStages:      []string{"tcp", "connect"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, failedStage, err := tt.probe.run()
+			if failedStage != tt.wantFailedStage {
+				t.Errorf("run() failed stage = %q, want %q, error = %v", failedStage, tt.wantFailedStage, err)
+			}
+
+			names := []string{}
+			for _, stage := range stages {
+				names = append(names, stage.Stage)
+			}
+			if !reflect.DeepEqual(names, tt.wantStages) {
+				t.Errorf("run() stages = %v, want %v", names, tt.wantStages)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const nodeLeaseNamespace = "kube-node-lease"
+
+// NodeLease defines the lease the kubelet renews as heartbeat of the node
+type NodeLease struct {
+	HolderIdentity       string    `json:"HolderIdentity"`
+	LeaseDurationSeconds int32     `json:"LeaseDurationSeconds"`
+	RenewTime            time.Time `json:"RenewTime"`
+	SinceRenewSeconds    float64   `json:"SinceRenewSeconds"`
+}
+
+// NodePodResources defines the resources a pod of the node requests and is limited to, in millicores and bytes
+type NodePodResources struct {
+	Namespace      string `json:"Namespace"`
+	Name           string `json:"Name"`
+	Phase          string `json:"Phase"`
+	QOSClass       string `json:"QOSClass"`
+	CPURequests    int64  `json:"CPURequests"`
+	CPULimits      int64  `json:"CPULimits"`
+	MemoryRequests int64  `json:"MemoryRequests"`
+	MemoryLimits   int64  `json:"MemoryLimits"`
+}
+
+// NodePodStatus defines the container statuses of a pod of the node, and the memory limits of its containers in bytes
+type NodePodStatus struct {
+	Namespace             string               `json:"Namespace"`
+	Name                  string               `json:"Name"`
+	UID                   types.UID            `json:"UID"`
+	MemoryLimits          map[string]int64     `json:"MemoryLimits"`
+	InitContainerStatuses []v1.ContainerStatus `json:"InitContainerStatuses,omitempty"`
+	ContainerStatuses     []v1.ContainerStatus `json:"ContainerStatuses"`
+}
+
+// NodeCollector defines a Node Collector struct
+type NodeCollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewNodeCollector is a constructor
+func NewNodeCollector(config *restclient.Config) *NodeCollector {
+	return &NodeCollector{
+		kubeconfig: config,
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *NodeCollector) GetName() string {
+	return "node"
+}
+
+// Collect implements the interface method
+func (collector *NodeCollector) Collect() error {
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	ctx := context.Background()
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	node, err := clientset.CoreV1().Nodes().Get(ctx, hostName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get node: %w", err)
+	}
+
+	node.ManagedFields = nil
+	dataBytes, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["node"] = string(dataBytes)
+
+	lease, err := clientset.CoordinationV1().Leases(nodeLeaseNamespace).Get(ctx, hostName, metav1.GetOptions{})
+	if err != nil {
+		collector.data["lease"] = "Failed to get lease: " + err.Error()
+	} else {
+		nodeLease := NodeLease{}
+		if lease.Spec.HolderIdentity != nil {
+			nodeLease.HolderIdentity = *lease.Spec.HolderIdentity
+		}
+		if lease.Spec.LeaseDurationSeconds != nil {
+			nodeLease.LeaseDurationSeconds = *lease.Spec.LeaseDurationSeconds
+		}
+		if lease.Spec.RenewTime != nil {
+			nodeLease.RenewTime = lease.Spec.RenewTime.Time
+			nodeLease.SinceRenewSeconds = time.Since(nodeLease.RenewTime).Seconds()
+		}
+
+		dataBytes, err := json.Marshal(nodeLease)
+		if err != nil {
+			return fmt.Errorf("marshal data: %w", err)
+		}
+		collector.data["lease"] = string(dataBytes)
+	}
+
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + hostName,
+	})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	podStatuses := []NodePodStatus{}
+	for i := range pods.Items {
+		podStatuses = append(podStatuses, GetNodePodStatus(&pods.Items[i]))
+	}
+
+	dataBytes, err = json.Marshal(podStatuses)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["node_podstatuses"] = string(dataBytes)
+
+	// Like kubectl describe node, terminated pods do not account for the resources of the node
+	podResources := []NodePodResources{}
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == v1.PodSucceeded || pods.Items[i].Status.Phase == v1.PodFailed {
+			continue
+		}
+		podResources = append(podResources, GetNodePodResources(&pods.Items[i]))
+	}
+
+	dataBytes, err = json.Marshal(podResources)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["node_pods"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *NodeCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// GetNodePodStatus returns the container statuses of a pod, which terminated containers keep until the pod is deleted
+func GetNodePodStatus(pod *v1.Pod) NodePodStatus {
+	memoryLimits := map[string]int64{}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			memoryLimits[container.Name] = container.Resources.Limits.Memory().Value()
+		}
+	}
+
+	return NodePodStatus{
+		Namespace:             pod.Namespace,
+		Name:                  pod.Name,
+		UID:                   pod.UID,
+		MemoryLimits:          memoryLimits,
+		InitContainerStatuses: pod.Status.InitContainerStatuses,
+		ContainerStatuses:     pod.Status.ContainerStatuses,
+	}
+}
+
+// GetNodePodResources computes the requests and limits of a pod the way the scheduler does: the sum of its containers,
+// or the largest of its init containers if greater, plus the pod overhead
+func GetNodePodResources(pod *v1.Pod) NodePodResources {
+	requests := v1.ResourceList{}
+	limits := v1.ResourceList{}
+
+	for _, container := range pod.Spec.Containers {
+		addResourceList(requests, container.Resources.Requests)
+		addResourceList(limits, container.Resources.Limits)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		maxResourceList(requests, container.Resources.Requests)
+		maxResourceList(limits, container.Resources.Limits)
+	}
+
+	if pod.Spec.Overhead != nil {
+		addResourceList(requests, pod.Spec.Overhead)
+		if len(limits) > 0 {
+			addResourceList(limits, pod.Spec.Overhead)
+		}
+	}
+
+	return NodePodResources{
+		Namespace:      pod.Namespace,
+		Name:           pod.Name,
+		Phase:          string(pod.Status.Phase),
+		QOSClass:       string(pod.Status.QOSClass),
+		CPURequests:    requests.Cpu().MilliValue(),
+		CPULimits:      limits.Cpu().MilliValue(),
+		MemoryRequests: requests.Memory().Value(),
+		MemoryLimits:   limits.Memory().Value(),
+	}
+}
+
+func addResourceList(list v1.ResourceList, added v1.ResourceList) {
+	for name, quantity := range added {
+		if value, ok := list[name]; ok {
+			value.Add(quantity)
+			list[name] = value
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func maxResourceList(list v1.ResourceList, other v1.ResourceList) {
+	for name, quantity := range other {
+		if value, ok := list[name]; !ok || quantity.Cmp(value) > 0 {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
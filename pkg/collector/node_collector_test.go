@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetNodePodResources(t *testing.T) {
+	resources := func(cpu string, memory string) v1.ResourceList {
+		list := v1.ResourceList{}
+		if cpu != "" {
+			list[v1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if memory != "" {
+			list[v1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return list
+	}
+
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want NodePodResources
+	}{
+		{
+			name: "sum of containers",
+			pod: &v1.Pod{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Resources: v1.ResourceRequirements{Requests: resources("100m", "128Mi"), Limits: resources("500m", "256Mi")}},
+						{Resources: v1.ResourceRequirements{Requests: resources("250m", "64Mi")}},
+					},
+				},
+			},
+			want: NodePodResources{CPURequests: 350, CPULimits: 500, MemoryRequests: 192 * 1024 * 1024, MemoryLimits: 256 * 1024 * 1024},
+		},
+		{
+			name: "larger init container and overhead",
+			pod: &v1.Pod{
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{
+						{Resources: v1.ResourceRequirements{Requests: resources("1", "64Mi")}},
+					},
+					Containers: []v1.Container{
+						{Resources: v1.ResourceRequirements{Requests: resources("100m", "128Mi")}},
+					},
+					Overhead: resources("50m", "16Mi"),
+				},
+			},
+			want: NodePodResources{CPURequests: 1050, MemoryRequests: 144 * 1024 * 1024},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pod.ObjectMeta = metav1.ObjectMeta{Namespace: "default", Name: "web-0"}
+			tt.want.Namespace = "default"
+			tt.want.Name = "web-0"
+
+			if got := GetNodePodResources(tt.pod); got != tt.want {
+				t.Errorf("GetNodePodResources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNodePodStatus(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0", UID: "5f0c5b3e"},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init"}},
+			Containers: []v1.Container{
+				{Name: "web", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")}}},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			ContainerStatuses: []v1.ContainerStatus{{Name: "web", RestartCount: 3}},
+		},
+	}
+
+	got := GetNodePodStatus(pod)
+	if got.UID != "5f0c5b3e" || got.MemoryLimits["web"] != 256*1024*1024 || got.MemoryLimits["init"] != 0 || len(got.ContainerStatuses) != 1 || got.ContainerStatuses[0].RestartCount != 3 {
+		t.Errorf("GetNodePodStatus() = %+v, want the UID, memory limits and container statuses of the pod", got)
+	}
+}
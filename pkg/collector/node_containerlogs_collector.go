@@ -0,0 +1,402 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// podLogsDir is where the kubelet stores the logs of the containers of the node, mounted from the host /var/log
+const podLogsDir = "/var/log/pods"
+
+// localPodFields lists the pod fields field selectors can match without the API server
+var localPodFields = map[string]bool{
+	"metadata.name":      true,
+	"metadata.namespace": true,
+	"spec.nodeName":      true,
+}
+
+// NodeContainerLog defines a container whose logs are read from the node filesystem
+type NodeContainerLog struct {
+	Namespace      string   `json:"namespace"`
+	Name           string   `json:"name"`
+	UID            string   `json:"uid"`
+	ContainerName  string   `json:"containerName"`
+	Files          []string `json:"files"`
+	LogKey         string   `json:"logKey"`
+	PreviousFiles  []string `json:"previousFiles,omitempty"`
+	PreviousLogKey string   `json:"previousLogKey,omitempty"`
+}
+
+// criLogEntry defines a line of a container log file in the CRI format
+type criLogEntry struct {
+	timestamp time.Time
+	stream    string
+	partial   bool
+	message   string
+}
+
+// NodeContainerLogsCollector defines a Node Container Logs Collector struct
+type NodeContainerLogsCollector struct {
+	data map[string]string
+}
+
+// NewNodeContainerLogsCollector is a constructor
+func NewNodeContainerLogsCollector() *NodeContainerLogsCollector {
+	return &NodeContainerLogsCollector{
+		data: make(map[string]string),
+	}
+}
+
+func (collector *NodeContainerLogsCollector) GetName() string {
+	return "nodecontainerlogs"
+}
+
+// Collect implements the interface method
+func (collector *NodeContainerLogsCollector) Collect() error {
+	selectors := strings.Fields(os.Getenv("DIAGNOSTIC_CONTAINERLOGS_LIST"))
+
+	logOptions, err := getContainerLogOptions()
+	if err != nil {
+		return err
+	}
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	podDirs, err := ioutil.ReadDir(podLogsDir)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", podLogsDir, err)
+	}
+	sortNewestPodLogDirs(podDirs)
+
+	now := time.Now()
+	containerLogs := []NodeContainerLog{}
+	manifest := []ContainerLogsSelectorResult{}
+	collected := map[string]bool{}
+
+	for _, value := range selectors {
+		result := ContainerLogsSelectorResult{Selector: value}
+
+		selector, err := parseContainerLogsSelector(value, hostName)
+		if err == nil {
+			err = selector.validateLocal()
+		}
+		if err != nil {
+			result.Error = err.Error()
+			manifest = append(manifest, result)
+			continue
+		}
+
+		for _, podDir := range podDirs {
+			// Pod log directories are named <namespace>_<pod>_<uid>, none of which may contain an underscore
+			parts := strings.Split(podDir.Name(), "_")
+			if !podDir.IsDir() || len(parts) != 3 || !selector.matchesLocal(parts[0], parts[1], hostName) {
+				continue
+			}
+
+			containerDirs, err := ioutil.ReadDir(filepath.Join(podLogsDir, podDir.Name()))
+			if err != nil {
+				log.Printf("Read pod log directory %s failed: %v", podDir.Name(), err)
+				continue
+			}
+
+			matched := false
+			for _, containerDir := range containerDirs {
+				if !containerDir.IsDir() || (selector.container != "" && containerDir.Name() != selector.container) {
+					continue
+				}
+				matched = true
+				result.Containers++
+
+				// Selectors may overlap, the logs of a container are only collected once
+				containerDirPath := filepath.Join(podLogsDir, podDir.Name(), containerDir.Name())
+				if collected[containerDirPath] {
+					continue
+				}
+				collected[containerDirPath] = true
+
+				containerLog := NodeContainerLog{
+					Namespace:     parts[0],
+					Name:          parts[1],
+					UID:           parts[2],
+					ContainerName: containerDir.Name(),
+					LogKey:        parts[0] + "_" + parts[1] + "_" + containerDir.Name(),
+				}
+				// A pod recreated with the same name, such as a StatefulSet pod, keeps the log directory of the previous
+				// pod until it is removed. The newest pod comes first and gets the usual key, older ones their UID
+				if _, ok := collector.data[containerLog.LogKey]; ok {
+					containerLog.LogKey += "_" + containerLog.UID
+				}
+
+				containerLog.Files, containerLog.PreviousFiles, err = getContainerLogFiles(containerDirPath)
+				if err != nil {
+					log.Printf("List container log files of %s failed: %v", containerLog.LogKey, err)
+				}
+
+				collector.data[containerLog.LogKey] = readCRILogFiles(containerLog.Files, logOptions, now)
+				if len(containerLog.PreviousFiles) > 0 {
+					containerLog.PreviousLogKey = containerLog.LogKey + "_previous"
+					collector.data[containerLog.PreviousLogKey] = readCRILogFiles(containerLog.PreviousFiles, logOptions, now)
+				}
+
+				containerLogs = append(containerLogs, containerLog)
+			}
+
+			if matched {
+				result.Pods++
+			}
+		}
+
+		manifest = append(manifest, result)
+	}
+
+	data, err := json.Marshal(containerLogs)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["nodecontainerlogs_containers"] = string(data)
+
+	data, err = json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	collector.data["nodecontainerlogs_manifest"] = string(data)
+
+	return nil
+}
+
+func (collector *NodeContainerLogsCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// sortNewestPodLogDirs sorts pod log directories from the most recently modified, so the current pod of a name comes
+// before the pods it replaced
+func sortNewestPodLogDirs(podDirs []os.FileInfo) {
+	sort.SliceStable(podDirs, func(i, j int) bool { return podDirs[i].ModTime().After(podDirs[j].ModTime()) })
+}
+
+// validateLocal returns an error when the selector needs the API server, the labels and status of pods not being on
+// the node filesystem
+func (selector *containerLogsSelector) validateLocal() error {
+	if selector.labelSelector != "" {
+		return fmt.Errorf("label selectors cannot be matched from the node filesystem")
+	}
+
+	if selector.fieldSelector == "" {
+		return nil
+	}
+
+	fieldSelector, err := fields.ParseSelector(selector.fieldSelector)
+	if err != nil {
+		return err
+	}
+
+	for _, requirement := range fieldSelector.Requirements() {
+		if !localPodFields[requirement.Field] {
+			return fmt.Errorf("field %s cannot be matched from the node filesystem", requirement.Field)
+		}
+	}
+
+	return nil
+}
+
+// matchesLocal returns true when the selector matches a pod of the node, from its namespace and name
+func (selector *containerLogsSelector) matchesLocal(namespace string, pod string, hostName string) bool {
+	if (selector.namespace != "" && selector.namespace != namespace) || (selector.pod != "" && selector.pod != pod) {
+		return false
+	}
+
+	if selector.fieldSelector == "" {
+		return true
+	}
+
+	fieldSelector, err := fields.ParseSelector(selector.fieldSelector)
+	if err != nil {
+		return false
+	}
+
+	return fieldSelector.Matches(fields.Set{
+		"metadata.name":      pod,
+		"metadata.namespace": namespace,
+		"spec.nodeName":      hostName,
+	})
+}
+
+// getContainerLogFiles returns the log files of the current and previous instances of a container, named
+// <restart count>.log by the kubelet, each preceded by its uncompressed rotated files <restart count>.log.<timestamp>
+func getContainerLogFiles(containerDir string) ([]string, []string, error) {
+	files, err := ioutil.ReadDir(containerDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filesByRestart := map[int][]string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasSuffix(name, ".gz") || !strings.Contains(name, ".log") {
+			continue
+		}
+
+		restart, err := strconv.Atoi(name[:strings.Index(name, ".log")])
+		if err != nil {
+			continue
+		}
+		filesByRestart[restart] = append(filesByRestart[restart], filepath.Join(containerDir, name))
+	}
+
+	restarts := []int{}
+	for restart, paths := range filesByRestart {
+		// Rotated files sort by their timestamp, before the file being written to
+		sort.Slice(paths, func(i, j int) bool {
+			if strings.HasSuffix(paths[i], ".log") != strings.HasSuffix(paths[j], ".log") {
+				return strings.HasSuffix(paths[j], ".log")
+			}
+			return paths[i] < paths[j]
+		})
+		restarts = append(restarts, restart)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(restarts)))
+
+	var current, previous []string
+	if len(restarts) > 0 {
+		current = filesByRestart[restarts[0]]
+	}
+	if len(restarts) > 1 {
+		previous = filesByRestart[restarts[1]]
+	}
+
+	return current, previous, nil
+}
+
+// readCRILogFiles reads container log files in the CRI format, honoring the time window, lines and bytes of the log
+// options the way the kubelet does
+func readCRILogFiles(paths []string, logOptions *v1.PodLogOptions, now time.Time) string {
+	entries := []criLogEntry{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Open container log file %s failed: %v", path, err)
+			continue
+		}
+
+		fileEntries, err := parseCRILogs(file)
+		file.Close()
+		if err != nil {
+			log.Printf("Read container log file %s failed: %v", path, err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	if logOptions.SinceSeconds != nil {
+		since := now.Add(-time.Duration(*logOptions.SinceSeconds) * time.Second)
+		start := sort.Search(len(entries), func(i int) bool { return !entries[i].timestamp.Before(since) })
+		entries = entries[start:]
+	}
+
+	if logOptions.TailLines != nil && int64(len(entries)) > *logOptions.TailLines {
+		entries = entries[int64(len(entries))-*logOptions.TailLines:]
+	}
+
+	var builder strings.Builder
+	for _, entry := range entries {
+		line := entry.message + "\n"
+		if logOptions.Timestamps {
+			line = entry.timestamp.Format(time.RFC3339Nano) + " " + entry.stream + " " + line
+		}
+
+		if logOptions.LimitBytes != nil && int64(builder.Len()+len(line)) > *logOptions.LimitBytes {
+			builder.WriteString(line[:*logOptions.LimitBytes-int64(builder.Len())])
+			break
+		}
+		builder.WriteString(line)
+	}
+
+	return builder.String()
+}
+
+// parseCRILogs parses the lines of a container log file, joining the partial lines the runtime split long lines into
+func parseCRILogs(reader io.Reader) ([]criLogEntry, error) {
+	entries := []criLogEntry{}
+	partials := map[string]*criLogEntry{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, err := parseCRILogLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		if partial, ok := partials[entry.stream]; ok {
+			partial.message += entry.message
+			partial.partial = entry.partial
+			entry = partial
+		}
+
+		if entry.partial {
+			partials[entry.stream] = entry
+			continue
+		}
+
+		delete(partials, entry.stream)
+		entries = append(entries, *entry)
+	}
+
+	// The runtime is still writing the last line
+	for _, partial := range partials {
+		entries = append(entries, *partial)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].timestamp.Before(entries[j].timestamp) })
+
+	return entries, scanner.Err()
+}
+
+// parseCRILogLine parses a <timestamp> <stream> <tags> <message> line, the P tag marking a partial line
+func parseCRILogLine(line string) (*criLogEntry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("CRI log line %q has too few fields", line)
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse CRI log timestamp: %w", err)
+	}
+
+	if fields[1] != "stdout" && fields[1] != "stderr" {
+		return nil, fmt.Errorf("CRI log line has unknown stream %q", fields[1])
+	}
+
+	entry := &criLogEntry{
+		timestamp: timestamp,
+		stream:    fields[1],
+	}
+
+	for _, tag := range strings.Split(fields[2], ":") {
+		if tag == "P" {
+			entry.partial = true
+		}
+	}
+
+	if len(fields) == 4 {
+		entry.message = fields[3]
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseCRILogs(t *testing.T) {
+	content := `2021-10-01T12:00:00.000000001Z stdout F starting
+2021-10-01T12:00:01.000000000Z stderr P a long
+2021-10-01T12:00:01.000000001Z stdout F interleaved
+2021-10-01T12:00:01.000000002Z stderr F  error line
+not a CRI log line
+2021-10-01T12:00:02Z stdout F
+2021-10-01T12:00:03Z stdout P still being
+`
+
+	entries, err := parseCRILogs(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseCRILogs() error = %v", err)
+	}
+
+	want := []struct {
+		stream  string
+		message string
+		partial bool
+	}{
+		{stream: "stdout", message: "starting"},
+		{stream: "stderr", message: "a long error line"},
+		{stream: "stdout", message: "interleaved"},
+		{stream: "stdout", message: ""},
+		{stream: "stdout", message: "still being", partial: true},
+	}
+
+	if len(entries) != len(want) {
+		t.Fatalf("parseCRILogs() = %+v, want %d entries", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.stream != want[i].stream || entry.message != want[i].message || entry.partial != want[i].partial {
+			t.Errorf("parseCRILogs()[%d] = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestReadCRILogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podlogs")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rotated := filepath.Join(dir, "0.log.20211001-120000")
+	current := filepath.Join(dir, "0.log")
+	if err := ioutil.WriteFile(rotated, []byte("2021-10-01T11:00:00Z stdout F one\n2021-10-01T11:30:00Z stdout F two\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := ioutil.WriteFile(current, []byte("2021-10-01T11:50:00Z stderr F three\n2021-10-01T11:59:00Z stdout F four\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	int64Ptr := func(value int64) *int64 { return &value }
+
+	tests := []struct {
+		name       string
+		logOptions *v1.PodLogOptions
+		want       string
+	}{
+		{
+			name:       "all lines",
+			logOptions: &v1.PodLogOptions{},
+			want:       "one\ntwo\nthree\nfour\n",
+		},
+		{
+			name:       "tail lines across rotated files",
+			logOptions: &v1.PodLogOptions{TailLines: int64Ptr(3)},
+			want:       "two\nthree\nfour\n",
+		},
+		{
+			name:       "since seconds",
+			logOptions: &v1.PodLogOptions{SinceSeconds: int64Ptr(15 * 60)},
+			want:       "three\nfour\n",
+		},
+		{
+			name:       "limit bytes",
+			logOptions: &v1.PodLogOptions{LimitBytes: int64Ptr(6)},
+			want:       "one\ntw",
+		},
+		{
+			name:       "timestamps",
+			logOptions: &v1.PodLogOptions{Timestamps: true, TailLines: int64Ptr(1)},
+			want:       "2021-10-01T11:59:00Z stdout four\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readCRILogFiles([]string{rotated, current}, tt.logOptions, now); got != tt.want {
+				t.Errorf("readCRILogFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetContainerLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podlogs")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"0.log", "1.log.20211001-120000.gz", "1.log.20211001-130000", "1.log", "2.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	current, previous, err := getContainerLogFiles(dir)
+	if err != nil {
+		t.Fatalf("getContainerLogFiles() error = %v", err)
+	}
+
+	if want := []string{filepath.Join(dir, "2.log")}; !reflect.DeepEqual(current, want) {
+		t.Errorf("getContainerLogFiles() current = %v, want %v", current, want)
+	}
+	if want := []string{filepath.Join(dir, "1.log.20211001-130000"), filepath.Join(dir, "1.log")}; !reflect.DeepEqual(previous, want) {
+		t.Errorf("getContainerLogFiles() previous = %v, want %v", previous, want)
+	}
+}
+
+func TestSortNewestPodLogDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podlogs")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	podDirs := map[string]time.Time{
+		"default_web-0_5d3b7a4e-0000-0000-0000-000000000001":         now.Add(-2 * time.Hour),
+		"default_web-0_5d3b7a4e-0000-0000-0000-000000000002":         now,
+		"kube-system_coredns-a_5d3b7a4e-0000-0000-0000-000000000003": now.Add(-1 * time.Hour),
+	}
+	for name, modTime := range podDirs {
+		path := filepath.Join(dir, name)
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	sortNewestPodLogDirs(infos)
+
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+
+	want := []string{
+		"default_web-0_5d3b7a4e-0000-0000-0000-000000000002",
+		"kube-system_coredns-a_5d3b7a4e-0000-0000-0000-000000000003",
+		"default_web-0_5d3b7a4e-0000-0000-0000-000000000001",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortNewestPodLogDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestContainerLogsSelectorMatchesLocal(t *testing.T) {
+	tests := []struct {
+		selector    string
+		namespace   string
+		pod         string
+		want        bool
+		wantInvalid bool
+	}{
+		{selector: "kube-system", namespace: "kube-system", pod: "coredns-abc", want: true},
+		{selector: "kube-system", namespace: "default", pod: "coredns-abc", want: false},
+		{selector: "*/coredns-abc", namespace: "kube-system", pod: "coredns-abc", want: true},
+		{selector: "*?fieldSelector=spec.nodeName={node}", namespace: "default", pod: "app", want: true},
+		{selector: "*?fieldSelector=metadata.namespace!=kube-system", namespace: "kube-system", pod: "coredns-abc", want: false},
+		{selector: "default?fieldSelector=status.phase!=Running", wantInvalid: true},
+		{selector: "default?labelSelector=app=web", wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		selector, err := parseContainerLogsSelector(tt.selector, "aks-nodepool1-0")
+		if err != nil {
+			t.Fatalf("parseContainerLogsSelector(%q) error = %v", tt.selector, err)
+		}
+
+		if err := selector.validateLocal(); (err != nil) != tt.wantInvalid {
+			t.Errorf("validateLocal() of %q error = %v, wantInvalid %v", tt.selector, err, tt.wantInvalid)
+			continue
+		}
+		if tt.wantInvalid {
+			continue
+		}
+
+		if got := selector.matchesLocal(tt.namespace, tt.pod, "aks-nodepool1-0"); got != tt.want {
+			t.Errorf("matchesLocal() of %q for %s/%s = %v, want %v", tt.selector, tt.namespace, tt.pod, got, tt.want)
+		}
+	}
+}
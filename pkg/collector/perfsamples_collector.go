@@ -0,0 +1,489 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	defaultPerfSamplesInterval = 5 * time.Second
+	// diskSectorBytes defines the size of the sectors /proc/diskstats counts, whatever the sector size of the disk
+	diskSectorBytes = 512
+)
+
+// wholeDiskRegex matches the disks of /proc/diskstats, but not their partitions
+var wholeDiskRegex = regexp.MustCompile(`^(sd[a-z]+|vd[a-z]+|xvd[a-z]+|nvme[0-9]+n[0-9]+)$`)
+
+// NodePerfSample defines the CPU, memory, network and disk IO usage of the node over a sampling interval
+type NodePerfSample struct {
+	TimeStamp               time.Time `json:"TimeStamp"`
+	CPUPercent              float64   `json:"CPUPercent"`
+	LoadAverage             float64   `json:"LoadAverage"`
+	MemoryUsedBytes         int64     `json:"MemoryUsedBytes"`
+	MemoryTotalBytes        int64     `json:"MemoryTotalBytes"`
+	MemoryPercent           float64   `json:"MemoryPercent"`
+	NetworkRxBytesPerSecond float64   `json:"NetworkRxBytesPerSecond"`
+	NetworkTxBytesPerSecond float64   `json:"NetworkTxBytesPerSecond"`
+	DiskReadBytesPerSecond  float64   `json:"DiskReadBytesPerSecond"`
+	DiskWriteBytesPerSecond float64   `json:"DiskWriteBytesPerSecond"`
+}
+
+// ContainerPerfSample defines the CPU (millicores) and memory (bytes) usage of a container at a point in time
+type ContainerPerfSample struct {
+	TimeStamp time.Time `json:"TimeStamp"`
+	PodMetrics
+}
+
+// PodNetworkPerfSample defines the network usage of a pod, shared by its containers, over a sampling interval
+type PodNetworkPerfSample struct {
+	TimeStamp        time.Time `json:"TimeStamp"`
+	Namespace        string    `json:"Namespace"`
+	PodName          string    `json:"PodName"`
+	RxBytesPerSecond float64   `json:"RxBytesPerSecond"`
+	TxBytesPerSecond float64   `json:"TxBytesPerSecond"`
+}
+
+// hostPerfCounters defines the cumulative counters of the node /proc files at a point in time
+type hostPerfCounters struct {
+	timeStamp       time.Time
+	cpuTotal        uint64
+	cpuIdle         uint64
+	loadAverage     float64
+	memoryTotal     int64
+	memoryAvailable int64
+	rxBytes         uint64
+	txBytes         uint64
+	readBytes       uint64
+	writeBytes      uint64
+}
+
+// podNetworkCounters defines the cumulative network counters of a pod at a point in time
+type podNetworkCounters struct {
+	timeStamp time.Time
+	rxBytes   uint64
+	txBytes   uint64
+}
+
+// PerfSamplesCollector defines a Perf Samples Collector struct
+type PerfSamplesCollector struct {
+	kubeconfig *restclient.Config
+	interval   time.Duration
+	data       map[string]string
+}
+
+// NewPerfSamplesCollector is a constructor
+func NewPerfSamplesCollector(config *restclient.Config) *PerfSamplesCollector {
+	return &PerfSamplesCollector{
+		kubeconfig: config,
+		interval:   defaultPerfSamplesInterval,
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *PerfSamplesCollector) GetName() string {
+	return "perfsamples"
+}
+
+// GetInterval returns the interval between two samples
+func (collector *PerfSamplesCollector) GetInterval() time.Duration {
+	return collector.interval
+}
+
+// Collect implements the interface method
+func (collector *PerfSamplesCollector) Collect() error {
+	// Sampling is optional, it keeps the collector running for the whole duration
+	duration, err := getDurationFromEnv("DIAGNOSTIC_PERFSAMPLES_DURATION", 0)
+	if err != nil {
+		return err
+	}
+
+	if duration == 0 {
+		return nil
+	}
+
+	collector.interval, err = getDurationFromEnv("DIAGNOSTIC_PERFSAMPLES_INTERVAL", defaultPerfSamplesInterval)
+	if err != nil {
+		return err
+	}
+
+	if collector.interval == 0 {
+		return fmt.Errorf("DIAGNOSTIC_PERFSAMPLES_INTERVAL must be positive")
+	}
+
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + hostName,
+	})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	nodeSamples := []NodePerfSample{}
+	containerSamples := []ContainerPerfSample{}
+	podNetworkSamples := []PodNetworkPerfSample{}
+
+	var previousHost *hostPerfCounters
+	previousPods := map[string]podNetworkCounters{}
+
+	ticker := time.NewTicker(collector.interval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(duration)
+	for {
+		now := time.Now().Truncate(1 * time.Second)
+
+		// Rates need two readings of the counters, so the first reading yields no node sample
+		if host, err := readHostPerfCounters(now); err != nil {
+			log.Printf("Read host performance counters failed: %v", err)
+		} else {
+			if previousHost != nil {
+				nodeSamples = append(nodeSamples, getNodePerfSample(previousHost, host))
+			}
+			previousHost = host
+		}
+
+		if output, err := getKubeletStatsSummary(clientset, hostName); err != nil {
+			log.Printf("Get kubelet stats summary failed: %v", err)
+		} else {
+			containers, networks, err := getPodPerfSamples(output, now, previousPods)
+			if err != nil {
+				log.Printf("Parse kubelet stats summary failed: %v", err)
+			}
+
+			podMetrics := make([]PodMetrics, len(containers))
+			for i := range containers {
+				podMetrics[i] = containers[i].PodMetrics
+			}
+			joinPodMetricsResources(podMetrics, pods.Items)
+			for i := range containers {
+				containers[i].PodMetrics = podMetrics[i]
+			}
+
+			containerSamples = append(containerSamples, containers...)
+			podNetworkSamples = append(podNetworkSamples, networks...)
+		}
+
+		if time.Now().Add(collector.interval).After(deadline) {
+			break
+		}
+		<-ticker.C
+	}
+
+	for name, samples := range map[string]interface{}{
+		"perfsamples_node":        nodeSamples,
+		"perfsamples_containers":  containerSamples,
+		"perfsamples_podsnetwork": podNetworkSamples,
+	} {
+		ndjson, csv, err := formatPerfSamples(samples)
+		if err != nil {
+			return err
+		}
+		collector.data[name] = ndjson
+		collector.data[name+"_csv"] = csv
+	}
+
+	return nil
+}
+
+func (collector *PerfSamplesCollector) GetData() map[string]string {
+	return collector.data
+}
+
+// readHostPerfCounters reads the CPU, load, memory, network and disk IO counters of the node
+func readHostPerfCounters(now time.Time) (*hostPerfCounters, error) {
+	files := map[string]string{}
+	for _, file := range []string{"/proc/stat", "/proc/loadavg", "/proc/meminfo", "/proc/net/dev", "/proc/diskstats"} {
+		output, err := utils.RunCommandOnHost("cat", file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+		files[file] = output
+	}
+
+	counters := &hostPerfCounters{timeStamp: now}
+	counters.cpuTotal, counters.cpuIdle = parseProcStatCPU(files["/proc/stat"])
+
+	if fields := strings.Fields(files["/proc/loadavg"]); len(fields) > 0 {
+		counters.loadAverage, _ = strconv.ParseFloat(fields[0], 64)
+	}
+
+	meminfo := parseMeminfo(files["/proc/meminfo"])
+	counters.memoryTotal = meminfo["MemTotal"]
+	counters.memoryAvailable = meminfo["MemAvailable"]
+
+	counters.rxBytes, counters.txBytes = parseNetDev(files["/proc/net/dev"])
+	counters.readBytes, counters.writeBytes = parseDiskstats(files["/proc/diskstats"])
+
+	return counters, nil
+}
+
+// getNodePerfSample computes the usage of the node between two readings of its counters
+func getNodePerfSample(previous *hostPerfCounters, current *hostPerfCounters) NodePerfSample {
+	sample := NodePerfSample{
+		TimeStamp:        current.timeStamp,
+		LoadAverage:      current.loadAverage,
+		MemoryUsedBytes:  current.memoryTotal - current.memoryAvailable,
+		MemoryTotalBytes: current.memoryTotal,
+	}
+
+	if current.memoryTotal > 0 {
+		sample.MemoryPercent = float64(sample.MemoryUsedBytes) / float64(current.memoryTotal) * 100
+	}
+
+	if total := utils.GetCounterIncrease(previous.cpuTotal, current.cpuTotal); total > 0 {
+		idle := utils.GetCounterIncrease(previous.cpuIdle, current.cpuIdle)
+		sample.CPUPercent = float64(total-idle) / float64(total) * 100
+	}
+
+	if seconds := current.timeStamp.Sub(previous.timeStamp).Seconds(); seconds > 0 {
+		sample.NetworkRxBytesPerSecond = float64(utils.GetCounterIncrease(previous.rxBytes, current.rxBytes)) / seconds
+		sample.NetworkTxBytesPerSecond = float64(utils.GetCounterIncrease(previous.txBytes, current.txBytes)) / seconds
+		sample.DiskReadBytesPerSecond = float64(utils.GetCounterIncrease(previous.readBytes, current.readBytes)) / seconds
+		sample.DiskWriteBytesPerSecond = float64(utils.GetCounterIncrease(previous.writeBytes, current.writeBytes)) / seconds
+	}
+
+	return sample
+}
+
+// getPodPerfSamples converts a kubelet stats summary to container samples, and to pod network samples computed from
+// the previous counters of the pods, which it updates
+func getPodPerfSamples(output []byte, now time.Time, previousPods map[string]podNetworkCounters) ([]ContainerPerfSample, []PodNetworkPerfSample, error) {
+	var summary kubeletStatsSummary
+	if err := json.Unmarshal(output, &summary); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal stats summary: %w", err)
+	}
+
+	containers := []ContainerPerfSample{}
+	networks := []PodNetworkPerfSample{}
+	for _, pod := range summary.Pods {
+		for _, container := range pod.Containers {
+			containers = append(containers, ContainerPerfSample{
+				TimeStamp: now,
+				PodMetrics: PodMetrics{
+					Namespace:     pod.PodRef.Namespace,
+					PodName:       pod.PodRef.Name,
+					ContainerName: container.Name,
+					CPUUsage:      getKubeletCPUUsage(container.CPU),
+					MemoryUsage:   getKubeletMemoryUsage(container.Memory),
+				},
+			})
+		}
+
+		if pod.Network == nil || pod.Network.RxBytes == nil || pod.Network.TxBytes == nil {
+			continue
+		}
+
+		key := pod.PodRef.Namespace + "/" + pod.PodRef.Name
+		current := podNetworkCounters{timeStamp: now, rxBytes: *pod.Network.RxBytes, txBytes: *pod.Network.TxBytes}
+		if previous, ok := previousPods[key]; ok {
+			if seconds := now.Sub(previous.timeStamp).Seconds(); seconds > 0 {
+				networks = append(networks, PodNetworkPerfSample{
+					TimeStamp:        now,
+					Namespace:        pod.PodRef.Namespace,
+					PodName:          pod.PodRef.Name,
+					RxBytesPerSecond: float64(utils.GetCounterIncrease(previous.rxBytes, current.rxBytes)) / seconds,
+					TxBytesPerSecond: float64(utils.GetCounterIncrease(previous.txBytes, current.txBytes)) / seconds,
+				})
+			}
+		}
+		previousPods[key] = current
+	}
+
+	return containers, networks, nil
+}
+
+// parseProcStatCPU returns the total and idle (including IO wait) jiffies of all CPUs from /proc/stat
+func parseProcStatCPU(output string) (uint64, uint64) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var total, idle uint64
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			// Guest time is already accounted in user time
+			if i >= 8 {
+				break
+			}
+			total += value
+			// idle and iowait
+			if i == 3 || i == 4 {
+				idle += value
+			}
+		}
+		return total, idle
+	}
+
+	return 0, 0
+}
+
+// parseMeminfo returns the fields of /proc/meminfo, in bytes
+func parseMeminfo(output string) map[string]int64 {
+	meminfo := map[string]int64{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(strings.Replace(line, ":", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		meminfo[fields[0]] = value
+	}
+
+	return meminfo
+}
+
+// parseNetDev returns the bytes received and sent by the eth interfaces of /proc/net/dev, the pod interfaces of the
+// host network namespace would count the traffic of the pods twice
+func parseNetDev(output string) (uint64, uint64) {
+	var rx, tx uint64
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 || !strings.HasPrefix(strings.TrimSpace(line[:i]), "eth") {
+			continue
+		}
+
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 9 {
+			continue
+		}
+
+		if value, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			rx += value
+		}
+		if value, err := strconv.ParseUint(fields[8], 10, 64); err == nil {
+			tx += value
+		}
+	}
+
+	return rx, tx
+}
+
+// parseDiskstats returns the bytes read and written by the disks of /proc/diskstats, partitions being already
+// accounted by their disk
+func parseDiskstats(output string) (uint64, uint64) {
+	var read, written uint64
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || !wholeDiskRegex.MatchString(fields[2]) {
+			continue
+		}
+
+		if value, err := strconv.ParseUint(fields[5], 10, 64); err == nil {
+			read += value * diskSectorBytes
+		}
+		if value, err := strconv.ParseUint(fields[9], 10, 64); err == nil {
+			written += value * diskSectorBytes
+		}
+	}
+
+	return read, written
+}
+
+// formatPerfSamples writes a slice of samples as one JSON object per line, and as CSV with the JSON fields as columns
+func formatPerfSamples(samples interface{}) (string, string, error) {
+	value := reflect.ValueOf(samples)
+	if value.Kind() != reflect.Slice {
+		return "", "", fmt.Errorf("format samples of kind %s", value.Kind())
+	}
+
+	columns := getJSONColumns(value.Type().Elem())
+
+	var ndjson strings.Builder
+	var table bytes.Buffer
+	writer := csv.NewWriter(&table)
+	if err := writer.Write(columns); err != nil {
+		return "", "", fmt.Errorf("write csv: %w", err)
+	}
+
+	for i := 0; i < value.Len(); i++ {
+		dataBytes, err := json.Marshal(value.Index(i).Interface())
+		if err != nil {
+			return "", "", fmt.Errorf("marshal data: %w", err)
+		}
+		ndjson.Write(dataBytes)
+		ndjson.WriteString("\n")
+
+		decoder := json.NewDecoder(bytes.NewReader(dataBytes))
+		decoder.UseNumber()
+		fields := map[string]interface{}{}
+		if err := decoder.Decode(&fields); err != nil {
+			return "", "", fmt.Errorf("unmarshal data: %w", err)
+		}
+
+		// Fields omitted when empty are left blank
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			if field, ok := fields[column]; ok {
+				row[j] = fmt.Sprint(field)
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return "", "", fmt.Errorf("write csv: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", "", fmt.Errorf("write csv: %w", err)
+	}
+
+	return ndjson.String(), table.String(), nil
+}
+
+// getJSONColumns returns the JSON names of the fields of a struct, including the fields of its embedded structs
+func getJSONColumns(structType reflect.Type) []string {
+	columns := []string{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, getJSONColumns(field.Type)...)
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+
+	return columns
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseHostPerfCounters(t *testing.T) {
+	total, idle := parseProcStatCPU(`cpu  100 10 50 700 40 0 5 0 20 0
+cpu0 50 5 25 350 20 0 2 0 10 0
+intr 12345
+`)
+	if total != 905 || idle != 740 {
+		t.Errorf("parseProcStatCPU() = %d, %d, want 905, 740", total, idle)
+	}
+
+	meminfo := parseMeminfo(`MemTotal:        8000000 kB
+MemAvailable:    2000000 kB
+HugePages_Total:       0
+`)
+	want := map[string]int64{"MemTotal": 8000000 * 1024, "MemAvailable": 2000000 * 1024, "HugePages_Total": 0}
+	if !reflect.DeepEqual(meminfo, want) {
+		t.Errorf("parseMeminfo() = %v, want %v", meminfo, want)
+	}
+
+	rx, tx := parseNetDev(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 5000      50    0    0    0     0          0         0     5000      50    0    0    0     0       0          0
+  eth0: 1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+azv1234: 700       7    0    0    0     0          0         0      800       8    0    0    0     0       0          0
+`)
+	if rx != 1000 || tx != 2000 {
+		t.Errorf("parseNetDev() = %d, %d, want 1000, 2000", rx, tx)
+	}
+
+	read, written := parseDiskstats(`   8       0 sda 100 0 2000 50 200 0 4000 100 0 150 150 0 0 0 0
+   8       1 sda1 90 0 1800 45 190 0 3800 95 0 140 140 0 0 0 0
+ 259       0 nvme0n1 10 0 100 5 20 0 300 10 0 15 15 0 0 0 0
+   7       0 loop0 10 0 100 5 0 0 0 0 0 5 5 0 0 0 0
+`)
+	if read != 2100*diskSectorBytes || written != 4300*diskSectorBytes {
+		t.Errorf("parseDiskstats() = %d, %d, want %d, %d", read, written, 2100*diskSectorBytes, 4300*diskSectorBytes)
+	}
+}
+
+func TestGetNodePerfSample(t *testing.T) {
+	start := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	previous := &hostPerfCounters{timeStamp: start, cpuTotal: 1000, cpuIdle: 800, rxBytes: 1000, txBytes: 500, readBytes: 0, writeBytes: 100}
+	current := &hostPerfCounters{
+		timeStamp:       start.Add(10 * time.Second),
+		cpuTotal:        2000,
+		cpuIdle:         1050,
+		loadAverage:     1.5,
+		memoryTotal:     4000,
+		memoryAvailable: 1000,
+		rxBytes:         11000,
+		txBytes:         400,
+		readBytes:       5120,
+		writeBytes:      100,
+	}
+
+	want := NodePerfSample{
+		TimeStamp:               current.timeStamp,
+		CPUPercent:              75,
+		LoadAverage:             1.5,
+		MemoryUsedBytes:         3000,
+		MemoryTotalBytes:        4000,
+		MemoryPercent:           75,
+		NetworkRxBytesPerSecond: 1000,
+		DiskReadBytesPerSecond:  512,
+	}
+	if got := getNodePerfSample(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("getNodePerfSample() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetPodPerfSamples(t *testing.T) {
+	start := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	summary := func(rx int, tx int) []byte {
+		return []byte(`{"pods": [{"podRef": {"name": "coredns-a", "namespace": "kube-system"},
+  "containers": [{"name": "coredns", "cpu": {"usageNanoCores": 5000000}, "memory": {"workingSetBytes": 1048576}}],
+  "network": {"rxBytes": ` + strconv.Itoa(rx) + `, "txBytes": ` + strconv.Itoa(tx) + `}}]}`)
+	}
+
+	previousPods := map[string]podNetworkCounters{}
+	containers, networks, err := getPodPerfSamples(summary(1000, 1000), start, previousPods)
+	if err != nil {
+		t.Fatalf("getPodPerfSamples() error = %v", err)
+	}
+
+	wantContainers := []ContainerPerfSample{{
+		TimeStamp:  start,
+		PodMetrics: PodMetrics{Namespace: "kube-system", PodName: "coredns-a", ContainerName: "coredns", CPUUsage: 5, MemoryUsage: 1048576},
+	}}
+	if !reflect.DeepEqual(containers, wantContainers) {
+		t.Errorf("getPodPerfSamples() containers = %+v, want %+v", containers, wantContainers)
+	}
+	if len(networks) != 0 {
+		t.Errorf("getPodPerfSamples() networks = %+v, want none before the second reading", networks)
+	}
+
+	_, networks, err = getPodPerfSamples(summary(6000, 1000), start.Add(5*time.Second), previousPods)
+	if err != nil {
+		t.Fatalf("getPodPerfSamples() error = %v", err)
+	}
+
+	wantNetworks := []PodNetworkPerfSample{{TimeStamp: start.Add(5 * time.Second), Namespace: "kube-system", PodName: "coredns-a", RxBytesPerSecond: 1000}}
+	if !reflect.DeepEqual(networks, wantNetworks) {
+		t.Errorf("getPodPerfSamples() networks = %+v, want %+v", networks, wantNetworks)
+	}
+}
+
+func TestFormatPerfSamples(t *testing.T) {
+	timeStamp := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	samples := []ContainerPerfSample{
+		{TimeStamp: timeStamp, PodMetrics: PodMetrics{Namespace: "default", PodName: "web", ContainerName: "nginx", CPUUsage: 10, MemoryUsage: 2048, CPULimits: 500}},
+	}
+
+	ndjson, csv, err := formatPerfSamples(samples)
+	if err != nil {
+		t.Fatalf("formatPerfSamples() error = %v", err)
+	}
+
+	wantNDJSON := `{"TimeStamp":"2021-08-01T10:00:00Z","namespace":"default","podName":"web","name":"nginx","cpuUsage":10,"memoryUsage":2048,"cpuLimits":500}` + "\n"
+	if ndjson != wantNDJSON {
+		t.Errorf("formatPerfSamples() ndjson = %q, want %q", ndjson, wantNDJSON)
+	}
+
+	wantCSV := "TimeStamp,namespace,podName,name,cpuUsage,memoryUsage,cpuRequests,cpuLimits,memoryRequests,memoryLimits\n" +
+		"2021-08-01T10:00:00Z,default,web,nginx,10,2048,,500,,\n"
+	if csv != wantCSV {
+		t.Errorf("formatPerfSamples() csv = %q, want %q", csv, wantCSV)
+	}
+
+	if _, _, err := formatPerfSamples(samples[0]); err == nil {
+		t.Errorf("formatPerfSamples() expected an error for a sample which is not a slice")
+	}
+}
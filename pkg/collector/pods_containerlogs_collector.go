@@ -6,30 +6,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/aks-periscope/pkg/utils"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 )
 
+const (
+	defaultContainerLogsTailLines = 100
+	// containerLogsNodePlaceholder is replaced by the name of the node in the field selectors of container log selectors
+	containerLogsNodePlaceholder = "{node}"
+)
+
 // PodsContainerLogsCollector defines a Pods Container Logs Collector struct
 type PodsContainerLogsCollector struct {
 	kubeconfig *restclient.Config
 	data       map[string]string
 }
 
+// PodsContainerStruct defines a container of a pod whose logs are collected
 type PodsContainerStruct struct {
-	Name          string        `json:"name"`
-	Ready         string        `json:"ready"`
-	Status        string        `json:"status"`
-	Restart       int32         `json:"restart"`
-	Age           time.Duration `json:"age"`
-	ContainerName string        `json:"containerName"`
-	ContainerLog  string        `json:"containerLog"`
+	Namespace        string        `json:"namespace"`
+	Name             string        `json:"name"`
+	Ready            string        `json:"ready"`
+	Status           string        `json:"status"`
+	Restart          int32         `json:"restart"`
+	Age              time.Duration `json:"age"`
+	ContainerName    string        `json:"containerName"`
+	ContainerType    string        `json:"containerType"`
+	ContainerRestart int32         `json:"containerRestart"`
+	LogKey           string        `json:"logKey"`
+	PreviousLogKey   string        `json:"previousLogKey,omitempty"`
+}
+
+// ContainerLogsSelectorResult defines the pods and containers a container log selector matched
+type ContainerLogsSelectorResult struct {
+	Selector   string `json:"selector"`
+	Pods       int    `json:"pods"`
+	Containers int    `json:"containers"`
+	Error      string `json:"error,omitempty"`
+}
+
+// containerLogsSelector defines the containers to collect the logs of, from the
+// <namespace|*>[/<pod>[/<container>]][?labelSelector=<selector>&fieldSelector=<selector>] syntax
+type containerLogsSelector struct {
+	namespace     string
+	pod           string
+	container     string
+	labelSelector string
+	fieldSelector string
 }
 
 // NewPodsContainerLogs is a constructor
@@ -46,7 +81,17 @@ func (collector *PodsContainerLogsCollector) GetName() string {
 
 // Collect implements the interface method
 func (collector *PodsContainerLogsCollector) Collect() error {
-	containerNamespaces := strings.Fields(os.Getenv("DIAGNOSTIC_CONTAINERLOGS_LIST"))
+	selectors := strings.Fields(os.Getenv("DIAGNOSTIC_CONTAINERLOGS_LIST"))
+
+	logOptions, err := getContainerLogOptions()
+	if err != nil {
+		return err
+	}
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
 
 	// Creates the clientset
 	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
@@ -54,64 +99,118 @@ func (collector *PodsContainerLogsCollector) Collect() error {
 		return fmt.Errorf("getting access to K8S failed: %w", err)
 	}
 
-	for _, namespace := range containerNamespaces {
-		// List the pods in the given namespace
-		podList, err := utils.GetPods(clientset, namespace)
+	podsContainerData := []PodsContainerStruct{}
+	manifest := []ContainerLogsSelectorResult{}
+
+	for _, value := range selectors {
+		result := ContainerLogsSelectorResult{Selector: value}
 
+		selector, err := parseContainerLogsSelector(value, hostName)
 		if err != nil {
-			return fmt.Errorf("getting pods failed: %w", err)
+			result.Error = err.Error()
+			manifest = append(manifest, result)
+			continue
+		}
+
+		// List the pods matching the selector, similar to kubectl get pods -n <my namespace> -l <label selector>
+		podList, err := clientset.CoreV1().Pods(selector.namespace).List(context.Background(), selector.listOptions())
+		if err != nil {
+			result.Error = fmt.Sprintf("getting pods failed: %v", err)
+			manifest = append(manifest, result)
+			continue
 		}
 
-		// List all the pods similar to kubectl get pods -n <my namespace>
 		for _, pod := range podList.Items {
 			// Calculate the age of the pod
 			podCreationTime := pod.GetCreationTimestamp()
 			age := time.Since(podCreationTime.Time).Round(time.Second)
 
-			// Get the status of each of the pods
-			podStatus := pod.Status
-
 			var containerRestarts int32
 			var containerReady int
 
 			// If a pod has multiple containers, get the status from all
-			for container := range pod.Spec.Containers {
-				containerRestarts += podStatus.ContainerStatuses[container].RestartCount
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				containerRestarts += containerStatus.RestartCount
 
-				if podStatus.ContainerStatuses[container].Ready {
+				if containerStatus.Ready {
 					containerReady++
 				}
 			}
-			for _, containerItem := range pod.Spec.Containers {
-				containerName := containerItem.Name
-				// Get pods container logs
-				containerLogs, err := getPodContainerLogs(namespace, pod.Name, containerName, clientset)
 
-				if err != nil {
-					return fmt.Errorf("getting container logs failed: %w", err)
+			matched := false
+			for _, container := range getPodContainers(&pod) {
+				if selector.container != "" && container.name != selector.container {
+					continue
+				}
+				matched = true
+				result.Containers++
+
+				logKey := pod.Namespace + "_" + pod.Name + "_" + container.name
+				// Selectors may overlap, the logs of a container are only collected once
+				if _, ok := collector.data[logKey]; ok {
+					continue
 				}
 
-				podsContainerData := &PodsContainerStruct{
+				containerData := PodsContainerStruct{
+					Namespace:     pod.Namespace,
 					Name:          pod.Name,
 					Ready:         fmt.Sprintf("%v/%v", containerReady, len(pod.Spec.Containers)),
-					Status:        string(podStatus.Phase),
+					Status:        string(pod.Status.Phase),
 					Restart:       containerRestarts,
 					Age:           age,
-					ContainerName: containerName,
-					ContainerLog:  containerLogs,
+					ContainerName: container.name,
+					ContainerType: container.containerType,
+					LogKey:        logKey,
 				}
 
-				data, err := json.Marshal(podsContainerData)
+				if container.status != nil {
+					containerData.ContainerRestart = container.status.RestartCount
+				}
+
+				// Containers which have not started yet have no logs, the error explains why
+				containerLogs, err := getPodContainerLogs(pod.Namespace, pod.Name, container.name, false, logOptions, clientset)
 				if err != nil {
-					return fmt.Errorf("marshalling podsContainerData: %w", err)
+					log.Printf("Get logs of container %s/%s/%s failed: %v", pod.Namespace, pod.Name, container.name, err)
+					containerLogs = "Failed to get logs: " + err.Error()
+				}
+				collector.data[containerData.LogKey] = containerLogs
+
+				// The logs of the previous instance explain why a restarted container terminated
+				if container.status != nil && container.status.RestartCount > 0 {
+					previousLogs, err := getPodContainerLogs(pod.Namespace, pod.Name, container.name, true, logOptions, clientset)
+					if err != nil {
+						log.Printf("Get previous logs of container %s/%s/%s failed: %v", pod.Namespace, pod.Name, container.name, err)
+						previousLogs = "Failed to get previous logs: " + err.Error()
+					}
+					containerData.PreviousLogKey = containerData.LogKey + "_previous"
+					collector.data[containerData.PreviousLogKey] = previousLogs
 				}
 
-				// Append this to data to be printed in a table
-				collector.data[pod.Name+"-"+containerName] = string(data)
+				podsContainerData = append(podsContainerData, containerData)
+			}
+
+			if matched {
+				result.Pods++
 			}
 		}
+
+		manifest = append(manifest, result)
+	}
+
+	data, err := json.Marshal(podsContainerData)
+	if err != nil {
+		return fmt.Errorf("marshalling podsContainerData: %w", err)
 	}
 
+	collector.data["podscontainerlogs_containers"] = string(data)
+
+	data, err = json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshalling manifest: %w", err)
+	}
+
+	collector.data["podscontainerlogs_manifest"] = string(data)
+
 	return nil
 }
 
@@ -119,17 +218,183 @@ func (collector *PodsContainerLogsCollector) GetData() map[string]string {
 	return collector.data
 }
 
+// parseContainerLogsSelector parses a container log selector, replacing the node placeholder of its field selector
+func parseContainerLogsSelector(value string, hostName string) (*containerLogsSelector, error) {
+	path := value
+	query := ""
+	if i := strings.Index(value, "?"); i >= 0 {
+		path, query = value[:i], value[i+1:]
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("selector %q is not <namespace|*>[/<pod>[/<container>]][?labelSelector=..&fieldSelector=..]", value)
+	}
+	for _, part := range parts[1:] {
+		if part == "" {
+			return nil, fmt.Errorf("selector %q has an empty pod or container name", value)
+		}
+	}
+
+	selector := &containerLogsSelector{namespace: parts[0]}
+	if selector.namespace == "*" {
+		selector.namespace = metav1.NamespaceAll
+	}
+	if len(parts) > 1 && parts[1] != "*" {
+		selector.pod = parts[1]
+	}
+	if len(parts) > 2 {
+		selector.container = parts[2]
+	}
+
+	parameters, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("parse selector %q: %w", value, err)
+	}
+
+	for key, values := range parameters {
+		switch key {
+		case "labelSelector":
+			selector.labelSelector = strings.Join(values, ",")
+			if _, err := labels.Parse(selector.labelSelector); err != nil {
+				return nil, fmt.Errorf("parse label selector of %q: %w", value, err)
+			}
+		case "fieldSelector":
+			selector.fieldSelector = strings.ReplaceAll(strings.Join(values, ","), containerLogsNodePlaceholder, hostName)
+			if _, err := fields.ParseSelector(selector.fieldSelector); err != nil {
+				return nil, fmt.Errorf("parse field selector of %q: %w", value, err)
+			}
+		default:
+			return nil, fmt.Errorf("selector %q has unknown parameter %q", value, key)
+		}
+	}
+
+	return selector, nil
+}
+
+// listOptions returns the options listing the pods of the selector
+func (selector *containerLogsSelector) listOptions() metav1.ListOptions {
+	fieldSelector := selector.fieldSelector
+	if selector.pod != "" {
+		podSelector := "metadata.name=" + selector.pod
+		if fieldSelector == "" {
+			fieldSelector = podSelector
+		} else {
+			fieldSelector = podSelector + "," + fieldSelector
+		}
+	}
+
+	return metav1.ListOptions{
+		LabelSelector: selector.labelSelector,
+		FieldSelector: fieldSelector,
+	}
+}
+
+type podContainer struct {
+	name          string
+	containerType string
+	status        *v1.ContainerStatus
+}
+
+// getPodContainers returns the init, regular and ephemeral containers of a pod, along with their status when known
+func getPodContainers(pod *v1.Pod) []podContainer {
+	containers := []podContainer{}
+
+	appendContainers := func(containerType string, names []string, statuses []v1.ContainerStatus) {
+		for _, name := range names {
+			container := podContainer{name: name, containerType: containerType}
+			for i := range statuses {
+				if statuses[i].Name == name {
+					container.status = &statuses[i]
+					break
+				}
+			}
+			containers = append(containers, container)
+		}
+	}
+
+	names := []string{}
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	appendContainers("init", names, pod.Status.InitContainerStatuses)
+
+	names = []string{}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	appendContainers("container", names, pod.Status.ContainerStatuses)
+
+	names = []string{}
+	for _, container := range pod.Spec.EphemeralContainers {
+		names = append(names, container.Name)
+	}
+	appendContainers("ephemeral", names, pod.Status.EphemeralContainerStatuses)
+
+	return containers
+}
+
+// getContainerLogOptions reads the lines, time window and size of the container logs to collect, a zero value
+// removing the corresponding limit
+func getContainerLogOptions() (*v1.PodLogOptions, error) {
+	logOptions := &v1.PodLogOptions{Timestamps: true}
+
+	tailLines, err := getInt64FromEnv("DIAGNOSTIC_CONTAINERLOGS_TAIL_LINES", defaultContainerLogsTailLines)
+	if err != nil {
+		return nil, err
+	}
+	if tailLines > 0 {
+		logOptions.TailLines = &tailLines
+	}
+
+	sinceSeconds, err := getInt64FromEnv("DIAGNOSTIC_CONTAINERLOGS_SINCE_SECONDS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if sinceSeconds > 0 {
+		logOptions.SinceSeconds = &sinceSeconds
+	}
+
+	limitBytes, err := getInt64FromEnv("DIAGNOSTIC_CONTAINERLOGS_LIMIT_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	if limitBytes > 0 {
+		logOptions.LimitBytes = &limitBytes
+	}
+
+	return logOptions, nil
+}
+
+func getInt64FromEnv(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", key, err)
+	}
+
+	if number < 0 {
+		return 0, fmt.Errorf("%s must not be negative: %s", key, value)
+	}
+
+	return number, nil
+}
+
 func getPodContainerLogs(
 	namespace string,
 	podName string,
 	containerName string,
+	previous bool,
+	logOptions *v1.PodLogOptions,
 	clientset *kubernetes.Clientset) (string, error) {
 
-	count := int64(100)
-	podLogOptions := v1.PodLogOptions{
-		Container: containerName,
-		TailLines: &count,
-	}
+	podLogOptions := *logOptions
+	podLogOptions.Container = containerName
+	podLogOptions.Previous = previous
 
 	podLogRequest := clientset.CoreV1().
 		Pods(namespace).
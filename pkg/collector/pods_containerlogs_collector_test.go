@@ -5,6 +5,7 @@ import (
 	"path"
 	"testing"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -62,3 +63,210 @@ func TestPodsContainerLogsCollector(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPodContainers(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init"}},
+			Containers:     []v1.Container{{Name: "app"}, {Name: "sidecar"}},
+			EphemeralContainers: []v1.EphemeralContainer{
+				{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "debugger"}},
+			},
+		},
+		Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{{Name: "init"}},
+			// Statuses are not in the order of the spec
+			ContainerStatuses: []v1.ContainerStatus{{Name: "sidecar"}, {Name: "app", RestartCount: 3}},
+		},
+	}
+
+	want := []struct {
+		name          string
+		containerType string
+		restartCount  int32
+		hasStatus     bool
+	}{
+		{name: "init", containerType: "init", hasStatus: true},
+		{name: "app", containerType: "container", restartCount: 3, hasStatus: true},
+		{name: "sidecar", containerType: "container", hasStatus: true},
+		{name: "debugger", containerType: "ephemeral"},
+	}
+
+	got := getPodContainers(pod)
+	if len(got) != len(want) {
+		t.Fatalf("len(getPodContainers()) = %d, want %d", len(got), len(want))
+	}
+
+	for i, container := range got {
+		if container.name != want[i].name || container.containerType != want[i].containerType || (container.status != nil) != want[i].hasStatus {
+			t.Errorf("getPodContainers()[%d] = %+v, want %+v", i, container, want[i])
+			continue
+		}
+		if container.status != nil && container.status.RestartCount != want[i].restartCount {
+			t.Errorf("getPodContainers()[%d] restart count = %d, want %d", i, container.status.RestartCount, want[i].restartCount)
+		}
+	}
+}
+
+func TestGetContainerLogOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		tailLines        string
+		sinceSeconds     string
+		limitBytes       string
+		wantTailLines    int64
+		wantSinceSeconds int64
+		wantLimitBytes   int64
+		wantErr          bool
+	}{
+		{
+			name:          "defaults",
+			wantTailLines: defaultContainerLogsTailLines,
+		},
+		{
+			name:             "all limits",
+			tailLines:        "500",
+			sinceSeconds:     "3600",
+			limitBytes:       "1048576",
+			wantTailLines:    500,
+			wantSinceSeconds: 3600,
+			wantLimitBytes:   1048576,
+		},
+		{
+			name:      "no tail",
+			tailLines: "0",
+		},
+		{
+			name:         "invalid since seconds",
+			sinceSeconds: "1h",
+			wantErr:      true,
+		},
+		{
+			name:       "negative limit bytes",
+			limitBytes: "-1",
+			wantErr:    true,
+		},
+	}
+
+	value := func(number *int64) int64 {
+		if number == nil {
+			return 0
+		}
+		return *number
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("DIAGNOSTIC_CONTAINERLOGS_TAIL_LINES", tt.tailLines)
+			os.Setenv("DIAGNOSTIC_CONTAINERLOGS_SINCE_SECONDS", tt.sinceSeconds)
+			os.Setenv("DIAGNOSTIC_CONTAINERLOGS_LIMIT_BYTES", tt.limitBytes)
+			defer os.Unsetenv("DIAGNOSTIC_CONTAINERLOGS_TAIL_LINES")
+			defer os.Unsetenv("DIAGNOSTIC_CONTAINERLOGS_SINCE_SECONDS")
+			defer os.Unsetenv("DIAGNOSTIC_CONTAINERLOGS_LIMIT_BYTES")
+
+			got, err := getContainerLogOptions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getContainerLogOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !got.Timestamps {
+				t.Errorf("getContainerLogOptions() does not enable timestamps")
+			}
+			if value(got.TailLines) != tt.wantTailLines || value(got.SinceSeconds) != tt.wantSinceSeconds || value(got.LimitBytes) != tt.wantLimitBytes {
+				t.Errorf("getContainerLogOptions() = tail %d, since %d, limit %d, want tail %d, since %d, limit %d",
+					value(got.TailLines), value(got.SinceSeconds), value(got.LimitBytes), tt.wantTailLines, tt.wantSinceSeconds, tt.wantLimitBytes)
+			}
+		})
+	}
+}
+
+func TestParseContainerLogsSelector(t *testing.T) {
+	tests := []struct {
+		name              string
+		selector          string
+		want              *containerLogsSelector
+		wantLabelSelector string
+		wantFieldSelector string
+		wantErr           bool
+	}{
+		{
+			name:     "namespace",
+			selector: "kube-system",
+			want:     &containerLogsSelector{namespace: "kube-system"},
+		},
+		{
+			name:              "pod",
+			selector:          "mynamespace1/mypod1",
+			want:              &containerLogsSelector{namespace: "mynamespace1", pod: "mypod1"},
+			wantFieldSelector: "metadata.name=mypod1",
+		},
+		{
+			name:              "container",
+			selector:          "kube-system/coredns-abc/coredns",
+			want:              &containerLogsSelector{namespace: "kube-system", pod: "coredns-abc", container: "coredns"},
+			wantFieldSelector: "metadata.name=coredns-abc",
+		},
+		{
+			name:              "container of every pod with a label",
+			selector:          "kube-system/*/coredns?labelSelector=k8s-app=kube-dns",
+			want:              &containerLogsSelector{namespace: "kube-system", container: "coredns", labelSelector: "k8s-app=kube-dns"},
+			wantLabelSelector: "k8s-app=kube-dns",
+		},
+		{
+			name:              "pods of every namespace on this node which are not running",
+			selector:          "*?fieldSelector=spec.nodeName={node},status.phase!=Running",
+			want:              &containerLogsSelector{fieldSelector: "spec.nodeName=aks-nodepool1-0,status.phase!=Running"},
+			wantFieldSelector: "spec.nodeName=aks-nodepool1-0,status.phase!=Running",
+		},
+		{
+			name:              "pod with a field selector",
+			selector:          "default/mypod?fieldSelector=spec.nodeName={node}",
+			want:              &containerLogsSelector{namespace: "default", pod: "mypod", fieldSelector: "spec.nodeName=aks-nodepool1-0"},
+			wantFieldSelector: "metadata.name=mypod,spec.nodeName=aks-nodepool1-0",
+		},
+		{
+			name:     "too many parts",
+			selector: "a/b/c/d",
+			wantErr:  true,
+		},
+		{
+			name:     "empty pod",
+			selector: "default//app",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown parameter",
+			selector: "default?selector=app",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid label selector",
+			selector: "default?labelSelector=app+in+(a",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseContainerLogsSelector(tt.selector, "aks-nodepool1-0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseContainerLogsSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if *got != *tt.want {
+				t.Errorf("parseContainerLogsSelector() = %+v, want %+v", got, tt.want)
+			}
+
+			listOptions := got.listOptions()
+			if listOptions.LabelSelector != tt.wantLabelSelector || listOptions.FieldSelector != tt.wantFieldSelector {
+				t.Errorf("listOptions() = %q, %q, want %q, %q", listOptions.LabelSelector, listOptions.FieldSelector, tt.wantLabelSelector, tt.wantFieldSelector)
+			}
+		})
+	}
+}
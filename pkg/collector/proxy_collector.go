@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/Azure/aks-periscope/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// ProxySettings defines the HTTP proxy configuration of the node and the destinations it must exclude
+type ProxySettings struct {
+	utils.ProxyConfig
+	APIServerFQDN         string   `json:"APIServerFQDN,omitempty"`
+	KubernetesServiceHost string   `json:"KubernetesServiceHost,omitempty"`
+	ServiceClusterIPs     []string `json:"ServiceClusterIPs,omitempty"`
+}
+
+// ProxyCollector defines a Proxy Collector struct
+type ProxyCollector struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewProxyCollector is a constructor
+func NewProxyCollector(config *restclient.Config) *ProxyCollector {
+	return &ProxyCollector{
+		kubeconfig: config,
+		data:       make(map[string]string),
+	}
+}
+
+func (collector *ProxyCollector) GetName() string {
+	return "proxy"
+}
+
+// Collect implements the interface method
+func (collector *ProxyCollector) Collect() error {
+	settings := ProxySettings{
+		ProxyConfig:           *utils.GetProxyConfig().Redacted(),
+		KubernetesServiceHost: os.Getenv("KUBERNETES_SERVICE_HOST"),
+	}
+
+	if fqdn, err := getAPIServerFQDN(); err == nil {
+		settings.APIServerFQDN = fqdn
+	}
+
+	// The service CIDR is not known to the node, the cluster IPs in use tell which part of it NO_PROXY must exclude
+	if clusterIPs, err := collector.getServiceClusterIPs(); err != nil {
+		log.Printf("Failed to list service cluster IPs: %v", err)
+	} else {
+		settings.ServiceClusterIPs = clusterIPs
+	}
+
+	dataBytes, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+
+	collector.data["proxy"] = string(dataBytes)
+
+	return nil
+}
+
+func (collector *ProxyCollector) GetData() map[string]string {
+	return collector.data
+}
+
+func (collector *ProxyCollector) getServiceClusterIPs() ([]string, error) {
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	clusterIPs := []string{}
+	for _, service := range services.Items {
+		// Headless services have no cluster IP
+		if net.ParseIP(service.Spec.ClusterIP) != nil {
+			clusterIPs = append(clusterIPs, service.Spec.ClusterIP)
+		}
+	}
+
+	return clusterIPs, nil
+}
@@ -4,12 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+
+	systemPerfSourceMetricsServer  = "metrics-server"
+	systemPerfSourceKubeletSummary = "kubelet-summary"
+)
+
 // SystemPerfCollector defines a SystemPerf Collector struct
 type SystemPerfCollector struct {
 	kubeconfig *restclient.Config
@@ -23,9 +38,62 @@ type NodeMetrics struct {
 }
 
 type PodMetrics struct {
-	ContainerName string `json:"name"`
-	CPUUsage      int64  `json:"cpuUsage"`
-	MemoryUsage   int64  `json:"memoryUsage"`
+	Namespace      string `json:"namespace"`
+	PodName        string `json:"podName"`
+	ContainerName  string `json:"name"`
+	CPUUsage       int64  `json:"cpuUsage"`
+	MemoryUsage    int64  `json:"memoryUsage"`
+	CPURequests    int64  `json:"cpuRequests,omitempty"`
+	CPULimits      int64  `json:"cpuLimits,omitempty"`
+	MemoryRequests int64  `json:"memoryRequests,omitempty"`
+	MemoryLimits   int64  `json:"memoryLimits,omitempty"`
+}
+
+// CgroupCPUThrottling defines the CFS quota throttling of a pod or container cgroup of the node
+type CgroupCPUThrottling struct {
+	Cgroup           string  `json:"cgroup"`
+	Namespace        string  `json:"namespace,omitempty"`
+	PodName          string  `json:"podName,omitempty"`
+	PodUID           string  `json:"podUID"`
+	ContainerID      string  `json:"containerID,omitempty"`
+	Periods          int64   `json:"periods"`
+	ThrottledPeriods int64   `json:"throttledPeriods"`
+	ThrottledSeconds float64 `json:"throttledSeconds"`
+	ThrottledPercent float64 `json:"throttledPercent"`
+}
+
+// kubeletStatsSummary defines the fields periscope uses of the kubelet /stats/summary response
+type kubeletStatsSummary struct {
+	Node struct {
+		NodeName string             `json:"nodeName"`
+		CPU      *kubeletCPUStats   `json:"cpu"`
+		Memory   *kubeletMemoryStat `json:"memory"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name   string             `json:"name"`
+			CPU    *kubeletCPUStats   `json:"cpu"`
+			Memory *kubeletMemoryStat `json:"memory"`
+		} `json:"containers"`
+		Network *kubeletNetworkStats `json:"network"`
+	} `json:"pods"`
+}
+
+type kubeletCPUStats struct {
+	UsageNanoCores *uint64 `json:"usageNanoCores"`
+}
+
+type kubeletMemoryStat struct {
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+}
+
+type kubeletNetworkStats struct {
+	RxBytes *uint64 `json:"rxBytes"`
+	TxBytes *uint64 `json:"txBytes"`
 }
 
 // NewSystemPerfCollector is a constructor
@@ -42,14 +110,73 @@ func (collector *SystemPerfCollector) GetName() string {
 
 // Collect implements the interface method
 func (collector *SystemPerfCollector) Collect() error {
-	metric, err := metrics.NewForConfig(collector.kubeconfig)
+	clientset, err := kubernetes.NewForConfig(collector.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	// The pods only complete the metrics with their requests, limits and names, so the metrics are collected without
+	// them when they cannot be listed
+	pods := []v1.Pod{}
+	if podList, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err == nil {
+		pods = podList.Items
+	} else {
+		log.Printf("List pods failed, pod metrics are collected without their requests, limits and names: %v", err)
+	}
+
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	source := systemPerfSourceMetricsServer
+	noderesult, podresult, err := getMetricsServerMetrics(collector.kubeconfig)
+	if err != nil {
+		// Without metrics-server, the kubelet of the node still reports the usage of the node and its containers
+		log.Printf("Get metrics from metrics-server failed, falling back to the kubelet summary: %v", err)
+
+		source = systemPerfSourceKubeletSummary
+		noderesult, podresult, err = getKubeletSummaryMetrics(clientset, hostName)
+		if err != nil {
+			return fmt.Errorf("get metrics from the kubelet summary: %w", err)
+		}
+	}
+
+	joinPodMetricsResources(podresult, pods)
+
+	jsonNodeResult, err := json.Marshal(noderesult)
+	if err != nil {
+		return fmt.Errorf("marshall node metrics to json: %w", err)
+	}
+
+	collector.data["nodes"] = string(jsonNodeResult)
+
+	jsonPodResult, err := json.Marshal(podresult)
+	if err != nil {
+		return fmt.Errorf("marshall pod metrics to json: %w", err)
+	}
+
+	collector.data["pods"] = string(jsonPodResult)
+	collector.data["source"] = source
+
+	collector.collectHostMetrics(pods)
+
+	return nil
+}
+
+func (collector *SystemPerfCollector) GetData() map[string]string {
+	return collector.data
+}
+
+func getMetricsServerMetrics(config *restclient.Config) ([]NodeMetrics, []PodMetrics, error) {
+	metric, err := metrics.NewForConfig(config)
 	if err != nil {
-		return fmt.Errorf("metrics for config error: %w", err)
+		return nil, nil, fmt.Errorf("metrics for config error: %w", err)
 	}
 
 	nodeMetrics, err := metric.MetricsV1beta1().NodeMetricses().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("node metrics error: %w", err)
+		return nil, nil, fmt.Errorf("node metrics error: %w", err)
 	}
 
 	noderesult := make([]NodeMetrics, 0)
@@ -58,7 +185,7 @@ func (collector *SystemPerfCollector) Collect() error {
 		cpuQuantity := nodeMetric.Usage.Cpu().MilliValue()
 		memQuantity, ok := nodeMetric.Usage.Memory().AsInt64()
 		if !ok {
-			return err
+			return nil, nil, fmt.Errorf("usage memory of node %s failure", nodeMetric.Name)
 		}
 
 		nm := NodeMetrics{
@@ -69,16 +196,10 @@ func (collector *SystemPerfCollector) Collect() error {
 
 		noderesult = append(noderesult, nm)
 	}
-	jsonNodeResult, err := json.Marshal(noderesult)
-	if err != nil {
-		return fmt.Errorf("marshall node metrics to json: %w", err)
-	}
-
-	collector.data["nodes"] = string(jsonNodeResult)
 
 	podMetrics, err := metric.MetricsV1beta1().PodMetricses(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("pod metrics failure: %w", err)
+		return nil, nil, fmt.Errorf("pod metrics failure: %w", err)
 	}
 
 	podresult := make([]PodMetrics, 0)
@@ -89,10 +210,12 @@ func (collector *SystemPerfCollector) Collect() error {
 			cpuQuantity := container.Usage.Cpu().MilliValue()
 			memQuantity, ok := container.Usage.Memory().AsInt64()
 			if !ok {
-				return fmt.Errorf("usage memory failure: %w", err)
+				return nil, nil, fmt.Errorf("usage memory of container %s/%s/%s failure", podMetric.Namespace, podMetric.Name, container.Name)
 			}
 
 			pm := PodMetrics{
+				Namespace:     podMetric.Namespace,
+				PodName:       podMetric.Name,
 				ContainerName: container.Name,
 				CPUUsage:      cpuQuantity,
 				MemoryUsage:   memQuantity,
@@ -101,16 +224,203 @@ func (collector *SystemPerfCollector) Collect() error {
 			podresult = append(podresult, pm)
 		}
 	}
-	jsonPodResult, err := json.Marshal(podresult)
+
+	return noderesult, podresult, nil
+}
+
+// getKubeletSummaryMetrics reads the usage of the node and its containers from the kubelet /stats/summary, through
+// the node proxy of the API server
+func getKubeletSummaryMetrics(clientset *kubernetes.Clientset, nodeName string) ([]NodeMetrics, []PodMetrics, error) {
+	output, err := getKubeletStatsSummary(clientset, nodeName)
 	if err != nil {
-		return fmt.Errorf("marshall pod metrics to json: %w", err)
+		return nil, nil, err
 	}
 
-	collector.data["pods"] = string(jsonPodResult)
+	return parseKubeletStatsSummary(output)
+}
 
-	return nil
+func getKubeletStatsSummary(clientset *kubernetes.Clientset, nodeName string) ([]byte, error) {
+	output, err := clientset.CoreV1().RESTClient().Get().Resource("nodes").Name(nodeName).SubResource("proxy").Suffix("stats/summary").DoRaw(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("get stats summary of node %s: %w", nodeName, err)
+	}
+
+	return output, nil
 }
 
-func (collector *SystemPerfCollector) GetData() map[string]string {
-	return collector.data
+// parseKubeletStatsSummary converts a kubelet stats summary to the CPU (millicores) and working set memory (bytes)
+// metrics-server reports
+func parseKubeletStatsSummary(output []byte) ([]NodeMetrics, []PodMetrics, error) {
+	var summary kubeletStatsSummary
+	if err := json.Unmarshal(output, &summary); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal stats summary: %w", err)
+	}
+
+	noderesult := []NodeMetrics{{
+		NodeName:    summary.Node.NodeName,
+		CPUUsage:    getKubeletCPUUsage(summary.Node.CPU),
+		MemoryUsage: getKubeletMemoryUsage(summary.Node.Memory),
+	}}
+
+	podresult := []PodMetrics{}
+	for _, pod := range summary.Pods {
+		for _, container := range pod.Containers {
+			podresult = append(podresult, PodMetrics{
+				Namespace:     pod.PodRef.Namespace,
+				PodName:       pod.PodRef.Name,
+				ContainerName: container.Name,
+				CPUUsage:      getKubeletCPUUsage(container.CPU),
+				MemoryUsage:   getKubeletMemoryUsage(container.Memory),
+			})
+		}
+	}
+
+	return noderesult, podresult, nil
+}
+
+func getKubeletCPUUsage(stats *kubeletCPUStats) int64 {
+	if stats == nil || stats.UsageNanoCores == nil {
+		return 0
+	}
+	return int64(*stats.UsageNanoCores / 1000000)
+}
+
+func getKubeletMemoryUsage(stats *kubeletMemoryStat) int64 {
+	if stats == nil || stats.WorkingSetBytes == nil {
+		return 0
+	}
+	return int64(*stats.WorkingSetBytes)
+}
+
+// joinPodMetricsResources sets the requests and limits of the container of every pod metrics from the pod specs
+func joinPodMetricsResources(podMetrics []PodMetrics, pods []v1.Pod) {
+	containers := map[string]*v1.Container{}
+	for i := range pods {
+		for j := range pods[i].Spec.Containers {
+			containers[pods[i].Namespace+"/"+pods[i].Name+"/"+pods[i].Spec.Containers[j].Name] = &pods[i].Spec.Containers[j]
+		}
+	}
+
+	for i := range podMetrics {
+		container, ok := containers[podMetrics[i].Namespace+"/"+podMetrics[i].PodName+"/"+podMetrics[i].ContainerName]
+		if !ok {
+			continue
+		}
+
+		podMetrics[i].CPURequests = container.Resources.Requests.Cpu().MilliValue()
+		podMetrics[i].CPULimits = container.Resources.Limits.Cpu().MilliValue()
+		podMetrics[i].MemoryRequests = container.Resources.Requests.Memory().Value()
+		podMetrics[i].MemoryLimits = container.Resources.Limits.Memory().Value()
+	}
+}
+
+// collectHostMetrics reads the load, memory and virtual memory statistics of the node, and the CPU throttling of its
+// pod and container cgroups
+func (collector *SystemPerfCollector) collectHostMetrics(pods []v1.Pod) {
+	for key, file := range map[string]string{
+		"loadavg": "/proc/loadavg",
+		"meminfo": "/proc/meminfo",
+		"vmstat":  "/proc/vmstat",
+	} {
+		output, err := utils.RunCommandOnHost("cat", file)
+		if err != nil {
+			output = fmt.Sprintf("Failed to read %s: %v", file, err)
+			log.Print(output)
+		}
+		collector.data[key] = output
+	}
+
+	// grep prefixes every line with its file, so all cpu.stat files are read at once. Cgroups are removed while find
+	// walks them when containers stop, which fails find and grep, so the statistics read are kept
+	output, err := utils.RunCommandOnHost("sh", "-c", "find "+cgroupRoot+" -path '*kubepods*' -name cpu.stat -exec grep -H . {} + 2>/dev/null; true")
+	if err != nil {
+		collector.data["cpu_throttling"] = "Failed to read cgroup CPU statistics: " + err.Error()
+		return
+	}
+
+	throttling := parseCgroupCPUStats(output)
+
+	podNames := map[string]*v1.Pod{}
+	for i := range pods {
+		podNames[string(pods[i].UID)] = &pods[i]
+	}
+	for i := range throttling {
+		if pod, ok := podNames[throttling[i].PodUID]; ok {
+			throttling[i].Namespace = pod.Namespace
+			throttling[i].PodName = pod.Name
+		}
+	}
+
+	dataBytes, err := json.Marshal(throttling)
+	if err != nil {
+		collector.data["cpu_throttling"] = "Failed to marshal cgroup CPU statistics: " + err.Error()
+		return
+	}
+	collector.data["cpu_throttling"] = string(dataBytes)
+}
+
+// parseCgroupCPUStats parses <path>:<key> <value> lines of cgroup v1 and v2 cpu.stat files, and returns the pod and
+// container cgroups which were throttled, the most throttled first
+func parseCgroupCPUStats(output string) []CgroupCPUThrottling {
+	stats := map[string]map[string]int64{}
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+
+		fields := strings.Fields(line[i+1:])
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		cgroup := filepath.Dir(line[:i])
+		if stats[cgroup] == nil {
+			stats[cgroup] = map[string]int64{}
+		}
+		stats[cgroup][fields[0]] = value
+	}
+
+	throttling := []CgroupCPUThrottling{}
+	for cgroup, values := range stats {
+		podUID, containerID := parseKubernetesCgroup(cgroup)
+		if podUID == "" || values["nr_throttled"] == 0 {
+			continue
+		}
+
+		record := CgroupCPUThrottling{
+			Cgroup:           strings.TrimPrefix(cgroup, cgroupRoot),
+			PodUID:           podUID,
+			ContainerID:      containerID,
+			Periods:          values["nr_periods"],
+			ThrottledPeriods: values["nr_throttled"],
+		}
+
+		// cgroup v1 reports the throttled time in nanoseconds, cgroup v2 in microseconds
+		if usec, ok := values["throttled_usec"]; ok {
+			record.ThrottledSeconds = float64(usec) / 1e6
+		} else {
+			record.ThrottledSeconds = float64(values["throttled_time"]) / 1e9
+		}
+
+		if record.Periods > 0 {
+			record.ThrottledPercent = float64(record.ThrottledPeriods) / float64(record.Periods) * 100
+		}
+
+		throttling = append(throttling, record)
+	}
+
+	sort.Slice(throttling, func(i, j int) bool {
+		if throttling[i].ThrottledPercent != throttling[j].ThrottledPercent {
+			return throttling[i].ThrottledPercent > throttling[j].ThrottledPercent
+		}
+		return throttling[i].Cgroup < throttling[j].Cgroup
+	})
+
+	return throttling
 }
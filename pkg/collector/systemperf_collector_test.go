@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
 	"k8s.io/client-go/tools/clientcmd"
@@ -63,3 +64,97 @@ func TestSystemperfCollector(t *testing.T) {
 		})
 	}
 }
+
+func TestParseKubeletStatsSummary(t *testing.T) {
+	summary := `{
+  "node": {"nodeName": "aks-nodepool1-0", "cpu": {"usageNanoCores": 250000000}, "memory": {"workingSetBytes": 1073741824}},
+  "pods": [
+    {"podRef": {"name": "coredns-a", "namespace": "kube-system"}, "containers": [{"name": "coredns", "cpu": {"usageNanoCores": 3000000}, "memory": {"workingSetBytes": 20971520}}]},
+    {"podRef": {"name": "coredns-b", "namespace": "kube-system"}, "containers": [{"name": "coredns"}]}
+  ]
+}`
+
+	nodes, pods, err := parseKubeletStatsSummary([]byte(summary))
+	if err != nil {
+		t.Fatalf("parseKubeletStatsSummary() error = %v", err)
+	}
+
+	wantNodes := []NodeMetrics{{NodeName: "aks-nodepool1-0", CPUUsage: 250, MemoryUsage: 1073741824}}
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("parseKubeletStatsSummary() nodes = %+v, want %+v", nodes, wantNodes)
+	}
+
+	wantPods := []PodMetrics{
+		{Namespace: "kube-system", PodName: "coredns-a", ContainerName: "coredns", CPUUsage: 3, MemoryUsage: 20971520},
+		{Namespace: "kube-system", PodName: "coredns-b", ContainerName: "coredns"},
+	}
+	if !reflect.DeepEqual(pods, wantPods) {
+		t.Errorf("parseKubeletStatsSummary() pods = %+v, want %+v", pods, wantPods)
+	}
+
+	if _, _, err := parseKubeletStatsSummary([]byte("not json")); err == nil {
+		t.Errorf("parseKubeletStatsSummary() expected an error for invalid json")
+	}
+}
+
+func TestParseCgroupCPUStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []CgroupCPUThrottling
+	}{
+		{
+			name: "cgroup v1",
+			output: `/sys/fs/cgroup/cpu,cpuacct/kubepods/burstable/pod0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10/cpu.stat:nr_periods 100
+/sys/fs/cgroup/cpu,cpuacct/kubepods/burstable/pod0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10/cpu.stat:nr_throttled 25
+/sys/fs/cgroup/cpu,cpuacct/kubepods/burstable/pod0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10/cpu.stat:throttled_time 1500000000
+/sys/fs/cgroup/cpu,cpuacct/kubepods/cpu.stat:nr_periods 100
+/sys/fs/cgroup/cpu,cpuacct/kubepods/cpu.stat:nr_throttled 50
+`,
+			want: []CgroupCPUThrottling{
+				{
+					Cgroup:           "/cpu,cpuacct/kubepods/burstable/pod0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10",
+					PodUID:           "0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10",
+					Periods:          100,
+					ThrottledPeriods: 25,
+					ThrottledSeconds: 1.5,
+					ThrottledPercent: 25,
+				},
+			},
+		},
+		{
+			name: "cgroup v2 without throttling",
+			output: `/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:nr_periods 10
+/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:nr_throttled 0
+/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:throttled_usec 0
+`,
+			want: []CgroupCPUThrottling{},
+		},
+		{
+			name: "cgroup v2",
+			output: `/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:nr_periods 200
+/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:nr_throttled 150
+/sys/fs/cgroup/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice/cpu.stat:throttled_usec 2500000
+`,
+			want: []CgroupCPUThrottling{
+				{
+					Cgroup:           "/kubepods.slice/kubepods-pod0d8f0e3c_4b0a_4a3e_9d3c_0b6b8a5e1f10.slice",
+					PodUID:           "0d8f0e3c-4b0a-4a3e-9d3c-0b6b8a5e1f10",
+					Periods:          200,
+					ThrottledPeriods: 150,
+					ThrottledSeconds: 2.5,
+					ThrottledPercent: 75,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseCgroupCPUStats(tt.output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCgroupCPUStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
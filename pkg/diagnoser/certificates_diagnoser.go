@@ -0,0 +1,142 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+// defaultCertificateExpiryWarningDays defines the warning thresholds used when none are configured
+var defaultCertificateExpiryWarningDays = []int{30, 7}
+
+type certificatesDiagnosticDatum struct {
+	HostName string    `json:"HostName"`
+	Path     string    `json:"Path"`
+	Subject  string    `json:"Subject"`
+	NotAfter time.Time `json:"NotAfter"`
+	Level    string    `json:"Level"`
+	Message  string    `json:"Message"`
+}
+
+// CertificatesDiagnoser defines a Certificates Diagnoser struct
+type CertificatesDiagnoser struct {
+	certificatesCollector *collector.CertificatesCollector
+	data                  map[string]string
+}
+
+// NewCertificatesDiagnoser is a constructor
+func NewCertificatesDiagnoser(certificatesCollector *collector.CertificatesCollector) *CertificatesDiagnoser {
+	return &CertificatesDiagnoser{
+		certificatesCollector: certificatesCollector,
+		data:                  make(map[string]string),
+	}
+}
+
+func (diagnoser *CertificatesDiagnoser) GetName() string {
+	return "certificates"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *CertificatesDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	certificates := []collector.CertificateInfo{}
+	if data, ok := diagnoser.certificatesCollector.GetData()["certificates"]; ok {
+		if err := json.Unmarshal([]byte(data), &certificates); err != nil {
+			return fmt.Errorf("unmarshal certificates: %w", err)
+		}
+	}
+
+	certificatesDiagnosticData := diagnoseCertificates(hostName, certificates, getCertificateExpiryWarningDays(), time.Now())
+
+	dataBytes, err := json.Marshal(certificatesDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Certificates Diagnoser: %w", err)
+	}
+
+	diagnoser.data["certificates_diagnostic"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *CertificatesDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+func diagnoseCertificates(hostName string, certificates []collector.CertificateInfo, warningDays []int, now time.Time) []certificatesDiagnosticDatum {
+	certificatesDiagnosticData := []certificatesDiagnosticDatum{}
+
+	for _, certificate := range certificates {
+		newDatum := func(level string, format string, a ...interface{}) certificatesDiagnosticDatum {
+			return certificatesDiagnosticDatum{
+				HostName: hostName,
+				Path:     certificate.Path,
+				Subject:  certificate.Subject,
+				NotAfter: certificate.NotAfter,
+				Level:    level,
+				Message:  fmt.Sprintf(format, a...),
+			}
+		}
+
+		if certificate.IssuerVerified != nil && !*certificate.IssuerVerified {
+			certificatesDiagnosticData = append(certificatesDiagnosticData, newDatum("Error",
+				"certificate is not signed by the certificate issued to %q found in %s", certificate.Issuer, certificate.IssuerPath))
+		}
+
+		if now.Before(certificate.NotBefore) {
+			certificatesDiagnosticData = append(certificatesDiagnosticData, newDatum("Error",
+				"certificate is not valid before %s", certificate.NotBefore.Format(time.RFC3339)))
+			continue
+		}
+
+		if !now.Before(certificate.NotAfter) {
+			certificatesDiagnosticData = append(certificatesDiagnosticData, newDatum("Error",
+				"certificate expired on %s", certificate.NotAfter.Format(time.RFC3339)))
+			continue
+		}
+
+		// Report the tightest threshold the certificate is within
+		remaining := certificate.NotAfter.Sub(now)
+		for _, days := range warningDays {
+			if remaining <= time.Duration(days)*24*time.Hour {
+				certificatesDiagnosticData = append(certificatesDiagnosticData, newDatum("Warning",
+					"certificate expires in %d days, within the %d days threshold", int(remaining.Hours()/24), days))
+				break
+			}
+		}
+	}
+
+	return certificatesDiagnosticData
+}
+
+// getCertificateExpiryWarningDays returns the configured warning thresholds sorted from the tightest
+func getCertificateExpiryWarningDays() []int {
+	warningDays := []int{}
+	for _, value := range strings.Fields(os.Getenv("DIAGNOSTIC_CERTIFICATE_EXPIRY_WARNING_DAYS")) {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			log.Printf("Ignoring invalid certificate expiry warning threshold %q", value)
+			continue
+		}
+		warningDays = append(warningDays, days)
+	}
+
+	if len(warningDays) == 0 {
+		warningDays = append(warningDays, defaultCertificateExpiryWarningDays...)
+	}
+
+	sort.Ints(warningDays)
+
+	return warningDays
+}
@@ -0,0 +1,125 @@
+package diagnoser
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnoseCertificates(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.Add(time.Duration(n) * 24 * time.Hour) }
+	certificate := func(notBefore time.Time, notAfter time.Time) collector.CertificateInfo {
+		return collector.CertificateInfo{Path: "/etc/kubernetes/certs/client.crt", Subject: "CN=client", NotBefore: notBefore, NotAfter: notAfter}
+	}
+	unverified := false
+
+	tests := []struct {
+		name        string
+		certificate collector.CertificateInfo
+		want        []string
+	}{
+		{
+			name:        "valid beyond the thresholds",
+			certificate: certificate(days(-300), days(60)),
+			want:        []string{},
+		},
+		{
+			name:        "within the widest threshold",
+			certificate: certificate(days(-300), days(20)),
+			want:        []string{"Warning: certificate expires in 20 days, within the 30 days threshold"},
+		},
+		{
+			name:        "within the tightest threshold",
+			certificate: certificate(days(-300), days(5)),
+			want:        []string{"Warning: certificate expires in 5 days, within the 7 days threshold"},
+		},
+		{
+			name:        "on the tightest threshold",
+			certificate: certificate(days(-300), days(7)),
+			want:        []string{"Warning: certificate expires in 7 days, within the 7 days threshold"},
+		},
+		{
+			name:        "expired",
+			certificate: certificate(days(-300), days(-1)),
+			want:        []string{"Error: certificate expired on 2021-09-30T12:00:00Z"},
+		},
+		{
+			name:        "expiring now",
+			certificate: certificate(days(-300), now),
+			want:        []string{"Error: certificate expired on 2021-10-01T12:00:00Z"},
+		},
+		{
+			name:        "not yet valid",
+			certificate: certificate(days(2), days(365)),
+			want:        []string{"Error: certificate is not valid before 2021-10-03T12:00:00Z"},
+		},
+		{
+			name: "not signed by its issuer",
+			certificate: collector.CertificateInfo{
+				Path:           "/etc/kubernetes/certs/client.crt",
+				Issuer:         "CN=ca",
+				NotBefore:      days(-300),
+				NotAfter:       days(20),
+				IssuerPath:     "/etc/kubernetes/certs/ca.crt",
+				IssuerVerified: &unverified,
+			},
+			want: []string{
+				`Error: certificate is not signed by the certificate issued to "CN=ca" found in /etc/kubernetes/certs/ca.crt`,
+				"Warning: certificate expires in 20 days, within the 30 days threshold",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, datum := range diagnoseCertificates("aks-nodepool1-0", []collector.CertificateInfo{tt.certificate}, []int{7, 30}, now) {
+				got = append(got, datum.Level+": "+datum.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnoseCertificates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCertificateExpiryWarningDays(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []int
+	}{
+		{
+			name:  "not configured",
+			value: "",
+			want:  []int{7, 30},
+		},
+		{
+			name:  "configured thresholds",
+			value: "90 14 60",
+			want:  []int{14, 60, 90},
+		},
+		{
+			name:  "invalid thresholds",
+			value: "0 -7 soon",
+			want:  []int{7, 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("DIAGNOSTIC_CERTIFICATE_EXPIRY_WARNING_DAYS", tt.value); err != nil {
+				t.Fatalf("Setenv: %v", err)
+			}
+			defer os.Unsetenv("DIAGNOSTIC_CERTIFICATE_EXPIRY_WARNING_DAYS")
+
+			if got := getCertificateExpiryWarningDays(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getCertificateExpiryWarningDays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
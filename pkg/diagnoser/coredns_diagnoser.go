@@ -0,0 +1,253 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// coreDNSMinResponses defines the number of responses below which response code rates are not reported
+	coreDNSMinResponses = 100
+	// coreDNSMaxServfailRate defines the share of SERVFAIL responses above which CoreDNS is reported
+	coreDNSMaxServfailRate = 0.01
+	// coreDNSMaxNXDomainRate defines the share of NXDOMAIN responses above which CoreDNS is reported
+	coreDNSMaxNXDomainRate = 0.5
+)
+
+type coreDNSDiagnosticDatum struct {
+	HostName string `json:"HostName"`
+	Source   string `json:"Source"`
+	Zone     string `json:"Zone,omitempty"`
+	Level    string `json:"Level"`
+	Message  string `json:"Message"`
+}
+
+// CoreDNSDiagnoser defines a CoreDNS Diagnoser struct
+type CoreDNSDiagnoser struct {
+	coreDNSCollector *collector.CoreDNSCollector
+	data             map[string]string
+}
+
+// NewCoreDNSDiagnoser is a constructor
+func NewCoreDNSDiagnoser(coreDNSCollector *collector.CoreDNSCollector) *CoreDNSDiagnoser {
+	return &CoreDNSDiagnoser{
+		coreDNSCollector: coreDNSCollector,
+		data:             make(map[string]string),
+	}
+}
+
+func (diagnoser *CoreDNSDiagnoser) GetName() string {
+	return "coredns"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *CoreDNSDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	data := diagnoser.coreDNSCollector.GetData()
+
+	configMaps := map[string]map[string]string{}
+	for _, name := range []string{"coredns", "coredns-custom"} {
+		if content, ok := data["configmap_"+name]; ok {
+			configMap := map[string]string{}
+			if err := json.Unmarshal([]byte(content), &configMap); err != nil {
+				return fmt.Errorf("unmarshal ConfigMap %s: %w", name, err)
+			}
+			configMaps[name] = configMap
+		}
+	}
+
+	endpoints := collector.CoreDNSEndpoints{}
+	if content, ok := data["endpoints"]; ok {
+		if err := json.Unmarshal([]byte(content), &endpoints); err != nil {
+			return fmt.Errorf("unmarshal CoreDNS endpoints: %w", err)
+		}
+	}
+
+	forwardTargets := []collector.CoreDNSForwardTarget{}
+	if content, ok := data["forward"]; ok {
+		if err := json.Unmarshal([]byte(content), &forwardTargets); err != nil {
+			return fmt.Errorf("unmarshal CoreDNS forward targets: %w", err)
+		}
+	}
+
+	coreDNSDiagnosticData := []coreDNSDiagnosticDatum{}
+	newDatum := func(source string, zone string, level string, message string) {
+		coreDNSDiagnosticData = append(coreDNSDiagnosticData, coreDNSDiagnosticDatum{
+			HostName: hostName,
+			Source:   source,
+			Zone:     zone,
+			Level:    level,
+			Message:  message,
+		})
+	}
+
+	if _, ok := configMaps["coredns"]; ok {
+		blocks, err := collector.ParseCoreDNSConfigMaps(configMaps["coredns"], configMaps["coredns-custom"])
+		if err != nil {
+			newDatum("configmap", "", "Error", "Corefile cannot be parsed: "+err.Error())
+		}
+
+		for _, block := range blocks {
+			diagnoseCorefileServerBlock(&block, &endpoints, newDatum)
+		}
+	}
+
+	for _, target := range forwardTargets {
+		if target.ResolvConf != "" {
+			target.Target += " (from " + target.ResolvConf + ")"
+		}
+
+		switch target.Status {
+		case "NOERROR", "NXDOMAIN", "Skipped":
+		case "Invalid":
+			newDatum(target.Source, target.Zone, "Error", fmt.Sprintf("Forward target %s is invalid: %s", target.Target, target.Error))
+		default:
+			message := fmt.Sprintf("Forward target %s does not resolve queries (%s)", target.Target, target.Status)
+			if target.Error != "" {
+				message += ": " + target.Error
+			}
+			newDatum(target.Source, target.Zone, "Error", message)
+		}
+	}
+
+	for key, content := range data {
+		switch {
+		case strings.HasPrefix(key, "logs_"):
+			if strings.Contains(content, "plugin/loop: Loop") {
+				newDatum(key, "", "Error", "CoreDNS detected a forwarding loop, its upstream nameservers forward queries back to it")
+			}
+		case strings.HasPrefix(key, "metrics_"):
+			diagnoseCoreDNSMetrics(key, content, newDatum)
+		}
+	}
+
+	dataBytes, err := json.Marshal(coreDNSDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from CoreDNS Diagnoser: %w", err)
+	}
+
+	diagnoser.data["coredns"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *CoreDNSDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseCorefileServerBlock reports loops, a missing cache and custom server blocks overriding the cluster domain
+func diagnoseCorefileServerBlock(block *collector.CorefileServerBlock, endpoints *collector.CoreDNSEndpoints, newDatum func(string, string, string, string)) {
+	zones := strings.Join(block.Zones(), " ")
+	forwards := false
+
+	for i := range block.Plugins {
+		for _, target := range collector.GetCorefileForwardTargets(&block.Plugins[i]) {
+			forwards = true
+
+			host := strings.TrimPrefix(strings.TrimPrefix(target, "dns://"), "tls://")
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil {
+				continue
+			}
+
+			if ip.IsLoopback() {
+				newDatum(block.Source, zones, "Error", fmt.Sprintf("Forward target %s is a loopback address, queries are forwarded back to CoreDNS itself", target))
+			} else if host == endpoints.ServiceIP || containsString(endpoints.PodIPs, host) {
+				newDatum(block.Source, zones, "Error", fmt.Sprintf("Forward target %s is CoreDNS itself, queries loop", target))
+			}
+		}
+	}
+
+	if forwards && !block.HasPlugin("cache") {
+		newDatum(block.Source, zones, "Warning", "Server block forwards queries without the cache plugin, every query is sent upstream")
+	}
+
+	if strings.HasPrefix(block.Source, "coredns-custom/") {
+		for _, zone := range block.Zones() {
+			zone = strings.TrimSuffix(zone, ".")
+			if zone == "" || zone == "cluster.local" || strings.HasSuffix(zone, ".cluster.local") {
+				newDatum(block.Source, zones, "Error", fmt.Sprintf("Custom server block for %q overrides the cluster domain, cluster service names may not resolve", zone+"."))
+			}
+		}
+	}
+}
+
+// diagnoseCoreDNSMetrics reports high SERVFAIL and NXDOMAIN rates from the response counters of a CoreDNS pod
+func diagnoseCoreDNSMetrics(source string, metrics string, newDatum func(string, string, string, string)) {
+	rcodes := parseCoreDNSResponseCodes(metrics)
+
+	total := 0.0
+	for _, count := range rcodes {
+		total += count
+	}
+
+	if total < coreDNSMinResponses {
+		return
+	}
+
+	if rate := rcodes["SERVFAIL"] / total; rate > coreDNSMaxServfailRate {
+		newDatum(source, "", "Warning", fmt.Sprintf("%.1f%% of %.0f responses are SERVFAIL, upstream nameservers may be failing or unreachable", rate*100, total))
+	}
+
+	if rate := rcodes["NXDOMAIN"] / total; rate > coreDNSMaxNXDomainRate {
+		newDatum(source, "", "Warning", fmt.Sprintf("%.1f%% of %.0f responses are NXDOMAIN, clients may be expanding names through the search domains (ndots)", rate*100, total))
+	}
+}
+
+// parseCoreDNSResponseCodes sums the response counters by response code from Prometheus text metrics
+func parseCoreDNSResponseCodes(metrics string) map[string]float64 {
+	rcodes := map[string]float64{}
+
+	for _, line := range strings.Split(metrics, "\n") {
+		// coredns_dns_responses_total since CoreDNS 1.7.0, coredns_dns_response_rcode_count_total before
+		if !strings.HasPrefix(line, "coredns_dns_responses_total{") && !strings.HasPrefix(line, "coredns_dns_response_rcode_count_total{") {
+			continue
+		}
+
+		end := strings.LastIndex(line, "}")
+		if end < 0 {
+			continue
+		}
+
+		fields := strings.Fields(line[end+1:])
+		if len(fields) == 0 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+
+		for _, label := range strings.Split(line[strings.Index(line, "{")+1:end], ",") {
+			if strings.HasPrefix(label, "rcode=") {
+				rcodes[strings.Trim(strings.TrimPrefix(label, "rcode="), `"`)] += value
+			}
+		}
+	}
+
+	return rcodes
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package diagnoser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnoseCorefileServerBlock(t *testing.T) {
+	endpoints := &collector.CoreDNSEndpoints{ServiceIP: "10.0.0.10", PodIPs: []string{"10.244.0.5", "10.244.1.7"}}
+
+	tests := []struct {
+		name    string
+		source  string
+		content string
+		want    []testFinding
+	}{
+		{
+			name:    "default server block",
+			source:  "coredns/Corefile",
+			content: ".:53 {\n    forward . /etc/resolv.conf\n    cache 30\n}\n",
+			want:    []testFinding{},
+		},
+		{
+			name:    "loopback forward target",
+			source:  "coredns/Corefile",
+			content: ".:53 {\n    forward . 127.0.0.1:53\n    cache 30\n}\n",
+			want: []testFinding{
+				{"coredns/Corefile", "Error", "Forward target 127.0.0.1:53 is a loopback address, queries are forwarded back to CoreDNS itself"},
+			},
+		},
+		{
+			name:    "forward to the CoreDNS service",
+			source:  "coredns-custom/corp.server",
+			content: "corp.contoso.com:53 {\n    forward . dns://10.0.0.10\n    cache 30\n}\n",
+			want: []testFinding{
+				{"coredns-custom/corp.server", "Error", "Forward target dns://10.0.0.10 is CoreDNS itself, queries loop"},
+			},
+		},
+		{
+			name:    "forward to a CoreDNS pod without cache",
+			source:  "coredns-custom/corp.server",
+			content: "corp.contoso.com:53 {\n    forward . 10.1.0.4 10.244.1.7\n}\n",
+			want: []testFinding{
+				{"coredns-custom/corp.server", "Error", "Forward target 10.244.1.7 is CoreDNS itself, queries loop"},
+				{"coredns-custom/corp.server", "Warning", "Server block forwards queries without the cache plugin, every query is sent upstream"},
+			},
+		},
+		{
+			name:    "custom server block for the cluster domain",
+			source:  "coredns-custom/local.server",
+			content: "cluster.local:53 {\n    forward . 10.1.0.4\n    cache 30\n}\n",
+			want: []testFinding{
+				{"coredns-custom/local.server", "Error", `Custom server block for "cluster.local." overrides the cluster domain, cluster service names may not resolve`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := collector.ParseCorefile(tt.source, tt.content)
+			if err != nil {
+				t.Fatalf("ParseCorefile() error = %v", err)
+			}
+
+			got := []testFinding{}
+			diagnoseCorefileServerBlock(&blocks[0], endpoints, func(source string, zone string, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
+
+func TestDiagnoseCoreDNSMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		want    []testFinding
+	}{
+		{
+			name:    "too few responses",
+			metrics: "coredns_dns_responses_total{rcode=\"SERVFAIL\",server=\"dns://:53\",zone=\".\"} 50\n",
+			want:    []testFinding{},
+		},
+		{
+			name: "healthy responses",
+			metrics: "coredns_dns_responses_total{rcode=\"NOERROR\",server=\"dns://:53\",zone=\".\"} 900\n" +
+				"coredns_dns_responses_total{rcode=\"NXDOMAIN\",server=\"dns://:53\",zone=\".\"} 100\n",
+			want: []testFinding{},
+		},
+		{
+			name: "SERVFAIL and NXDOMAIN rates",
+			metrics: "coredns_dns_responses_total{rcode=\"NOERROR\",server=\"dns://:53\",zone=\".\"} 300\n" +
+				"coredns_dns_responses_total{rcode=\"NXDOMAIN\",server=\"dns://:53\",zone=\".\"} 600\n" +
+				"coredns_dns_responses_total{rcode=\"SERVFAIL\",server=\"dns://:53\",zone=\".\"} 100\n",
+			want: []testFinding{
+				{"metrics_coredns-0", "Warning", "10.0% of 1000 responses are SERVFAIL, upstream nameservers may be failing or unreachable"},
+				{"metrics_coredns-0", "Warning", "60.0% of 1000 responses are NXDOMAIN, clients may be expanding names through the search domains (ndots)"},
+			},
+		},
+		{
+			name:    "metrics not collected",
+			metrics: "Failed to get metrics: the server could not find the requested resource",
+			want:    []testFinding{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseCoreDNSMetrics("metrics_coredns-0", tt.metrics, func(source string, zone string, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseCoreDNSResponseCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		want    map[string]float64
+	}{
+		{
+			name: "responses of several servers and zones",
+			metrics: "# HELP coredns_dns_responses_total Counter of response status codes.\n" +
+				"# TYPE coredns_dns_responses_total counter\n" +
+				"coredns_dns_responses_total{plugin=\"cache\",rcode=\"NOERROR\",server=\"dns://:53\",zone=\".\"} 120\n" +
+				"coredns_dns_responses_total{plugin=\"\",rcode=\"NOERROR\",server=\"dns://:53\",zone=\"corp.contoso.com.\"} 30\n" +
+				"coredns_dns_responses_total{plugin=\"\",rcode=\"SERVFAIL\",server=\"dns://:53\",zone=\".\"} 2.5e+01\n" +
+				"coredns_dns_requests_total{proto=\"udp\",server=\"dns://:53\",type=\"A\",zone=\".\"} 200\n",
+			want: map[string]float64{"NOERROR": 150, "SERVFAIL": 25},
+		},
+		{
+			name: "response codes before CoreDNS 1.7.0",
+			metrics: "coredns_dns_response_rcode_count_total{rcode=\"NXDOMAIN\",server=\"dns://:53\",zone=\".\"} 40\n" +
+				"coredns_dns_response_rcode_count_total{rcode=\"NOERROR\",server=\"dns://:53\",zone=\".\"} 60\n",
+			want: map[string]float64{"NXDOMAIN": 40, "NOERROR": 60},
+		},
+		{
+			name:    "invalid values",
+			metrics: "coredns_dns_responses_total{rcode=\"NOERROR\",server=\"dns://:53\",zone=\".\"} many\ncoredns_dns_responses_total{rcode=\"NOERROR\"}\n",
+			want:    map[string]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCoreDNSResponseCodes(tt.metrics); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCoreDNSResponseCodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
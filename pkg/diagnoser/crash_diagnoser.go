@@ -0,0 +1,313 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// crashLogLines defines the number of log lines reported before a container terminated
+	crashLogLines = 10
+	// oomKillMatchWindow defines how far apart an OOM kill of the kernel and the termination of a container reported
+	// by the kubelet may be to be the same kill
+	oomKillMatchWindow = 5 * time.Minute
+)
+
+type crashDiagnosticDatum struct {
+	HostName     string   `json:"HostName"`
+	Namespace    string   `json:"Namespace"`
+	Pod          string   `json:"Pod"`
+	Container    string   `json:"Container"`
+	State        string   `json:"State"`
+	RestartCount int32    `json:"RestartCount"`
+	Reason       string   `json:"Reason,omitempty"`
+	ExitCode     int32    `json:"ExitCode,omitempty"`
+	FinishedAt   string   `json:"FinishedAt,omitempty"`
+	OOMScope     string   `json:"OOMScope,omitempty"`
+	MemoryLimit  int64    `json:"MemoryLimit,omitempty"`
+	MemoryUsage  int64    `json:"MemoryUsage,omitempty"`
+	OOMAnonRSS   int64    `json:"OOMAnonRSS,omitempty"`
+	LastLogLines []string `json:"LastLogLines,omitempty"`
+	Level        string   `json:"Level"`
+	Message      string   `json:"Message"`
+}
+
+// CrashDiagnoser defines a Crash Diagnoser struct, which diagnoses the containers of the node from the node collectors,
+// so it reports nothing in connectedCluster mode
+type CrashDiagnoser struct {
+	nodeCollector              *collector.NodeCollector
+	kernelCollector            *collector.KernelCollector
+	systemPerfCollector        *collector.SystemPerfCollector
+	nodeContainerLogsCollector *collector.NodeContainerLogsCollector
+	data                       map[string]string
+}
+
+// NewCrashDiagnoser is a constructor
+func NewCrashDiagnoser(
+	nodeCollector *collector.NodeCollector,
+	kernelCollector *collector.KernelCollector,
+	systemPerfCollector *collector.SystemPerfCollector,
+	nodeContainerLogsCollector *collector.NodeContainerLogsCollector,
+) *CrashDiagnoser {
+	return &CrashDiagnoser{
+		nodeCollector:              nodeCollector,
+		kernelCollector:            kernelCollector,
+		systemPerfCollector:        systemPerfCollector,
+		nodeContainerLogsCollector: nodeContainerLogsCollector,
+		data:                       make(map[string]string),
+	}
+}
+
+func (diagnoser *CrashDiagnoser) GetName() string {
+	return "crash"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *CrashDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	// OOM kills are recorded by the kernel of the node, so the containers of the node are diagnosed
+	pods := []collector.NodePodStatus{}
+	if data, ok := diagnoser.nodeCollector.GetData()["node_podstatuses"]; ok {
+		if err := json.Unmarshal([]byte(data), &pods); err != nil {
+			return fmt.Errorf("unmarshal pod statuses: %w", err)
+		}
+	}
+
+	oomKills := []collector.OOMKillRecord{}
+	if data, ok := diagnoser.kernelCollector.GetData()["oomkills"]; ok {
+		if err := json.Unmarshal([]byte(data), &oomKills); err != nil {
+			return fmt.Errorf("unmarshal oom kills: %w", err)
+		}
+	}
+
+	// Usage is optional, metrics may not be available
+	usage := map[string]int64{}
+	if data, ok := diagnoser.systemPerfCollector.GetData()["pods"]; ok {
+		podMetrics := []collector.PodMetrics{}
+		if err := json.Unmarshal([]byte(data), &podMetrics); err == nil {
+			for _, metrics := range podMetrics {
+				usage[metrics.Namespace+"/"+metrics.PodName+"/"+metrics.ContainerName] = metrics.MemoryUsage
+			}
+		}
+	}
+
+	crashDiagnosticData := []crashDiagnosticDatum{}
+	for i := range pods {
+		pod := &pods[i]
+
+		statuses := append(append([]v1.ContainerStatus{}, pod.InitContainerStatuses...), pod.ContainerStatuses...)
+		for _, status := range statuses {
+			datum, ok := diagnoseContainerStatus(hostName, pod, &status)
+			if !ok {
+				continue
+			}
+
+			datum.MemoryLimit = pod.MemoryLimits[status.Name]
+			datum.MemoryUsage = usage[pod.Namespace+"/"+pod.Name+"/"+status.Name]
+
+			diagnoseOOMKill(&datum, pod, &status, oomKills)
+			datum.LastLogLines = diagnoser.getLastLogLines(pod.Namespace, pod.Name, status.Name)
+			if datum.LastLogLines == nil {
+				datum.Message += fmt.Sprintf("; logs of the container were not collected, add %s to DIAGNOSTIC_CONTAINERLOGS_LIST", pod.Namespace)
+			}
+
+			crashDiagnosticData = append(crashDiagnosticData, datum)
+		}
+	}
+
+	dataBytes, err := json.Marshal(crashDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Crash Diagnoser: %w", err)
+	}
+
+	diagnoser.data["crash"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *CrashDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// getLastLogLines returns the last lines the container logged before it terminated, from the logs of its previous
+// instance on the node when it restarted
+func (diagnoser *CrashDiagnoser) getLastLogLines(namespace string, pod string, container string) []string {
+	data := diagnoser.nodeContainerLogsCollector.GetData()
+	logKey := namespace + "_" + pod + "_" + container
+	logs, ok := data[logKey+"_previous"]
+	if !ok {
+		logs, ok = data[logKey]
+	}
+	if !ok {
+		return nil
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > crashLogLines {
+		lines = lines[len(lines)-crashLogLines:]
+	}
+	return lines
+}
+
+// diagnoseContainerStatus reports containers which are crash looping, were OOM killed or terminated with an error,
+// from their current and last termination states
+func diagnoseContainerStatus(hostName string, pod *collector.NodePodStatus, status *v1.ContainerStatus) (crashDiagnosticDatum, bool) {
+	datum := crashDiagnosticDatum{
+		HostName:     hostName,
+		Namespace:    pod.Namespace,
+		Pod:          pod.Name,
+		Container:    status.Name,
+		RestartCount: status.RestartCount,
+	}
+
+	crashLooping := false
+	switch {
+	case status.State.Waiting != nil:
+		datum.State = status.State.Waiting.Reason
+		crashLooping = status.State.Waiting.Reason == "CrashLoopBackOff"
+	case status.State.Running != nil:
+		datum.State = "Running"
+	case status.State.Terminated != nil:
+		datum.State = "Terminated"
+	}
+
+	// A container which terminated and was not restarted yet only has a current termination state
+	terminated := status.LastTerminationState.Terminated
+	if status.State.Terminated != nil {
+		terminated = status.State.Terminated
+	}
+
+	if terminated != nil {
+		datum.Reason = terminated.Reason
+		datum.ExitCode = terminated.ExitCode
+		if !terminated.FinishedAt.IsZero() {
+			datum.FinishedAt = terminated.FinishedAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	oomKilled := datum.Reason == "OOMKilled"
+	failed := terminated != nil && terminated.ExitCode != 0
+	if !crashLooping && !oomKilled && !failed {
+		return datum, false
+	}
+
+	datum.Level = "Warning"
+	if crashLooping || oomKilled {
+		datum.Level = "Error"
+	}
+
+	datum.Message = fmt.Sprintf("Container %s/%s/%s is %s after %d restarts", pod.Namespace, pod.Name, status.Name, datum.State, status.RestartCount)
+	if terminated != nil {
+		datum.Message += fmt.Sprintf(", it last terminated with %s (exit code %d)", terminated.Reason, terminated.ExitCode)
+		switch {
+		case terminated.ExitCode == 137 && !oomKilled:
+			datum.Message += ", killed by SIGKILL, e.g. after failing its liveness probe or not stopping within its termination grace period"
+		case terminated.ExitCode == 143:
+			datum.Message += ", stopped by SIGTERM"
+		case terminated.ExitCode == 128 || terminated.ExitCode == 127 || terminated.ExitCode == 126:
+			datum.Message += ", its command could not be run"
+		}
+	}
+
+	return datum, true
+}
+
+// diagnoseOOMKill matches the OOM kills of the kernel with a terminated container, and tells whether the container
+// reached its memory limit or the node ran out of memory
+func diagnoseOOMKill(datum *crashDiagnosticDatum, pod *collector.NodePodStatus, status *v1.ContainerStatus, oomKills []collector.OOMKillRecord) {
+	var finishedAt time.Time
+	containerIDs := map[string]bool{}
+	for _, terminated := range []*v1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+		if terminated == nil {
+			continue
+		}
+		if finishedAt.IsZero() {
+			finishedAt = terminated.FinishedAt.Time
+		}
+		containerIDs[trimContainerID(terminated.ContainerID)] = true
+	}
+
+	var match *collector.OOMKillRecord
+	for i := range oomKills {
+		oomKill := &oomKills[i]
+		if oomKill.PodUID != string(pod.UID) {
+			continue
+		}
+		// Pod level cgroups do not tell the container, the time of the kill does
+		if oomKill.ContainerID != "" && !containerIDs[oomKill.ContainerID] {
+			continue
+		}
+		if oomKill.ContainerID == "" && (finishedAt.IsZero() || absDuration(oomKill.TimeStamp.Sub(finishedAt)) > oomKillMatchWindow) {
+			continue
+		}
+		if match == nil || oomKill.TimeStamp.After(match.TimeStamp) {
+			match = oomKill
+		}
+	}
+
+	if match == nil {
+		if datum.Reason == "OOMKilled" {
+			datum.Message += "; the kernel OOM kill record was not found, the kernel ring buffer may have been overwritten"
+			datum.Message += describeMemoryLimit(datum)
+		}
+		return
+	}
+
+	datum.OOMScope = match.Scope
+	datum.OOMAnonRSS = match.AnonRSSKB * 1024
+	datum.Level = "Error"
+
+	if match.Scope == "cgroup" {
+		datum.Message += fmt.Sprintf("; the kernel killed process %s at %s because the container reached its memory limit", match.Process, match.TimeStamp.UTC().Format(time.RFC3339))
+	} else {
+		datum.Message += fmt.Sprintf("; the kernel killed process %s at %s because the node ran out of memory, not because of the memory limit of the container, the node memory is overcommitted", match.Process, match.TimeStamp.UTC().Format(time.RFC3339))
+	}
+
+	if datum.OOMAnonRSS > 0 {
+		datum.Message += fmt.Sprintf(", it used %d MiB of anonymous memory", datum.OOMAnonRSS/1024/1024)
+	}
+	datum.Message += describeMemoryLimit(datum)
+}
+
+func describeMemoryLimit(datum *crashDiagnosticDatum) string {
+	message := ""
+	if datum.MemoryLimit > 0 {
+		message += fmt.Sprintf("; its memory limit is %d MiB", datum.MemoryLimit/1024/1024)
+	} else {
+		message += "; it has no memory limit"
+	}
+	if datum.MemoryUsage > 0 {
+		message += fmt.Sprintf(" and it uses %d MiB now", datum.MemoryUsage/1024/1024)
+	}
+	return message
+}
+
+// trimContainerID removes the runtime scheme of a container ID reported by the kubelet, such as containerd://
+func trimContainerID(containerID string) string {
+	if i := strings.Index(containerID, "://"); i >= 0 {
+		return containerID[i+3:]
+	}
+	return containerID
+}
+
+func absDuration(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return -duration
+	}
+	return duration
+}
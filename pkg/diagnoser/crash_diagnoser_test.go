@@ -0,0 +1,148 @@
+package diagnoser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiagnoseContainerStatus(t *testing.T) {
+	finishedAt := metav1.NewTime(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	pod := &collector.NodePodStatus{Namespace: "default", Name: "web-0"}
+
+	tests := []struct {
+		name        string
+		status      v1.ContainerStatus
+		wantOK      bool
+		wantLevel   string
+		wantMessage string
+	}{
+		{
+			name: "crash looping",
+			status: v1.ContainerStatus{
+				RestartCount:         5,
+				State:                v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1, FinishedAt: finishedAt}},
+			},
+			wantOK:      true,
+			wantLevel:   "Error",
+			wantMessage: "is CrashLoopBackOff after 5 restarts, it last terminated with Error (exit code 1)",
+		},
+		{
+			name: "failed without restart",
+			status: v1.ContainerStatus{
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 2, FinishedAt: finishedAt}},
+			},
+			wantOK:      true,
+			wantLevel:   "Warning",
+			wantMessage: "is Terminated after 0 restarts, it last terminated with Error (exit code 2)",
+		},
+		{
+			name: "killed by SIGKILL",
+			status: v1.ContainerStatus{
+				RestartCount:         1,
+				State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 137}},
+			},
+			wantOK:      true,
+			wantLevel:   "Warning",
+			wantMessage: "killed by SIGKILL",
+		},
+		{
+			name: "OOM killed",
+			status: v1.ContainerStatus{
+				RestartCount:         1,
+				State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			},
+			wantOK:      true,
+			wantLevel:   "Error",
+			wantMessage: "it last terminated with OOMKilled (exit code 137)",
+		},
+		{
+			name: "completed",
+			status: v1.ContainerStatus{
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed"}},
+			},
+		},
+		{
+			name:   "running",
+			status: v1.ContainerStatus{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.status.Name = "web"
+			got, ok := diagnoseContainerStatus("node-0", pod, &tt.status)
+			if ok != tt.wantOK {
+				t.Fatalf("diagnoseContainerStatus() = %+v, %v, want %v", got, ok, tt.wantOK)
+			}
+			if ok && (got.Level != tt.wantLevel || !strings.Contains(got.Message, tt.wantMessage)) {
+				t.Errorf("diagnoseContainerStatus() = %s %q, want %s containing %q", got.Level, got.Message, tt.wantLevel, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDiagnoseOOMKill(t *testing.T) {
+	finishedAt := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	pod := &collector.NodePodStatus{Namespace: "default", Name: "web-0", UID: "5f0c5b3e-1b0a-4a1e-9d6e-6a3f1f0b2c11"}
+	status := &v1.ContainerStatus{
+		Name: "web",
+		LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			Reason:      "OOMKilled",
+			ExitCode:    137,
+			FinishedAt:  metav1.NewTime(finishedAt),
+			ContainerID: "containerd://0a1b2c3d",
+		}},
+	}
+
+	tests := []struct {
+		name        string
+		oomKills    []collector.OOMKillRecord
+		wantScope   string
+		wantMessage string
+	}{
+		{
+			name: "container cgroup reaching its limit",
+			oomKills: []collector.OOMKillRecord{
+				{TimeStamp: finishedAt, Scope: "cgroup", Process: "java", PodUID: string(pod.UID), ContainerID: "0a1b2c3d", AnonRSSKB: 512 * 1024},
+			},
+			wantScope:   "cgroup",
+			wantMessage: "killed process java at 2021-10-01T12:00:00Z because the container reached its memory limit, it used 512 MiB of anonymous memory",
+		},
+		{
+			name: "node out of memory, pod cgroup matched by time",
+			oomKills: []collector.OOMKillRecord{
+				{TimeStamp: finishedAt.Add(-10 * time.Minute), Scope: "cgroup", Process: "java", PodUID: string(pod.UID)},
+				{TimeStamp: finishedAt.Add(-time.Minute), Scope: "node", Process: "java", PodUID: string(pod.UID)},
+			},
+			wantScope:   "node",
+			wantMessage: "because the node ran out of memory",
+		},
+		{
+			name: "kills of other pods and containers",
+			oomKills: []collector.OOMKillRecord{
+				{TimeStamp: finishedAt, Scope: "cgroup", Process: "java", PodUID: "other"},
+				{TimeStamp: finishedAt, Scope: "cgroup", Process: "sidecar", PodUID: string(pod.UID), ContainerID: "4e5f6a7b"},
+				{TimeStamp: finishedAt.Add(-time.Hour), Scope: "node", Process: "java", PodUID: string(pod.UID)},
+			},
+			wantMessage: "the kernel OOM kill record was not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datum := crashDiagnosticDatum{Reason: "OOMKilled", MemoryLimit: 1024 * 1024 * 1024}
+			diagnoseOOMKill(&datum, pod, status, tt.oomKills)
+			if datum.OOMScope != tt.wantScope || !strings.Contains(datum.Message, tt.wantMessage) || !strings.Contains(datum.Message, "its memory limit is 1024 MiB") {
+				t.Errorf("diagnoseOOMKill() = %s %q, want %s containing %q", datum.OOMScope, datum.Message, tt.wantScope, tt.wantMessage)
+			}
+		})
+	}
+}
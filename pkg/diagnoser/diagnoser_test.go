@@ -0,0 +1,27 @@
+package diagnoser
+
+import (
+	"strings"
+	"testing"
+)
+
+// testFinding defines the source, level and a fragment of the message of a diagnostic finding
+type testFinding struct {
+	source  string
+	level   string
+	message string
+}
+
+// checkFindings compares the findings of a diagnoser, in order, with the wanted ones
+func checkFindings(t *testing.T, got []testFinding, want []testFinding) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].source != want[i].source || got[i].level != want[i].level || !strings.Contains(got[i].message, want[i].message) {
+			t.Errorf("finding %d = %s %s %q, want %s %s containing %q", i, got[i].source, got[i].level, got[i].message, want[i].source, want[i].level, want[i].message)
+		}
+	}
+}
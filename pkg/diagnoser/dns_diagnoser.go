@@ -0,0 +1,200 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// azureDNSServer is the Azure-provided DNS, which resolves the private DNS zones linked to the VNet
+	azureDNSServer = "168.63.129.16"
+	// dnsSlowLatencyMs defines the resolution latency above which a nameserver is reported as slow
+	dnsSlowLatencyMs = 1000
+)
+
+type dnsDiagnosticDatum struct {
+	HostName   string `json:"HostName"`
+	Name       string `json:"Name"`
+	ResolvConf string `json:"ResolvConf"`
+	Nameserver string `json:"Nameserver"`
+	Protocol   string `json:"Protocol"`
+	Level      string `json:"Level"`
+	Message    string `json:"Message"`
+}
+
+// DNSDiagnoser defines a DNS Diagnoser struct
+type DNSDiagnoser struct {
+	dnsCollector *collector.DNSCollector
+	data         map[string]string
+}
+
+// NewDNSDiagnoser is a constructor
+func NewDNSDiagnoser(dnsCollector *collector.DNSCollector) *DNSDiagnoser {
+	return &DNSDiagnoser{
+		dnsCollector: dnsCollector,
+		data:         make(map[string]string),
+	}
+}
+
+func (diagnoser *DNSDiagnoser) GetName() string {
+	return "dns"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *DNSDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	resolutions := []collector.DNSResolution{}
+	if data, ok := diagnoser.dnsCollector.GetData()["resolution"]; ok {
+		if err := json.Unmarshal([]byte(data), &resolutions); err != nil {
+			return fmt.Errorf("unmarshal DNS resolutions: %w", err)
+		}
+	}
+
+	dnsDiagnosticData := diagnoseDNSResolutions(hostName, resolutions)
+
+	dataBytes, err := json.Marshal(dnsDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from DNS Diagnoser: %w", err)
+	}
+
+	diagnoser.data["dns"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *DNSDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseDNSResolutions reports, for each name and nameserver, the failures seen over UDP and TCP
+func diagnoseDNSResolutions(hostName string, resolutions []collector.DNSResolution) []dnsDiagnosticDatum {
+	dnsDiagnosticData := []dnsDiagnosticDatum{}
+
+	type resolutionKey struct {
+		resolvConf string
+		name       string
+		nameserver string
+	}
+
+	byProtocol := map[resolutionKey]map[string]collector.DNSResolution{}
+	for _, resolution := range resolutions {
+		key := resolutionKey{resolution.ResolvConf, resolution.Name, resolution.Nameserver}
+		if byProtocol[key] == nil {
+			byProtocol[key] = map[string]collector.DNSResolution{}
+		}
+		byProtocol[key][resolution.Protocol] = resolution
+	}
+
+	for key, protocols := range byProtocol {
+		newDatum := func(protocol string, level string, message string) dnsDiagnosticDatum {
+			return dnsDiagnosticDatum{
+				HostName:   hostName,
+				Name:       key.name,
+				ResolvConf: key.resolvConf,
+				Nameserver: key.nameserver,
+				Protocol:   protocol,
+				Level:      level,
+				Message:    message,
+			}
+		}
+
+		udp, hasUDP := protocols["udp"]
+		tcp, hasTCP := protocols["tcp"]
+
+		// Report a failure once when both protocols fail the same way
+		if hasUDP && hasTCP && udp.Status == tcp.Status && !isDNSResolutionSucceeded(udp) {
+			if message := getDNSFailureMessage(key.resolvConf, key.name, key.nameserver, "udp,tcp", udp); message != "" {
+				dnsDiagnosticData = append(dnsDiagnosticData, newDatum("udp,tcp", "Error", message))
+			}
+			continue
+		}
+
+		for _, protocol := range []string{"udp", "tcp"} {
+			resolution, ok := protocols[protocol]
+			if !ok {
+				continue
+			}
+
+			if protocol == "udp" && resolution.Truncated {
+				if hasTCP && isDNSResolutionSucceeded(tcp) {
+					dnsDiagnosticData = append(dnsDiagnosticData, newDatum(protocol, "Warning", "Response is truncated over UDP, resolution relies on clients retrying over TCP"))
+				} else {
+					dnsDiagnosticData = append(dnsDiagnosticData, newDatum(protocol, "Error", "Response is truncated over UDP and the nameserver cannot answer over TCP"))
+				}
+				continue
+			}
+
+			if !isDNSResolutionSucceeded(resolution) {
+				if message := getDNSFailureMessage(key.resolvConf, key.name, key.nameserver, protocol, resolution); message != "" {
+					dnsDiagnosticData = append(dnsDiagnosticData, newDatum(protocol, "Error", message))
+				}
+				continue
+			}
+
+			if resolution.LatencyMs > dnsSlowLatencyMs {
+				dnsDiagnosticData = append(dnsDiagnosticData, newDatum(protocol, "Warning", fmt.Sprintf("Resolution took %.0fms", resolution.LatencyMs)))
+			}
+		}
+	}
+
+	sort.Slice(dnsDiagnosticData, func(i, j int) bool {
+		a, b := dnsDiagnosticData[i], dnsDiagnosticData[j]
+		if a.ResolvConf != b.ResolvConf {
+			return a.ResolvConf < b.ResolvConf
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Nameserver != b.Nameserver {
+			return a.Nameserver < b.Nameserver
+		}
+		return a.Protocol < b.Protocol
+	})
+
+	return dnsDiagnosticData
+}
+
+func isDNSResolutionSucceeded(resolution collector.DNSResolution) bool {
+	return resolution.Status == "Skipped" || (resolution.Status == "NOERROR" && (len(resolution.Answers) > 0 || resolution.Truncated))
+}
+
+// getDNSFailureMessage explains why a name could not be resolved by a nameserver over the given comma separated
+// protocols
+func getDNSFailureMessage(resolvConf string, name string, nameserver string, protocols string, resolution collector.DNSResolution) string {
+	protocolNames := strings.Split(strings.ToUpper(protocols), ",")
+	switch resolution.Status {
+	case "NXDOMAIN", "NOERROR":
+		if strings.Contains(name, ".privatelink.") {
+			if resolvConf == "virtualmachine" && nameserver != azureDNSServer {
+				return fmt.Sprintf("Custom VNet DNS %s cannot resolve the privatelink zone of %s, link the private DNS zone to its VNet or forward the zone to %s", nameserver, name, azureDNSServer)
+			}
+			return fmt.Sprintf("Cluster DNS %s cannot resolve the privatelink zone of %s, check the private DNS zone and the upstream nameservers of CoreDNS", nameserver, name)
+		}
+		if resolution.Status == "NOERROR" {
+			return "Name has no address record"
+		}
+		return "Name does not exist"
+	case "SERVFAIL":
+		return "Nameserver failed to resolve the name (SERVFAIL), its upstream nameservers may be unreachable"
+	case "REFUSED":
+		return "Nameserver refused the query"
+	case "Timeout":
+		return fmt.Sprintf("Nameserver did not answer over %s", strings.Join(protocolNames, " or "))
+	case "Error":
+		if len(resolution.Attempts) > 0 {
+			return fmt.Sprintf("Query failed over %s: %s", strings.Join(protocolNames, " and "), resolution.Attempts[len(resolution.Attempts)-1].Error)
+		}
+		return "Query failed over " + strings.Join(protocolNames, " and ")
+	default:
+		return "Nameserver answered " + resolution.Status
+	}
+}
@@ -0,0 +1,127 @@
+package diagnoser
+
+import (
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnoseDNSResolutions(t *testing.T) {
+	resolution := func(protocol string, status string, answers ...string) collector.DNSResolution {
+		return collector.DNSResolution{
+			Name:       "mcr.microsoft.com",
+			ResolvConf: "pod",
+			Nameserver: "10.0.0.10",
+			Protocol:   protocol,
+			Status:     status,
+			Answers:    answers,
+		}
+	}
+	truncated := func(resolution collector.DNSResolution) collector.DNSResolution {
+		resolution.Truncated = true
+		return resolution
+	}
+	failed := func(resolution collector.DNSResolution, err string) collector.DNSResolution {
+		resolution.Attempts = []collector.DNSQueryAttempt{{Status: "Error", Error: err}}
+		return resolution
+	}
+	slow := func(resolution collector.DNSResolution) collector.DNSResolution {
+		resolution.LatencyMs = 1500
+		return resolution
+	}
+
+	type finding struct {
+		protocol string
+		level    string
+		message  string
+	}
+
+	tests := []struct {
+		name        string
+		resolutions []collector.DNSResolution
+		want        []finding
+	}{
+		{
+			name: "resolved over both protocols",
+			resolutions: []collector.DNSResolution{
+				resolution("udp", "NOERROR", "20.1.2.3"),
+				resolution("tcp", "NOERROR", "20.1.2.3"),
+			},
+		},
+		{
+			name: "timeout over both protocols",
+			resolutions: []collector.DNSResolution{
+				resolution("udp", "Timeout"),
+				resolution("tcp", "Timeout"),
+			},
+			want: []finding{
+				{"udp,tcp", "Error", "Nameserver did not answer over UDP or TCP"},
+			},
+		},
+		{
+			name: "query error over both protocols",
+			resolutions: []collector.DNSResolution{
+				failed(resolution("udp", "Error"), "connection refused"),
+				failed(resolution("tcp", "Error"), "connection refused"),
+			},
+			want: []finding{
+				{"udp,tcp", "Error", "Query failed over UDP and TCP: connection refused"},
+			},
+		},
+		{
+			name: "truncated over UDP and resolved over TCP",
+			resolutions: []collector.DNSResolution{
+				truncated(resolution("udp", "NOERROR")),
+				resolution("tcp", "NOERROR", "20.1.2.3"),
+			},
+			want: []finding{
+				{"udp", "Warning", "Response is truncated over UDP, resolution relies on clients retrying over TCP"},
+			},
+		},
+		{
+			name: "truncated over UDP and timeout over TCP",
+			resolutions: []collector.DNSResolution{
+				truncated(resolution("udp", "NOERROR")),
+				resolution("tcp", "Timeout"),
+			},
+			want: []finding{
+				{"tcp", "Error", "Nameserver did not answer over TCP"},
+				{"udp", "Error", "Response is truncated over UDP and the nameserver cannot answer over TCP"},
+			},
+		},
+		{
+			name: "timeout over UDP only",
+			resolutions: []collector.DNSResolution{
+				resolution("udp", "Timeout"),
+				slow(resolution("tcp", "NOERROR", "20.1.2.3")),
+			},
+			want: []finding{
+				{"tcp", "Warning", "Resolution took 1500ms"},
+				{"udp", "Error", "Nameserver did not answer over UDP"},
+			},
+		},
+		{
+			name: "single protocol",
+			resolutions: []collector.DNSResolution{
+				resolution("udp", "SERVFAIL"),
+			},
+			want: []finding{
+				{"udp", "Error", "Nameserver failed to resolve the name (SERVFAIL), its upstream nameservers may be unreachable"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diagnoseDNSResolutions("aks-nodepool1-0", tt.resolutions)
+			if len(got) != len(tt.want) {
+				t.Fatalf("diagnoseDNSResolutions() = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if got[i].Protocol != want.protocol || got[i].Level != want.level || got[i].Message != want.message {
+					t.Errorf("diagnoseDNSResolutions()[%d] = %s %s %q, want %s %s %q", i, got[i].Protocol, got[i].Level, got[i].Message, want.protocol, want.level, want.message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package diagnoser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// dockerHubRegistry defines the registry host Docker Hub images are pulled from, whose references have no registry
+// host or the docker.io alias, and which its outbound probes target
+const dockerHubRegistry = "registry-1.docker.io"
+
+// imagePullFailureCategories maps the errors of image pulls to their category, the first match winning since DNS
+// errors are reported while dialing TCP, and the ACR firewall denies clients with a 403 Forbidden
+var imagePullFailureCategories = []struct {
+	category string
+	phrases  []string
+}{
+	{"dns", []string{"no such host", "server misbehaving", "Temporary failure in name resolution", "lookup "}},
+	{"tls", []string{"x509:", "tls:", "certificate"}},
+	{"ratelimit", []string{"toomanyrequests", "429 Too Many Requests"}},
+	{"firewall", []string{"is not allowed access"}},
+	{"auth", []string{"401 Unauthorized", "403 Forbidden", "unauthorized", "authentication required", "insufficient_scope", "denied"}},
+	{"manifest", []string{"manifest unknown", "not found", "NotFound"}},
+	{"tcp", []string{"i/o timeout", "connection refused", "connection reset", "network is unreachable", "no route to host", "context deadline exceeded", "dial tcp"}},
+}
+
+// acrFirewallClientRegex matches the client IP of the error the ACR firewall denies a pull with
+var acrFirewallClientRegex = regexp.MustCompile(`client with IP '([^']+)' is not allowed access`)
+
+type imagePullDiagnosticDatum struct {
+	HostName         string   `json:"HostName"`
+	Image            string   `json:"Image"`
+	Registry         string   `json:"Registry"`
+	Pods             []string `json:"Pods"`
+	Reason           string   `json:"Reason"`
+	Category         string   `json:"Category"`
+	Error            string   `json:"Error,omitempty"`
+	ImagePullSecrets []string `json:"ImagePullSecrets,omitempty"`
+	Outbound         string   `json:"Outbound,omitempty"`
+	Level            string   `json:"Level"`
+	Message          string   `json:"Message"`
+}
+
+// ImagePullDiagnoser defines an Image Pull Diagnoser struct
+type ImagePullDiagnoser struct {
+	kubeconfig               *restclient.Config
+	networkOutboundCollector *collector.NetworkOutboundCollector
+	data                     map[string]string
+}
+
+// NewImagePullDiagnoser is a constructor
+func NewImagePullDiagnoser(config *restclient.Config, networkOutboundCollector *collector.NetworkOutboundCollector) *ImagePullDiagnoser {
+	return &ImagePullDiagnoser{
+		kubeconfig:               config,
+		networkOutboundCollector: networkOutboundCollector,
+		data:                     make(map[string]string),
+	}
+}
+
+func (diagnoser *ImagePullDiagnoser) GetName() string {
+	return "imagepull"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *ImagePullDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(diagnoser.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	ctx := context.Background()
+
+	// Images are pulled by the kubelet of the node, through the same network as the outbound probes of the node
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + hostName})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	podUIDs := map[types.UID]bool{}
+	pulling := false
+	for i := range pods.Items {
+		podUIDs[pods.Items[i].UID] = true
+		for _, status := range append(append([]v1.ContainerStatus{}, pods.Items[i].Status.InitContainerStatuses...), pods.Items[i].Status.ContainerStatuses...) {
+			pulling = pulling || isImagePullFailure(&status)
+		}
+	}
+
+	// Waiting messages of ImagePullBackOff do not tell the error, the latest Failed event of the pod does. Events are
+	// cluster-wide, so they are only listed when a pod of the node fails to pull an image, and filtered by pod
+	events := &v1.EventList{}
+	if pulling {
+		events, err = clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "involvedObject.kind=Pod,reason=Failed"})
+		if err != nil {
+			return fmt.Errorf("list events: %w", err)
+		}
+	}
+
+	pullErrors := map[string]v1.Event{}
+	for _, event := range events.Items {
+		if !podUIDs[event.InvolvedObject.UID] || !strings.Contains(event.Message, "pull image") {
+			continue
+		}
+		key := string(event.InvolvedObject.UID) + "/" + event.InvolvedObject.FieldPath
+		if latest, ok := pullErrors[key]; !ok || getEventTime(&event).After(getEventTime(&latest)) {
+			pullErrors[key] = event
+		}
+	}
+
+	outbound := getOutboundResults(diagnoser.networkOutboundCollector.GetData())
+
+	failures := map[string]*imagePullDiagnosticDatum{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		images := map[string]string{}
+		for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			images[container.Name] = container.Image
+		}
+
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if !isImagePullFailure(&status) {
+				continue
+			}
+			reason := status.State.Waiting.Reason
+
+			image := images[status.Name]
+			datum, ok := failures[image]
+			if !ok {
+				datum = &imagePullDiagnosticDatum{
+					HostName: hostName,
+					Image:    image,
+					Registry: getImageRegistry(image),
+					Reason:   reason,
+					Pods:     []string{},
+				}
+				failures[image] = datum
+			}
+			datum.Pods = append(datum.Pods, pod.Namespace+"/"+pod.Name)
+
+			for _, secret := range pod.Spec.ImagePullSecrets {
+				datum.ImagePullSecrets = appendUnique(datum.ImagePullSecrets, pod.Namespace+"/"+secret.Name)
+			}
+
+			message := status.State.Waiting.Message
+			for _, fieldPath := range []string{"spec.containers{" + status.Name + "}", "spec.initContainers{" + status.Name + "}"} {
+				if event, ok := pullErrors[string(pod.UID)+"/"+fieldPath]; ok {
+					message = event.Message
+				}
+			}
+			if message != "" {
+				datum.Error = message
+			}
+		}
+	}
+
+	imagePullDiagnosticData := []imagePullDiagnosticDatum{}
+	for _, datum := range failures {
+		diagnoseImagePull(datum, outbound[datum.Registry])
+		imagePullDiagnosticData = append(imagePullDiagnosticData, *datum)
+	}
+	sort.Slice(imagePullDiagnosticData, func(i, j int) bool { return imagePullDiagnosticData[i].Image < imagePullDiagnosticData[j].Image })
+
+	dataBytes, err := json.Marshal(imagePullDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Image Pull Diagnoser: %w", err)
+	}
+
+	diagnoser.data["imagepull"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *ImagePullDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// isImagePullFailure tells whether a container is waiting for an image which cannot be pulled
+func isImagePullFailure(status *v1.ContainerStatus) bool {
+	if status.State.Waiting == nil {
+		return false
+	}
+	reason := status.State.Waiting.Reason
+	return reason == "ErrImagePull" || reason == "ImagePullBackOff" || reason == "InvalidImageName"
+}
+
+// getOutboundResults summarizes the outbound probes and required egress checks of the node by host
+func getOutboundResults(outboundData map[string]string) map[string]string {
+	results := map[string]string{}
+
+	keys := []string{}
+	for key := range outboundData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		data := outboundData[key]
+		if key == collector.NetworkOutboundEgressProfileKey {
+			profile := collector.EgressProfileResult{}
+			if err := json.Unmarshal([]byte(data), &profile); err != nil {
+				continue
+			}
+			for _, rule := range profile.Rules {
+				host, _, err := net.SplitHostPort(rule.Endpoint)
+				if err != nil {
+					continue
+				}
+				results[host] = appendOutboundResult(results[host], fmt.Sprintf("required egress rule %s:%d from the node: %s, from the pod network: %s", rule.FQDN, rule.Port, rule.FromNode, rule.FromPod))
+			}
+			continue
+		}
+
+		probes, failures, failedStage := 0, 0, ""
+		host := ""
+		for _, line := range strings.Split(data, "\n") {
+			var datum collector.NetworkOutboundDatum
+			if line == "" || json.Unmarshal([]byte(line), &datum) != nil {
+				continue
+			}
+			host = getProbeHost(datum.URL)
+			probes++
+			if strings.HasPrefix(datum.Status, "Error") {
+				failures++
+				failedStage = datum.FailedStage
+			}
+		}
+		if host == "" || probes == 0 {
+			continue
+		}
+
+		result := fmt.Sprintf("outbound probe %s succeeded %d of %d times", key, probes-failures, probes)
+		if failures > 0 && failedStage != "" {
+			result += ", failing at the " + failedStage + " stage"
+		}
+		results[host] = appendOutboundResult(results[host], result)
+	}
+
+	return results
+}
+
+// diagnoseImagePull classifies the error of an image pull and turns it into a finding, using the outbound results of
+// the registry to tell a registry side error from a network one
+func diagnoseImagePull(datum *imagePullDiagnosticDatum, outbound string) {
+	datum.Outbound = outbound
+	datum.Level = "Error"
+	datum.Category = getImagePullFailureCategory(datum.Error)
+	if datum.Reason == "InvalidImageName" {
+		datum.Category = "name"
+	}
+
+	acr := strings.HasSuffix(datum.Registry, ".azurecr.io")
+	message := fmt.Sprintf("Image %s cannot be pulled for %d pods (%s)", datum.Image, len(datum.Pods), datum.Reason)
+
+	switch datum.Category {
+	case "name":
+		message += ", the image reference is invalid"
+	case "auth":
+		switch {
+		case len(datum.ImagePullSecrets) > 0:
+			message += fmt.Sprintf(", %s rejected the credentials, the image pull secrets %s may be expired or not hold credentials for this registry", datum.Registry, strings.Join(datum.ImagePullSecrets, ", "))
+		case acr:
+			message += fmt.Sprintf(", the kubelet identity is not allowed to pull from %s, attach the registry to the cluster (az aks update --attach-acr) or grant the AcrPull role to the kubelet identity", datum.Registry)
+		default:
+			message += fmt.Sprintf(", %s requires credentials and the pods have no image pull secrets", datum.Registry)
+		}
+	case "firewall":
+		message += fmt.Sprintf(", the network rules of %s deny the IP the node pulls from", datum.Registry)
+		if match := acrFirewallClientRegex.FindStringSubmatch(datum.Error); match != nil {
+			message += " (" + match[1] + ")"
+		}
+		message += ", allow the outbound IP of the cluster in the registry firewall or pull through a private endpoint"
+	case "manifest":
+		message += fmt.Sprintf(", the repository or tag does not exist in %s", datum.Registry)
+		if acr && len(datum.ImagePullSecrets) == 0 {
+			message += ", or the kubelet identity is not allowed to see it"
+		}
+	case "ratelimit":
+		message += fmt.Sprintf(", %s rate limits the pulls, authenticate the pulls or import the image into an Azure Container Registry", datum.Registry)
+	case "dns":
+		message += fmt.Sprintf(", %s cannot be resolved from the node", datum.Registry)
+		if acr {
+			message += ", for a registry with a private endpoint the privatelink.azurecr.io private DNS zone must be linked to the cluster VNet or resolvable by its custom DNS servers"
+		}
+	case "tcp":
+		message += fmt.Sprintf(", the node cannot connect to %s, a firewall, network security group or route table may block it", datum.Registry)
+		if acr {
+			message += fmt.Sprintf(", both %s and its data endpoint (%s.data.azurecr.io) must be allowed", datum.Registry, strings.TrimSuffix(datum.Registry, ".azurecr.io"))
+		}
+	case "tls":
+		message += fmt.Sprintf(", the TLS handshake with %s failed, a proxy or firewall may intercept TLS with a certificate the node does not trust", datum.Registry)
+	default:
+		message += ", the cause could not be classified"
+	}
+
+	if outbound == "" {
+		if datum.Category == "dns" || datum.Category == "tcp" || datum.Category == "tls" {
+			message += fmt.Sprintf("; add %s to DIAGNOSTIC_NETWORKOUTBOUND_TARGETS to probe it", datum.Registry)
+		}
+	} else {
+		message += "; " + outbound
+	}
+
+	datum.Message = message
+}
+
+func getImagePullFailureCategory(message string) string {
+	for _, category := range imagePullFailureCategories {
+		for _, phrase := range category.phrases {
+			if strings.Contains(message, phrase) {
+				return category.category
+			}
+		}
+	}
+	return "other"
+}
+
+// getImageRegistry returns the registry host of an image reference, the first component being a registry when it
+// looks like a host
+func getImageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) < 2 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return dockerHubRegistry
+	}
+
+	host, _, err := net.SplitHostPort(parts[0])
+	if err != nil {
+		host = parts[0]
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		return dockerHubRegistry
+	}
+	return host
+}
+
+// getProbeHost returns the host of a network outbound target, host:port or a tls or https URL
+func getProbeHost(target string) string {
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+func appendOutboundResult(results string, result string) string {
+	if results == "" {
+		return result
+	}
+	return results + "; " + result
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
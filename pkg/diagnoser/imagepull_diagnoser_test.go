@@ -0,0 +1,269 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestGetImagePullFailureCategory(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "ACR anonymous pull",
+			message: `Failed to pull image "myacr.azurecr.io/app:v1": rpc error: code = Unknown desc = failed to pull and unpack image "myacr.azurecr.io/app:v1": failed to resolve reference "myacr.azurecr.io/app:v1": failed to authorize: failed to fetch anonymous token: unexpected status: 401 Unauthorized`,
+			want:    "auth",
+		},
+		{
+			name:    "ACR firewall",
+			message: `Failed to pull image "myacr.azurecr.io/app:v1": rpc error: code = Unknown desc = failed to pull and unpack image "myacr.azurecr.io/app:v1": failed to resolve reference "myacr.azurecr.io/app:v1": unexpected status from HEAD request to https://myacr.azurecr.io/v2/app/manifests/v1: 403 Forbidden: denied: client with IP '20.1.2.3' is not allowed access. Refer https://aka.ms/acr/firewall to grant access.`,
+			want:    "firewall",
+		},
+		{
+			name:    "tag not found with containerd",
+			message: `Failed to pull image "mcr.microsoft.com/oss/nginx/nginx:1.99": rpc error: code = NotFound desc = failed to pull and unpack image "mcr.microsoft.com/oss/nginx/nginx:1.99": failed to resolve reference "mcr.microsoft.com/oss/nginx/nginx:1.99": mcr.microsoft.com/oss/nginx/nginx:1.99: not found`,
+			want:    "manifest",
+		},
+		{
+			name:    "manifest unknown with docker",
+			message: `Failed to pull image "nginx:1.99": rpc error: code = Unknown desc = Error response from daemon: manifest for nginx:1.99 not found: manifest unknown: manifest unknown`,
+			want:    "manifest",
+		},
+		{
+			name:    "Docker Hub rate limit",
+			message: `Failed to pull image "nginx:1.21": rpc error: code = Unknown desc = failed to pull and unpack image "docker.io/library/nginx:1.21": failed to copy: httpReadSeeker: failed open: unexpected status code https://registry-1.docker.io/v2/library/nginx/manifests/sha256:4d4d96ac750af48c6a551d757c1cbfc071692309b491b70b2b8976e102dd3fef: 429 Too Many Requests - Server message: toomanyrequests: You have reached your pull rate limit. You may increase the limit by authenticating and upgrading: https://www.docker.com/increase-rate-limit`,
+			want:    "ratelimit",
+		},
+		{
+			name:    "registry not resolved",
+			message: `Failed to pull image "myacr.azurecr.io/app:v1": rpc error: code = Unknown desc = failed to pull and unpack image "myacr.azurecr.io/app:v1": failed to resolve reference "myacr.azurecr.io/app:v1": failed to do request: Head "https://myacr.azurecr.io/v2/app/manifests/v1": dial tcp: lookup myacr.azurecr.io on 168.63.129.16:53: no such host`,
+			want:    "dns",
+		},
+		{
+			name:    "connection timeout",
+			message: `Failed to pull image "myacr.azurecr.io/app:v1": rpc error: code = Unknown desc = failed to pull and unpack image "myacr.azurecr.io/app:v1": failed to resolve reference "myacr.azurecr.io/app:v1": failed to do request: Head "https://myacr.azurecr.io/v2/app/manifests/v1": dial tcp 20.50.1.2:443: i/o timeout`,
+			want:    "tcp",
+		},
+		{
+			name:    "TLS interception",
+			message: `Failed to pull image "registry.example.com/team/app:v1": rpc error: code = Unknown desc = failed to pull and unpack image "registry.example.com/team/app:v1": failed to resolve reference "registry.example.com/team/app:v1": failed to do request: Head "https://registry.example.com/v2/team/app/manifests/v1": x509: certificate signed by unknown authority`,
+			want:    "tls",
+		},
+		{
+			name:    "unclassified",
+			message: `Back-off pulling image "nginx:1.21"`,
+			want:    "other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getImagePullFailureCategory(tt.message); got != tt.want {
+				t.Errorf("getImagePullFailureCategory() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetImageRegistry(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "registry-1.docker.io"},
+		{image: "bitnami/redis:6.2", want: "registry-1.docker.io"},
+		{image: "docker.io/library/nginx:1.21", want: "registry-1.docker.io"},
+		{image: "index.docker.io/library/nginx:1.21", want: "registry-1.docker.io"},
+		{image: "myacr.azurecr.io/app:v1", want: "myacr.azurecr.io"},
+		{image: "mcr.microsoft.com/oss/nginx/nginx@sha256:4d4d96ac750af48c6a551d757c1cbfc071692309b491b70b2b8976e102dd3fef", want: "mcr.microsoft.com"},
+		{image: "registry.example.com:5000/team/app:v1", want: "registry.example.com"},
+		{image: "localhost/app", want: "localhost"},
+		{image: "localhost:5000/app", want: "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := getImageRegistry(tt.image); got != tt.want {
+				t.Errorf("getImageRegistry() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProbeHost(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "tls://kubernetes.default.svc.cluster.local:443", want: "kubernetes.default.svc.cluster.local"},
+		{target: "https://mcr.microsoft.com/v2/", want: "mcr.microsoft.com"},
+		{target: "https://registry-1.docker.io/v2/#401", want: "registry-1.docker.io"},
+		{target: "myacr.azurecr.io:443", want: "myacr.azurecr.io"},
+		{target: "myacr.azurecr.io", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := getProbeHost(tt.target); got != tt.want {
+				t.Errorf("getProbeHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOutboundResults(t *testing.T) {
+	timeStamp := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	probeLine := func(status string, failedStage string) string {
+		datum := map[string]interface{}{
+			"TimeStamp":   timeStamp,
+			"Type":        "Microsoft-Container-Registry",
+			"URL":         "https://mcr.microsoft.com/v2/",
+			"Status":      status,
+			"FailedStage": failedStage,
+		}
+		dataBytes, err := json.Marshal(datum)
+		if err != nil {
+			t.Fatalf("marshal probe: %v", err)
+		}
+		return string(dataBytes)
+	}
+
+	profile, err := json.Marshal(collector.EgressProfileResult{
+		Profile: "aks-required-egress",
+		Rules: []collector.EgressRuleResult{{
+			EgressRule: collector.EgressRule{FQDN: "mcr.microsoft.com", Port: 443, Protocol: "TCP"},
+			Endpoint:   "mcr.microsoft.com:443",
+			FromNode:   "Connected",
+			FromPod:    "Error: tcp: dial tcp 20.50.1.2:443: i/o timeout",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("marshal egress profile: %v", err)
+	}
+
+	got := getOutboundResults(map[string]string{
+		"Microsoft-Container-Registry": strings.Join([]string{
+			probeLine("Connected", ""),
+			probeLine("Error: tcp: dial tcp 20.50.1.2:443: i/o timeout", "tcp"),
+			probeLine("Connected", ""),
+		}, "\n"),
+		collector.NetworkOutboundEgressProfileKey: string(profile),
+	})
+
+	want := "outbound probe Microsoft-Container-Registry succeeded 2 of 3 times, failing at the tcp stage; required egress rule mcr.microsoft.com:443 from the node: Connected, from the pod network: Error: tcp: dial tcp 20.50.1.2:443: i/o timeout"
+	if got["mcr.microsoft.com"] != want {
+		t.Errorf("getOutboundResults()[mcr.microsoft.com] = %q, want %q", got["mcr.microsoft.com"], want)
+	}
+}
+
+func TestDiagnoseImagePull(t *testing.T) {
+	tests := []struct {
+		name         string
+		datum        imagePullDiagnosticDatum
+		outbound     string
+		wantCategory string
+		wantMessages []string
+	}{
+		{
+			name: "ACR without permission",
+			datum: imagePullDiagnosticDatum{
+				Image:    "myacr.azurecr.io/app:v1",
+				Registry: "myacr.azurecr.io",
+				Reason:   "ImagePullBackOff",
+				Error:    "failed to authorize: failed to fetch anonymous token: unexpected status: 401 Unauthorized",
+			},
+			wantCategory: "auth",
+			wantMessages: []string{"kubelet identity is not allowed to pull from myacr.azurecr.io", "--attach-acr"},
+		},
+		{
+			name: "ACR firewall",
+			datum: imagePullDiagnosticDatum{
+				Image:    "myacr.azurecr.io/app:v1",
+				Registry: "myacr.azurecr.io",
+				Reason:   "ErrImagePull",
+				Error:    "403 Forbidden: denied: client with IP '20.1.2.3' is not allowed access. Refer https://aka.ms/acr/firewall to grant access.",
+			},
+			wantCategory: "firewall",
+			wantMessages: []string{"the network rules of myacr.azurecr.io deny the IP the node pulls from (20.1.2.3)", "registry firewall"},
+		},
+		{
+			name: "rejected image pull secrets",
+			datum: imagePullDiagnosticDatum{
+				Image:            "registry.example.com/team/app:v1",
+				Registry:         "registry.example.com",
+				Reason:           "ErrImagePull",
+				Error:            "pull access denied, repository does not exist or may require authorization: server message: insufficient_scope: authorization failed",
+				ImagePullSecrets: []string{"default/regcred"},
+			},
+			wantCategory: "auth",
+			wantMessages: []string{"the image pull secrets default/regcred may be expired"},
+		},
+		{
+			name: "Docker Hub rate limit",
+			datum: imagePullDiagnosticDatum{
+				Image:    "nginx:1.21",
+				Registry: "registry-1.docker.io",
+				Reason:   "ErrImagePull",
+				Error:    "429 Too Many Requests - Server message: toomanyrequests: You have reached your pull rate limit.",
+			},
+			wantCategory: "ratelimit",
+			wantMessages: []string{"registry-1.docker.io rate limits the pulls"},
+		},
+		{
+			name: "private ACR not resolved without probe",
+			datum: imagePullDiagnosticDatum{
+				Image:    "myacr.azurecr.io/app:v1",
+				Registry: "myacr.azurecr.io",
+				Reason:   "ImagePullBackOff",
+				Error:    "dial tcp: lookup myacr.azurecr.io on 168.63.129.16:53: no such host",
+			},
+			wantCategory: "dns",
+			wantMessages: []string{"privatelink.azurecr.io", "add myacr.azurecr.io to DIAGNOSTIC_NETWORKOUTBOUND_TARGETS"},
+		},
+		{
+			name: "blocked registry with probe",
+			datum: imagePullDiagnosticDatum{
+				Image:    "myacr.azurecr.io/app:v1",
+				Registry: "myacr.azurecr.io",
+				Reason:   "ImagePullBackOff",
+				Error:    "dial tcp 20.50.1.2:443: i/o timeout",
+			},
+			outbound:     "outbound probe ACR succeeded 0 of 12 times, failing at the tcp stage",
+			wantCategory: "tcp",
+			wantMessages: []string{"myacr.data.azurecr.io", "; outbound probe ACR succeeded 0 of 12 times"},
+		},
+		{
+			name: "invalid reference",
+			datum: imagePullDiagnosticDatum{
+				Image:    "myacr.azurecr.io/App:v1",
+				Registry: "myacr.azurecr.io",
+				Reason:   "InvalidImageName",
+				Error:    `Failed to apply default image tag "myacr.azurecr.io/App:v1": couldn't parse image reference "myacr.azurecr.io/App:v1": invalid reference format: repository name must be lowercase`,
+			},
+			wantCategory: "name",
+			wantMessages: []string{"the image reference is invalid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.datum.Pods = []string{"default/web-0"}
+			diagnoseImagePull(&tt.datum, tt.outbound)
+
+			if tt.datum.Category != tt.wantCategory || tt.datum.Level != "Error" {
+				t.Errorf("diagnoseImagePull() = %s %s, want %s Error", tt.datum.Level, tt.datum.Category, tt.wantCategory)
+			}
+			for _, message := range tt.wantMessages {
+				if !strings.Contains(tt.datum.Message, message) {
+					t.Errorf("diagnoseImagePull().Message = %q, want it to contain %q", tt.datum.Message, message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// ipExhaustionWarningRate defines the share of used IPs of a node above which the node is reported
+	ipExhaustionWarningRate = 0.9
+	// subnetExhaustionWarningRate defines the share of the subnet the projected usage is reported above
+	subnetExhaustionWarningRate = 0.8
+	// azureSubnetReservedIPs defines the number of addresses Azure reserves in every subnet
+	azureSubnetReservedIPs = 5
+)
+
+type ipExhaustionDiagnosticDatum struct {
+	HostName string `json:"HostName"`
+	Source   string `json:"Source"`
+	Name     string `json:"Name"`
+	Used     int    `json:"Used,omitempty"`
+	Capacity int    `json:"Capacity,omitempty"`
+	Level    string `json:"Level"`
+	Message  string `json:"Message"`
+}
+
+// IPExhaustionDiagnoser defines an IPExhaustion Diagnoser struct
+type IPExhaustionDiagnoser struct {
+	networkConfigDiagnoser *NetworkConfigDiagnoser
+	cniCollector           *collector.CNICollector
+	data                   map[string]string
+}
+
+// NewIPExhaustionDiagnoser is a constructor
+func NewIPExhaustionDiagnoser(networkConfigDiagnoser *NetworkConfigDiagnoser, cniCollector *collector.CNICollector) *IPExhaustionDiagnoser {
+	return &IPExhaustionDiagnoser{
+		networkConfigDiagnoser: networkConfigDiagnoser,
+		cniCollector:           cniCollector,
+		data:                   make(map[string]string),
+	}
+}
+
+func (diagnoser *IPExhaustionDiagnoser) GetName() string {
+	return "ipexhaustion"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *IPExhaustionDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	networkConfig := networkConfigDiagnosticDatum{}
+	if data, ok := diagnoser.networkConfigDiagnoser.GetData()["networkconfig"]; ok {
+		if err := json.Unmarshal([]byte(data), &networkConfig); err != nil {
+			return fmt.Errorf("unmarshal network configuration: %w", err)
+		}
+	}
+
+	cniData := diagnoser.cniCollector.GetData()
+
+	pools := []collector.AzureCNIIPAMPool{}
+	if data, ok := cniData["ipam_pools"]; ok {
+		if err := json.Unmarshal([]byte(data), &pools); err != nil {
+			return fmt.Errorf("unmarshal Azure CNI IPAM pools: %w", err)
+		}
+	}
+
+	nodes := []collector.CNINode{}
+	if data, ok := cniData["cni_nodes"]; ok {
+		if err := json.Unmarshal([]byte(data), &nodes); err != nil {
+			return fmt.Errorf("unmarshal nodes: %w", err)
+		}
+	}
+
+	events := []collector.IPAllocationEvent{}
+	if data, ok := cniData["ip_allocation_events"]; ok {
+		if err := json.Unmarshal([]byte(data), &events); err != nil {
+			return fmt.Errorf("unmarshal IP allocation events: %w", err)
+		}
+	}
+
+	ipExhaustionDiagnosticData := []ipExhaustionDiagnosticDatum{}
+	newDatum := func(source string, name string, used int, capacity int, level string, message string) {
+		ipExhaustionDiagnosticData = append(ipExhaustionDiagnosticData, ipExhaustionDiagnosticDatum{
+			HostName: hostName,
+			Source:   source,
+			Name:     name,
+			Used:     used,
+			Capacity: capacity,
+			Level:    level,
+			Message:  message,
+		})
+	}
+
+	// Every pod of the DaemonSet collects all nodes and events, so each one reports its own node and events
+	localNodes := []collector.CNINode{}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Name, hostName) {
+			localNodes = append(localNodes, node)
+		}
+	}
+	diagnoseNodeIPUsage(networkConfig.NetworkPlugin, localNodes, newDatum)
+
+	// Pods of other network plugins get their IP from an overlay range of the node, which max pods already bounds
+	if networkConfig.NetworkPlugin == "azurecni" {
+		for _, pool := range pools {
+			diagnoseAzureCNIIPAMPool(&pool, networkConfig.MaxPodsPerNode, newDatum)
+			diagnoseSubnetUsage(hostName, &pool, nodes, networkConfig.MaxPodsPerNode, newDatum)
+		}
+	}
+
+	for _, event := range events {
+		// Events without a node are reported by the first node in name order
+		if !strings.EqualFold(event.Node, hostName) && (event.Node != "" || !isFirstCNINode(hostName, nodes)) {
+			continue
+		}
+		newDatum("event", event.Namespace+"/"+event.Pod, 0, 0, "Error", fmt.Sprintf("Pod sandbox failed to get an IP on node %s (%d times, last at %s): %s", event.Node, event.Count, event.LastTimestamp, event.Message))
+	}
+
+	dataBytes, err := json.Marshal(ipExhaustionDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from IPExhaustion Diagnoser: %w", err)
+	}
+
+	diagnoser.data["ipexhaustion"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *IPExhaustionDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseNodeIPUsage reports nodes whose pods use all, or nearly all, of their max pods. Azure CNI preallocates an IP
+// of the subnet for each of them, other network plugins bound the pod range of the node with max pods. Either way the
+// scheduler keeps new pods Pending once max pods is reached
+func diagnoseNodeIPUsage(networkPlugin string, nodes []collector.CNINode, newDatum func(string, string, int, int, string, string)) {
+	capacity := "pod IPs"
+	if networkPlugin != "azurecni" {
+		capacity = "max pods"
+	}
+
+	for _, node := range nodes {
+		if node.AllocatablePods == 0 {
+			continue
+		}
+
+		rate := float64(node.Pods) / float64(node.AllocatablePods)
+		switch {
+		case rate >= 1:
+			newDatum("node", node.Name, node.Pods, node.AllocatablePods, "Error", fmt.Sprintf("Node is at capacity, %d pods use all of its %d %s, new pods are not scheduled on it and stay Pending if no other node fits", node.Pods, node.AllocatablePods, capacity))
+		case rate >= ipExhaustionWarningRate:
+			newDatum("node", node.Name, node.Pods, node.AllocatablePods, "Warning", fmt.Sprintf("Node is near capacity, %d pods use %.0f%% of its %d %s", node.Pods, rate*100, node.AllocatablePods, capacity))
+		}
+	}
+}
+
+// diagnoseAzureCNIIPAMPool reports the IP usage of the IPAM pool of the node
+func diagnoseAzureCNIIPAMPool(pool *collector.AzureCNIIPAMPool, maxPodsPerNode int, newDatum func(string, string, int, int, string, string)) {
+	if pool.Addresses > 0 {
+		rate := float64(pool.InUse) / float64(pool.Addresses)
+		switch {
+		case rate >= 1:
+			newDatum("ipam", pool.Subnet, pool.InUse, pool.Addresses, "Error", fmt.Sprintf("All %d IPs of the node are assigned to pods, the sandbox of new pods fails to get an IP and they stay in ContainerCreating", pool.Addresses))
+		case rate >= ipExhaustionWarningRate:
+			newDatum("ipam", pool.Subnet, pool.InUse, pool.Addresses, "Warning", fmt.Sprintf("%d of the %d IPs of the node are assigned to pods", pool.InUse, pool.Addresses))
+		}
+	}
+
+	if maxPodsPerNode > 0 && pool.Addresses < maxPodsPerNode {
+		newDatum("ipam", pool.Subnet, pool.Addresses, maxPodsPerNode, "Warning", fmt.Sprintf("Only %d IPs are allocated to the node for %d max pods, pods beyond %d cannot get an IP", pool.Addresses, maxPodsPerNode, pool.Addresses))
+	}
+}
+
+// diagnoseSubnetUsage reports the subnet usage projected for the nodes of the subnet reserving max pods IPs each, plus
+// one for the node itself. The subnet is shared by its nodes, so only the first of them in name order reports it
+func diagnoseSubnetUsage(hostName string, pool *collector.AzureCNIIPAMPool, nodes []collector.CNINode, maxPodsPerNode int, newDatum func(string, string, int, int, string, string)) {
+	_, subnet, err := net.ParseCIDR(pool.Subnet)
+	if err != nil {
+		return
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits-ones >= 31 {
+		return
+	}
+	usable := (1 << uint(bits-ones)) - azureSubnetReservedIPs
+	if usable <= 0 {
+		return
+	}
+
+	projected := 0
+	subnetNodes := []collector.CNINode{}
+	for _, node := range nodes {
+		if ip := net.ParseIP(node.InternalIP); ip == nil || !subnet.Contains(ip) {
+			continue
+		}
+
+		maxPods := node.AllocatablePods
+		if maxPods == 0 {
+			maxPods = maxPodsPerNode
+		}
+		projected += maxPods + 1
+		subnetNodes = append(subnetNodes, node)
+	}
+
+	if !isFirstCNINode(hostName, subnetNodes) {
+		return
+	}
+
+	rate := float64(projected) / float64(usable)
+	switch {
+	case rate > 1:
+		newDatum("subnet", pool.Subnet, projected, usable, "Error", fmt.Sprintf("The %d nodes of the subnet reserve %d IPs for their max pods, more than the %d usable IPs of the subnet", len(subnetNodes), projected, usable))
+	case maxPodsPerNode > 0 && projected+maxPodsPerNode+1 > usable:
+		newDatum("subnet", pool.Subnet, projected, usable, "Warning", fmt.Sprintf("The %d nodes of the subnet reserve %d of its %d usable IPs, there is no room for another node with %d max pods when scaling out or upgrading", len(subnetNodes), projected, usable, maxPodsPerNode))
+	case rate >= subnetExhaustionWarningRate:
+		newDatum("subnet", pool.Subnet, projected, usable, "Warning", fmt.Sprintf("The %d nodes of the subnet reserve %.0f%% of its %d usable IPs for their max pods", len(subnetNodes), rate*100, usable))
+	}
+}
+
+// isFirstCNINode tells whether the host is the first of the nodes in name order
+func isFirstCNINode(hostName string, nodes []collector.CNINode) bool {
+	if len(nodes) == 0 {
+		return false
+	}
+
+	first := nodes[0].Name
+	for _, node := range nodes[1:] {
+		if node.Name < first {
+			first = node.Name
+		}
+	}
+
+	return strings.EqualFold(first, hostName)
+}
@@ -0,0 +1,166 @@
+package diagnoser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnoseNodeIPUsage(t *testing.T) {
+	nodes := []collector.CNINode{
+		{Name: "aks-nodepool1-0", AllocatablePods: 30, Pods: 30},
+		{Name: "aks-nodepool1-1", AllocatablePods: 30, Pods: 28},
+		{Name: "aks-nodepool1-2", AllocatablePods: 30, Pods: 10},
+		{Name: "aks-nodepool1-3", AllocatablePods: 0, Pods: 10},
+	}
+
+	tests := []struct {
+		name          string
+		networkPlugin string
+		want          []testFinding
+	}{
+		{
+			name:          "azure cni",
+			networkPlugin: "azurecni",
+			want: []testFinding{
+				{"node", "Error", "30 pods use all of its 30 pod IPs, new pods are not scheduled on it"},
+				{"node", "Warning", "28 pods use 93% of its 30 pod IPs"},
+			},
+		},
+		{
+			name:          "kubenet",
+			networkPlugin: "kubenet",
+			want: []testFinding{
+				{"node", "Error", "30 pods use all of its 30 max pods, new pods are not scheduled on it"},
+				{"node", "Warning", "28 pods use 93% of its 30 max pods"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseNodeIPUsage(tt.networkPlugin, nodes, func(source string, name string, used int, capacity int, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+			for _, datum := range got {
+				if strings.Contains(datum.message, "ContainerCreating") {
+					t.Errorf("diagnoseNodeIPUsage() = %q, pods at max pods are Pending", datum.message)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnoseAzureCNIIPAMPool(t *testing.T) {
+	tests := []struct {
+		name           string
+		pool           collector.AzureCNIIPAMPool
+		maxPodsPerNode int
+		want           []testFinding
+	}{
+		{
+			name:           "healthy pool",
+			pool:           collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/16", Addresses: 30, InUse: 10},
+			maxPodsPerNode: 30,
+			want:           []testFinding{},
+		},
+		{
+			name:           "all IPs assigned",
+			pool:           collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/16", Addresses: 30, InUse: 30},
+			maxPodsPerNode: 30,
+			want: []testFinding{
+				{"ipam", "Error", "they stay in ContainerCreating"},
+			},
+		},
+		{
+			name:           "fewer IPs than max pods",
+			pool:           collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/16", Addresses: 20, InUse: 19},
+			maxPodsPerNode: 30,
+			want: []testFinding{
+				{"ipam", "Warning", "19 of the 20 IPs"},
+				{"ipam", "Warning", "pods beyond 20 cannot get an IP"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseAzureCNIIPAMPool(&tt.pool, tt.maxPodsPerNode, func(source string, name string, used int, capacity int, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
+
+func TestDiagnoseSubnetUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostName string
+		pool     collector.AzureCNIIPAMPool
+		nodes    []collector.CNINode
+		want     []testFinding
+	}{
+		{
+			name:     "subnet with room to scale out",
+			hostName: "aks-nodepool1-0",
+			pool:     collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/16", Addresses: 30, InUse: 1},
+			nodes: []collector.CNINode{
+				{Name: "aks-nodepool1-0", InternalIP: "10.240.0.4", AllocatablePods: 30},
+			},
+			want: []testFinding{},
+		},
+		{
+			// A /26 has 59 usable IPs, two nodes reserve 31 each
+			name:     "subnet overcommitted",
+			hostName: "aks-nodepool1-0",
+			pool:     collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/26", Addresses: 30, InUse: 1},
+			nodes: []collector.CNINode{
+				{Name: "aks-nodepool1-1", InternalIP: "10.240.0.35", AllocatablePods: 30},
+				{Name: "aks-nodepool1-0", InternalIP: "10.240.0.4", AllocatablePods: 30},
+				{Name: "aks-nodepool0-0", InternalIP: "10.241.0.4", AllocatablePods: 30},
+			},
+			want: []testFinding{
+				{"subnet", "Error", "The 2 nodes of the subnet reserve 62 IPs"},
+			},
+		},
+		{
+			name:     "subnet reported by another node",
+			hostName: "aks-nodepool1-1",
+			pool:     collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/26", Addresses: 30, InUse: 1},
+			nodes: []collector.CNINode{
+				{Name: "aks-nodepool1-1", InternalIP: "10.240.0.35", AllocatablePods: 30},
+				{Name: "aks-nodepool1-0", InternalIP: "10.240.0.4", AllocatablePods: 30},
+			},
+			want: []testFinding{},
+		},
+		{
+			// A /25 has 123 usable IPs, three nodes reserve 93 and a fourth needs 31 more
+			name:     "no room to scale out",
+			hostName: "aks-nodepool1-0",
+			pool:     collector.AzureCNIIPAMPool{Subnet: "10.240.0.0/25", Addresses: 30, InUse: 1},
+			nodes: []collector.CNINode{
+				{Name: "aks-nodepool1-0", InternalIP: "10.240.0.4", AllocatablePods: 30},
+				{Name: "aks-nodepool1-1", InternalIP: "10.240.0.35", AllocatablePods: 30},
+				{Name: "aks-nodepool1-2", InternalIP: "10.240.0.66", AllocatablePods: 30},
+			},
+			want: []testFinding{
+				{"subnet", "Warning", "no room for another node"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseSubnetUsage(tt.hostName, &tt.pool, tt.nodes, 30, func(source string, name string, used int, capacity int, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
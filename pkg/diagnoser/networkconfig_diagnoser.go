@@ -3,6 +3,7 @@ package diagnoser
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
 
@@ -11,26 +12,37 @@ import (
 )
 
 type networkConfigDiagnosticDatum struct {
-	HostName          string   `json:"HostName"`
-	NetworkPlugin     string   `json:"NetworkPlugin"`
-	VirtualMachineDNS []string `json:"VirtualMachineDNS"`
-	KubernetesDNS     []string `json:"KubernetesDNS"`
-	MaxPodsPerNode    int      `json:"MaxPodsPerNode"`
+	HostName                  string            `json:"HostName"`
+	NetworkPlugin             string            `json:"NetworkPlugin"`
+	NetworkPluginEvidence     []string          `json:"NetworkPluginEvidence"`
+	NetworkPolicy             string            `json:"NetworkPolicy,omitempty"`
+	NetworkPolicyEvidence     []string          `json:"NetworkPolicyEvidence,omitempty"`
+	VirtualMachineDNS         []string          `json:"VirtualMachineDNS"`
+	VirtualMachineUpstreamDNS []string          `json:"VirtualMachineUpstreamDNS,omitempty"`
+	KubernetesDNS             []string          `json:"KubernetesDNS"`
+	VirtualMachineResolvConf  *utils.ResolvConf `json:"VirtualMachineResolvConf,omitempty"`
+	KubernetesResolvConf      *utils.ResolvConf `json:"KubernetesResolvConf,omitempty"`
+	MaxPodsPerNode            int               `json:"MaxPodsPerNode"`
+	MaxPodsPerNodeEvidence    []string          `json:"MaxPodsPerNodeEvidence"`
 }
 
 // NetworkConfigDiagnoser defines a NetworkConfig Diagnoser struct
 type NetworkConfigDiagnoser struct {
-	dnsCollector        *collector.DNSCollector
-	kubeletCmdCollector *collector.KubeletCmdCollector
-	data                map[string]string
+	dnsCollector           *collector.DNSCollector
+	kubeletCmdCollector    *collector.KubeletCmdCollector
+	kubeletConfigCollector *collector.KubeletConfigCollector
+	cniCollector           *collector.CNICollector
+	data                   map[string]string
 }
 
 // NewNetworkConfigDiagnoser is a constructor
-func NewNetworkConfigDiagnoser(dnsCollector *collector.DNSCollector, kubeletCmdCollector *collector.KubeletCmdCollector) *NetworkConfigDiagnoser {
+func NewNetworkConfigDiagnoser(dnsCollector *collector.DNSCollector, kubeletCmdCollector *collector.KubeletCmdCollector, kubeletConfigCollector *collector.KubeletConfigCollector, cniCollector *collector.CNICollector) *NetworkConfigDiagnoser {
 	return &NetworkConfigDiagnoser{
-		dnsCollector:        dnsCollector,
-		kubeletCmdCollector: kubeletCmdCollector,
-		data:                make(map[string]string),
+		dnsCollector:           dnsCollector,
+		kubeletCmdCollector:    kubeletCmdCollector,
+		kubeletConfigCollector: kubeletConfigCollector,
+		cniCollector:           cniCollector,
+		data:                   make(map[string]string),
 	}
 }
 
@@ -46,44 +58,53 @@ func (diagnoser *NetworkConfigDiagnoser) Diagnose() error {
 	}
 
 	networkConfigDiagnosticData := networkConfigDiagnosticDatum{HostName: hostName}
-	for key, data := range diagnoser.dnsCollector.GetData() {
-		var dns []string
-		words := strings.Split(data, " ")
-		for i := range words {
-			if words[i] == "nameserver" {
-				dns = append(dns, strings.TrimSuffix(words[i+1], "\n"))
-			}
+	dnsData := diagnoser.dnsCollector.GetData()
+	if data, ok := dnsData["virtualmachine"]; ok {
+		resolvConf := utils.ParseResolvConf(data)
+		if upstream, ok := dnsData["systemd-resolved"]; ok && resolvConf.UsesSystemdResolvedStub() {
+			resolvConf.SystemdResolvedUpstream = utils.ParseResolvConf(upstream)
+			networkConfigDiagnosticData.VirtualMachineUpstreamDNS = resolvConf.SystemdResolvedUpstream.Nameservers
 		}
 
-		if key == "virtualmachine" {
-			networkConfigDiagnosticData.VirtualMachineDNS = dns
-		}
+		networkConfigDiagnosticData.VirtualMachineDNS = resolvConf.Nameservers
+		networkConfigDiagnosticData.VirtualMachineResolvConf = resolvConf
+	}
+
+	if data, ok := dnsData["kubernetes"]; ok {
+		resolvConf := utils.ParseResolvConf(data)
+		networkConfigDiagnosticData.KubernetesDNS = resolvConf.Nameservers
+		networkConfigDiagnosticData.KubernetesResolvConf = resolvConf
+	}
+
+	flags := utils.ParseKubeletFlags(diagnoser.kubeletCmdCollector.GetData()["kubeletcmd"])
 
-		if key == "kubernetes" {
-			networkConfigDiagnosticData.KubernetesDNS = dns
+	effective := map[string]collector.KubeletSetting{}
+	if data, ok := diagnoser.kubeletConfigCollector.GetData()["effective"]; ok {
+		if err := json.Unmarshal([]byte(data), &effective); err != nil {
+			return fmt.Errorf("unmarshal effective kubelet config: %w", err)
 		}
 	}
 
-	for _, data := range diagnoser.kubeletCmdCollector.GetData() {
-		parts := strings.Split(data, " ")
-		for _, part := range parts {
-			if strings.HasPrefix(part, "--network-plugin=") {
-				networkPlugin := part[17:]
-				if networkPlugin == "cni" {
-					networkPlugin = "azurecni"
-				}
+	cniData := diagnoser.cniCollector.GetData()
 
-				networkConfigDiagnosticData.NetworkPlugin = networkPlugin
-			}
+	cniConfigs := []collector.CNIConfig{}
+	if data, ok := cniData["config"]; ok {
+		if err := json.Unmarshal([]byte(data), &cniConfigs); err != nil {
+			log.Printf("Unmarshal CNI config failed: %v", err)
+		}
+	}
 
-			if strings.HasPrefix(part, "--max-pods=") {
-				maxPodsPerNodeString := part[11:]
-				maxPodsPerNode, _ := strconv.Atoi(maxPodsPerNodeString)
-				networkConfigDiagnosticData.MaxPodsPerNode = maxPodsPerNode
-			}
+	daemonSets := []collector.NetworkDaemonSet{}
+	if data, ok := cniData["daemonsets"]; ok {
+		if err := json.Unmarshal([]byte(data), &daemonSets); err != nil {
+			return fmt.Errorf("unmarshal network daemonsets: %w", err)
 		}
 	}
 
+	networkConfigDiagnosticData.NetworkPlugin, networkConfigDiagnosticData.NetworkPluginEvidence = detectNetworkPlugin(flags, cniConfigs, daemonSets)
+	networkConfigDiagnosticData.NetworkPolicy, networkConfigDiagnosticData.NetworkPolicyEvidence = detectNetworkPolicy(networkConfigDiagnosticData.NetworkPlugin, daemonSets)
+	networkConfigDiagnosticData.MaxPodsPerNode, networkConfigDiagnosticData.MaxPodsPerNodeEvidence = detectMaxPodsPerNode(cniData["allocatable_pods"], effective, flags)
+
 	dataBytes, err := json.Marshal(networkConfigDiagnosticData)
 	if err != nil {
 		return fmt.Errorf("marshal data from NetworkConfig Diagnoser: %w", err)
@@ -101,3 +122,142 @@ func (diagnoser *NetworkConfigDiagnoser) Diagnose() error {
 func (collector *NetworkConfigDiagnoser) GetData() map[string]string {
 	return collector.data
 }
+
+// cniPluginTypes maps the main plugin types of CNI configurations to the network plugin they belong to
+var cniPluginTypes = map[string]string{
+	"azure-vnet": "azurecni",
+	"cilium-cni": "cilium",
+	"bridge":     "kubenet",
+}
+
+// cniIPAMTypes maps the IPAM plugin types of CNI configurations to the network plugin allocating pod IPs. Calico
+// replaces the kubenet bridge when used as network policy engine of kubenet clusters, but keeps allocating pod IPs
+// from the pod CIDR of the node with host-local
+var cniIPAMTypes = map[string]string{
+	"azure-vnet-ipam": "azurecni",
+	"azure-cns":       "azurecni",
+	"host-local":      "kubenet",
+}
+
+// detectNetworkPlugin concludes the network plugin from the CNI configuration the container runtime loads, the legacy
+// kubelet --network-plugin flag and the DaemonSets of the network plugins, in that order of precedence
+func detectNetworkPlugin(flags map[string]string, cniConfigs []collector.CNIConfig, daemonSets []collector.NetworkDaemonSet) (string, []string) {
+	networkPlugin := ""
+	evidence := []string{}
+
+	for _, config := range cniConfigs {
+		if config.Error != "" {
+			evidence = append(evidence, fmt.Sprintf("CNI config %s is invalid: %s", config.Path, config.Error))
+			continue
+		}
+
+		plugin := ""
+		for _, pluginType := range config.PluginTypes {
+			if plugin = cniPluginTypes[pluginType]; plugin != "" {
+				evidence = append(evidence, fmt.Sprintf("CNI config %s uses plugin %s", config.Path, pluginType))
+				break
+			}
+		}
+		if plugin == "" {
+			for _, ipamType := range config.IPAMTypes {
+				if plugin = cniIPAMTypes[ipamType]; plugin != "" {
+					evidence = append(evidence, fmt.Sprintf("CNI config %s uses plugins %s with IPAM %s", config.Path, strings.Join(config.PluginTypes, ", "), ipamType))
+					break
+				}
+			}
+		}
+
+		// The container runtime only loads the first configuration in lexical order
+		if networkPlugin == "" {
+			networkPlugin = plugin
+		}
+	}
+
+	if value, ok := flags["network-plugin"]; ok {
+		evidence = append(evidence, "kubelet flag --network-plugin="+value)
+		if networkPlugin == "" && value == "kubenet" {
+			networkPlugin = "kubenet"
+		}
+	}
+
+	for _, daemonSet := range daemonSets {
+		plugin := ""
+		switch daemonSet.Name {
+		case "azure-cni-networkmonitor":
+			plugin = "azurecni"
+		case "cilium":
+			plugin = "cilium"
+		default:
+			continue
+		}
+
+		evidence = append(evidence, fmt.Sprintf("DaemonSet %s/%s is deployed", daemonSet.Namespace, daemonSet.Name))
+		if networkPlugin == "" {
+			networkPlugin = plugin
+		}
+	}
+
+	// Older kubelets only tell that a CNI plugin is used, which on AKS is Azure CNI unless configured otherwise
+	if networkPlugin == "" && flags["network-plugin"] == "cni" {
+		networkPlugin = "azurecni"
+	}
+
+	return networkPlugin, evidence
+}
+
+// detectNetworkPolicy concludes the network policy engine from its DaemonSets
+func detectNetworkPolicy(networkPlugin string, daemonSets []collector.NetworkDaemonSet) (string, []string) {
+	networkPolicy := ""
+	evidence := []string{}
+
+	for _, daemonSet := range daemonSets {
+		policy := ""
+		switch daemonSet.Name {
+		case "azure-npm":
+			policy = "azure"
+		case "calico-node":
+			policy = "calico"
+		case "cilium":
+			policy = "cilium"
+		default:
+			continue
+		}
+
+		evidence = append(evidence, fmt.Sprintf("DaemonSet %s/%s is deployed (%d/%d ready)", daemonSet.Namespace, daemonSet.Name, daemonSet.Ready, daemonSet.Desired))
+		if networkPolicy == "" || policy == networkPlugin {
+			networkPolicy = policy
+		}
+	}
+
+	return networkPolicy, evidence
+}
+
+// detectMaxPodsPerNode concludes the maximum number of pods from the node allocatable pods, which the scheduler uses,
+// falling back to the effective kubelet configuration and the legacy --max-pods flag
+func detectMaxPodsPerNode(allocatablePods string, effective map[string]collector.KubeletSetting, flags map[string]string) (int, []string) {
+	maxPods := 0
+	evidence := []string{}
+
+	if value, err := strconv.Atoi(allocatablePods); err == nil {
+		evidence = append(evidence, fmt.Sprintf("node status.allocatable.pods is %d", value))
+		maxPods = value
+	}
+
+	if setting, ok := effective["maxPods"]; ok {
+		if value, ok := setting.Value.(float64); ok {
+			evidence = append(evidence, fmt.Sprintf("kubelet maxPods is %d (from %s)", int(value), setting.Source))
+			if maxPods == 0 {
+				maxPods = int(value)
+			}
+		}
+	}
+
+	if value, ok := flags["max-pods"]; ok {
+		evidence = append(evidence, "kubelet flag --max-pods="+value)
+		if i, err := strconv.Atoi(value); err == nil && maxPods == 0 {
+			maxPods = i
+		}
+	}
+
+	return maxPods, evidence
+}
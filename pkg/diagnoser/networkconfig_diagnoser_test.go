@@ -0,0 +1,167 @@
+package diagnoser
+
+import (
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDetectNetworkPlugin(t *testing.T) {
+	azureConfig := collector.CNIConfig{Path: "/etc/cni/net.d/10-azure.conflist", PluginTypes: []string{"azure-vnet", "portmap"}, IPAMTypes: []string{"azure-vnet-ipam"}}
+	bridgeConfig := collector.CNIConfig{Path: "/etc/cni/net.d/10-kubenet.conflist", PluginTypes: []string{"bridge", "portmap"}, IPAMTypes: []string{"host-local"}}
+	calicoKubenetConfig := collector.CNIConfig{Path: "/etc/cni/net.d/10-calico.conflist", PluginTypes: []string{"calico", "portmap"}, IPAMTypes: []string{"host-local"}}
+	calicoAzureConfig := collector.CNIConfig{Path: "/etc/cni/net.d/10-calico.conflist", PluginTypes: []string{"calico", "portmap"}, IPAMTypes: []string{"azure-vnet-ipam"}}
+	ciliumConfig := collector.CNIConfig{Path: "/etc/cni/net.d/05-cilium.conflist", PluginTypes: []string{"cilium-cni"}}
+
+	tests := []struct {
+		name       string
+		flags      map[string]string
+		cniConfigs []collector.CNIConfig
+		daemonSets []collector.NetworkDaemonSet
+		want       string
+	}{
+		{
+			name:       "azure cni config",
+			cniConfigs: []collector.CNIConfig{azureConfig},
+			want:       "azurecni",
+		},
+		{
+			name:       "kubenet bridge config",
+			cniConfigs: []collector.CNIConfig{bridgeConfig},
+			want:       "kubenet",
+		},
+		{
+			name:       "calico with host-local IPAM",
+			cniConfigs: []collector.CNIConfig{calicoKubenetConfig},
+			daemonSets: []collector.NetworkDaemonSet{{Namespace: "calico-system", Name: "calico-node"}},
+			want:       "kubenet",
+		},
+		{
+			name:       "calico with azure IPAM",
+			cniConfigs: []collector.CNIConfig{calicoAzureConfig},
+			daemonSets: []collector.NetworkDaemonSet{{Namespace: "calico-system", Name: "calico-node"}},
+			want:       "azurecni",
+		},
+		{
+			name:       "first config in lexical order wins",
+			cniConfigs: []collector.CNIConfig{ciliumConfig, azureConfig},
+			want:       "cilium",
+		},
+		{
+			name:       "invalid config is skipped",
+			cniConfigs: []collector.CNIConfig{{Path: "/etc/cni/net.d/05-broken.conflist", Error: "unexpected end of JSON input"}, bridgeConfig},
+			want:       "kubenet",
+		},
+		{
+			name:  "kubenet flag",
+			flags: map[string]string{"network-plugin": "kubenet"},
+			want:  "kubenet",
+		},
+		{
+			name:       "daemonset",
+			daemonSets: []collector.NetworkDaemonSet{{Namespace: "kube-system", Name: "kube-proxy"}, {Namespace: "kube-system", Name: "azure-cni-networkmonitor"}},
+			want:       "azurecni",
+		},
+		{
+			name:  "legacy cni flag",
+			flags: map[string]string{"network-plugin": "cni"},
+			want:  "azurecni",
+		},
+		{
+			name: "unknown",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, evidence := detectNetworkPlugin(tt.flags, tt.cniConfigs, tt.daemonSets)
+			if got != tt.want {
+				t.Errorf("detectNetworkPlugin() = %v, want %v (evidence %v)", got, tt.want, evidence)
+			}
+		})
+	}
+}
+
+func TestDetectNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		networkPlugin string
+		daemonSets    []collector.NetworkDaemonSet
+		want          string
+	}{
+		{
+			name:          "no policy engine",
+			networkPlugin: "azurecni",
+			daemonSets:    []collector.NetworkDaemonSet{{Namespace: "kube-system", Name: "kube-proxy"}},
+			want:          "",
+		},
+		{
+			name:          "azure network policy manager",
+			networkPlugin: "azurecni",
+			daemonSets:    []collector.NetworkDaemonSet{{Namespace: "kube-system", Name: "azure-npm"}},
+			want:          "azure",
+		},
+		{
+			name:          "calico with azure cni",
+			networkPlugin: "azurecni",
+			daemonSets:    []collector.NetworkDaemonSet{{Namespace: "calico-system", Name: "calico-node"}},
+			want:          "calico",
+		},
+		{
+			name:          "cilium enforces its own policies",
+			networkPlugin: "cilium",
+			daemonSets:    []collector.NetworkDaemonSet{{Namespace: "kube-system", Name: "azure-npm"}, {Namespace: "kube-system", Name: "cilium"}},
+			want:          "cilium",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, evidence := detectNetworkPolicy(tt.networkPlugin, tt.daemonSets); got != tt.want {
+				t.Errorf("detectNetworkPolicy() = %v, want %v (evidence %v)", got, tt.want, evidence)
+			}
+		})
+	}
+}
+
+func TestDetectMaxPodsPerNode(t *testing.T) {
+	tests := []struct {
+		name            string
+		allocatablePods string
+		effective       map[string]collector.KubeletSetting
+		flags           map[string]string
+		want            int
+	}{
+		{
+			name:            "node allocatable pods win",
+			allocatablePods: "30",
+			effective:       map[string]collector.KubeletSetting{"maxPods": {Value: float64(110), Source: "configz"}},
+			flags:           map[string]string{"max-pods": "250"},
+			want:            30,
+		},
+		{
+			name:            "kubelet configuration",
+			allocatablePods: "Failed to list nodes: forbidden",
+			effective:       map[string]collector.KubeletSetting{"maxPods": {Value: float64(110), Source: "configz"}},
+			want:            110,
+		},
+		{
+			name:  "kubelet flag",
+			flags: map[string]string{"max-pods": "250"},
+			want:  250,
+		},
+		{
+			name: "unknown",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, evidence := detectMaxPodsPerNode(tt.allocatablePods, tt.effective, tt.flags); got != tt.want {
+				t.Errorf("detectMaxPodsPerNode() = %v, want %v (evidence %v)", got, tt.want, evidence)
+			}
+		})
+	}
+}
@@ -12,11 +12,13 @@ import (
 )
 
 type networkOutboundDiagnosticDatum struct {
-	HostName string    `json:"HostName"`
-	Type     string    `json:"Type"`
-	Start    time.Time `json:"Start"`
-	End      time.Time `json:"End"`
-	Status   string    `json:"Status"`
+	HostName    string    `json:"HostName"`
+	Type        string    `json:"Type"`
+	Start       time.Time `json:"Start"`
+	End         time.Time `json:"End"`
+	Status      string    `json:"Status"`
+	FailedStage string    `json:"FailedStage,omitempty"`
+	Reason      string    `json:"Reason,omitempty"`
 }
 
 // NetworkOutboundDiagnoser defines a NetworkOutbound Diagnoser struct
@@ -44,9 +46,40 @@ func (diagnoser *NetworkOutboundDiagnoser) Diagnose() error {
 		return err
 	}
 
+	// Probe timestamps are truncated to the second, so consecutive probes may be up to a second further apart
+	maxGap := diagnoser.networkOutboundCollector.GetInterval() + time.Second
+
+	outboundDiagnosticData := getNetworkOutboundPeriods(hostName, diagnoser.networkOutboundCollector.GetData(), maxGap)
+
+	dataBytes, err := json.Marshal(outboundDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from NetworkOutbound Diagnoser: %w", err)
+	}
+
+	diagnoser.data["networkoutbound"] = string(dataBytes)
+
+	err = utils.WriteToCRD(string(dataBytes), diagnoser.GetName())
+	if err != nil {
+		return fmt.Errorf("write data from NetworkOutbound Diagnoser to CRD: %w", err)
+	}
+
+	return nil
+}
+
+func (collector *NetworkOutboundDiagnoser) GetData() map[string]string {
+	return collector.data
+}
+
+// getNetworkOutboundPeriods groups the consecutive probes of each target with the same status into periods, a period
+// ends when two probes are more than maxGap apart
+func getNetworkOutboundPeriods(hostName string, outboundData map[string]string, maxGap time.Duration) []networkOutboundDiagnosticDatum {
 	outboundDiagnosticData := []networkOutboundDiagnosticDatum{}
 
-	for _, data := range diagnoser.networkOutboundCollector.GetData() {
+	for key, data := range outboundData {
+		if key == collector.NetworkOutboundEgressProfileKey {
+			continue
+		}
+
 		dataPoint := networkOutboundDiagnosticDatum{HostName: hostName}
 		lines := strings.Split(data, "\n")
 		for _, line := range lines {
@@ -64,7 +97,7 @@ func (diagnoser *NetworkOutboundDiagnoser) Diagnose() error {
 					outboundDiagnosticData = append(outboundDiagnosticData, dataPoint)
 					setDataPoint(&outboundDatum, &dataPoint)
 				} else {
-					if int(outboundDatum.TimeStamp.Sub(dataPoint.End).Seconds()) > 5 {
+					if outboundDatum.TimeStamp.Sub(dataPoint.End) > maxGap {
 						outboundDiagnosticData = append(outboundDiagnosticData, dataPoint)
 						setDataPoint(&outboundDatum, &dataPoint)
 					} else {
@@ -79,23 +112,7 @@ func (diagnoser *NetworkOutboundDiagnoser) Diagnose() error {
 		}
 	}
 
-	dataBytes, err := json.Marshal(outboundDiagnosticData)
-	if err != nil {
-		return fmt.Errorf("marshal data from NetworkOutbound Diagnoser: %w", err)
-	}
-
-	diagnoser.data["networkoutbound"] = string(dataBytes)
-
-	err = utils.WriteToCRD(string(dataBytes), diagnoser.GetName())
-	if err != nil {
-		return fmt.Errorf("write data from NetworkOutbound Diagnoser to CRD: %w", err)
-	}
-
-	return nil
-}
-
-func (collector *NetworkOutboundDiagnoser) GetData() map[string]string {
-	return collector.data
+	return outboundDiagnosticData
 }
 
 func setDataPoint(outboundDatum *collector.NetworkOutboundDatum, dataPoint *networkOutboundDiagnosticDatum) {
@@ -103,4 +120,41 @@ func setDataPoint(outboundDatum *collector.NetworkOutboundDatum, dataPoint *netw
 	dataPoint.Start = outboundDatum.TimeStamp
 	dataPoint.End = outboundDatum.TimeStamp
 	dataPoint.Status = outboundDatum.Status
+	dataPoint.FailedStage = outboundDatum.FailedStage
+	dataPoint.Reason = getNetworkOutboundFailureReason(outboundDatum)
+}
+
+// getNetworkOutboundFailureReason explains which layer of the connection to a target failed
+func getNetworkOutboundFailureReason(outboundDatum *collector.NetworkOutboundDatum) string {
+	var failedStage *collector.NetworkOutboundStage
+	for i := range outboundDatum.Stages {
+		if outboundDatum.Stages[i].Status == "Failed" {
+			failedStage = &outboundDatum.Stages[i]
+		}
+	}
+
+	switch outboundDatum.FailedStage {
+	case "":
+		return ""
+	case "dns":
+		return "DNS resolution failed"
+	case "tcp":
+		return "TCP connection failed, traffic may be dropped by a firewall, network security group or route"
+	case "proxy":
+		return "HTTP proxy configuration is invalid"
+	case "connect":
+		return "HTTP proxy refused to open a tunnel to the target"
+	case "tls":
+		if failedStage != nil && strings.Contains(failedStage.Error, "unknown authority") && len(failedStage.PeerCertificates) > 0 {
+			return fmt.Sprintf("TLS certificate issued by untrusted %q, traffic may be intercepted by a proxy", failedStage.PeerCertificates[0].Issuer)
+		}
+		if failedStage != nil && strings.Contains(failedStage.Error, "certificate is valid for") {
+			return "TLS certificate does not match the requested server name"
+		}
+		return "TLS handshake failed"
+	case "http":
+		return "HTTP request returned an unexpected response"
+	default:
+		return "Probe failed at stage " + outboundDatum.FailedStage
+	}
 }
@@ -0,0 +1,263 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// overcommitRequestsWarningRate defines the share of allocatable resources requested above which new pods may not
+	// be scheduled on the node
+	overcommitRequestsWarningRate = 0.9
+	// overcommitUsageWarningRate defines the share of allocatable resources used above which the node is reported
+	overcommitUsageWarningRate = 0.8
+)
+
+type overcommitDiagnosticDatum struct {
+	HostName        string  `json:"HostName"`
+	Resource        string  `json:"Resource"`
+	Pod             string  `json:"Pod,omitempty"`
+	Allocatable     int64   `json:"Allocatable,omitempty"`
+	Requests        int64   `json:"Requests,omitempty"`
+	Limits          int64   `json:"Limits,omitempty"`
+	Usage           int64   `json:"Usage,omitempty"`
+	RequestsPercent float64 `json:"RequestsPercent,omitempty"`
+	LimitsPercent   float64 `json:"LimitsPercent,omitempty"`
+	UsagePercent    float64 `json:"UsagePercent,omitempty"`
+	Level           string  `json:"Level"`
+	Message         string  `json:"Message"`
+}
+
+// OvercommitDiagnoser defines an Overcommit Diagnoser struct
+type OvercommitDiagnoser struct {
+	nodeCollector       *collector.NodeCollector
+	systemPerfCollector *collector.SystemPerfCollector
+	data                map[string]string
+}
+
+// NewOvercommitDiagnoser is a constructor
+func NewOvercommitDiagnoser(nodeCollector *collector.NodeCollector, systemPerfCollector *collector.SystemPerfCollector) *OvercommitDiagnoser {
+	return &OvercommitDiagnoser{
+		nodeCollector:       nodeCollector,
+		systemPerfCollector: systemPerfCollector,
+		data:                make(map[string]string),
+	}
+}
+
+func (diagnoser *OvercommitDiagnoser) GetName() string {
+	return "overcommit"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *OvercommitDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	nodeData := diagnoser.nodeCollector.GetData()
+
+	node := v1.Node{}
+	if data, ok := nodeData["node"]; ok {
+		if err := json.Unmarshal([]byte(data), &node); err != nil {
+			return fmt.Errorf("unmarshal node: %w", err)
+		}
+	}
+
+	pods := []collector.NodePodResources{}
+	if data, ok := nodeData["node_pods"]; ok {
+		if err := json.Unmarshal([]byte(data), &pods); err != nil {
+			return fmt.Errorf("unmarshal pod resources: %w", err)
+		}
+	}
+
+	// Usage is optional, metrics-server may not be available
+	systemPerfData := diagnoser.systemPerfCollector.GetData()
+	var usage *collector.NodeMetrics
+	if data, ok := systemPerfData["nodes"]; ok {
+		nodeMetrics := []collector.NodeMetrics{}
+		if err := json.Unmarshal([]byte(data), &nodeMetrics); err != nil {
+			log.Printf("Unmarshal node metrics failed: %v", err)
+		}
+		for i := range nodeMetrics {
+			if nodeMetrics[i].NodeName == hostName {
+				usage = &nodeMetrics[i]
+			}
+		}
+	}
+
+	podMetrics := []collector.PodMetrics{}
+	if data, ok := systemPerfData["pods"]; ok {
+		if err := json.Unmarshal([]byte(data), &podMetrics); err != nil {
+			log.Printf("Unmarshal pod metrics failed: %v", err)
+		}
+	}
+
+	overcommitDiagnosticData := []overcommitDiagnosticDatum{}
+
+	var cpuRequests, cpuLimits, memoryRequests, memoryLimits int64
+	for _, pod := range pods {
+		cpuRequests += pod.CPURequests
+		cpuLimits += pod.CPULimits
+		memoryRequests += pod.MemoryRequests
+		memoryLimits += pod.MemoryLimits
+	}
+
+	cpu := overcommitDiagnosticDatum{
+		HostName:    hostName,
+		Resource:    "cpu",
+		Allocatable: node.Status.Allocatable.Cpu().MilliValue(),
+		Requests:    cpuRequests,
+		Limits:      cpuLimits,
+	}
+	memory := overcommitDiagnosticDatum{
+		HostName:    hostName,
+		Resource:    "memory",
+		Allocatable: node.Status.Allocatable.Memory().Value(),
+		Requests:    memoryRequests,
+		Limits:      memoryLimits,
+	}
+	if usage != nil {
+		cpu.Usage = usage.CPUUsage
+		memory.Usage = usage.MemoryUsage
+	}
+
+	for _, datum := range []*overcommitDiagnosticDatum{&cpu, &memory} {
+		if datum.Allocatable == 0 {
+			continue
+		}
+		diagnoseOvercommit(datum, usage != nil)
+		overcommitDiagnosticData = append(overcommitDiagnosticData, *datum)
+		if usage != nil {
+			overcommitDiagnosticData = append(overcommitDiagnosticData, diagnosePodsOverRequests(datum, pods, podMetrics)...)
+		}
+	}
+
+	for _, condition := range node.Status.Conditions {
+		unhealthy := condition.Status == v1.ConditionTrue
+		if condition.Type == v1.NodeReady {
+			unhealthy = condition.Status != v1.ConditionTrue
+		}
+		if !unhealthy {
+			continue
+		}
+
+		overcommitDiagnosticData = append(overcommitDiagnosticData, overcommitDiagnosticDatum{
+			HostName: hostName,
+			Resource: "condition/" + string(condition.Type),
+			Level:    "Error",
+			Message:  fmt.Sprintf("Node condition %s is %s since %s: %s", condition.Type, condition.Status, condition.LastTransitionTime.UTC().Format("2006-01-02T15:04:05Z"), condition.Message),
+		})
+	}
+
+	dataBytes, err := json.Marshal(overcommitDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Overcommit Diagnoser: %w", err)
+	}
+
+	diagnoser.data["overcommit"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *OvercommitDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseOvercommit compares the requests, limits and usage of a resource with the allocatable amount of the node
+func diagnoseOvercommit(datum *overcommitDiagnosticDatum, hasUsage bool) {
+	allocatable := float64(datum.Allocatable)
+	datum.RequestsPercent = float64(datum.Requests) / allocatable * 100
+	datum.LimitsPercent = float64(datum.Limits) / allocatable * 100
+	if hasUsage {
+		datum.UsagePercent = float64(datum.Usage) / allocatable * 100
+	}
+
+	datum.Level = "Info"
+	datum.Message = fmt.Sprintf("%.0f%% of the allocatable %s is requested and %.0f%% is limited", datum.RequestsPercent, datum.Resource, datum.LimitsPercent)
+	if hasUsage {
+		datum.Message += fmt.Sprintf(", %.0f%% is used", datum.UsagePercent)
+	}
+
+	switch {
+	case datum.Resource == "memory" && datum.LimitsPercent > 100 && datum.UsagePercent >= overcommitUsageWarningRate*100:
+		// Memory cannot be throttled, containers are OOM killed or pods evicted once it runs out
+		datum.Level = "Error"
+		datum.Message += "; memory limits are overcommitted and the node is running out of memory, containers may be OOM killed and pods evicted"
+	case datum.LimitsPercent > 100:
+		datum.Level = "Warning"
+		datum.Message += fmt.Sprintf("; %s limits are overcommitted, pods cannot all use their limits at once", datum.Resource)
+	}
+
+	if datum.RequestsPercent >= overcommitRequestsWarningRate*100 {
+		if datum.Level == "Info" {
+			datum.Level = "Warning"
+		}
+		datum.Message += fmt.Sprintf("; nearly all %s is requested, new pods may not be scheduled on the node", datum.Resource)
+	}
+
+	if hasUsage && datum.Usage > datum.Requests && datum.UsagePercent >= overcommitUsageWarningRate*100 {
+		if datum.Level == "Info" {
+			datum.Level = "Warning"
+		}
+		datum.Message += fmt.Sprintf("; pods use more %s than they request, the scheduler places pods on a node which is already busy", datum.Resource)
+	}
+}
+
+// diagnosePodsOverRequests lists the pods which use more of a resource than they request once the node uses most of
+// it, as the scheduler does not account for that usage and these pods are the first to be throttled or evicted
+func diagnosePodsOverRequests(node *overcommitDiagnosticDatum, pods []collector.NodePodResources, podMetrics []collector.PodMetrics) []overcommitDiagnosticDatum {
+	overcommitDiagnosticData := []overcommitDiagnosticDatum{}
+	if node.UsagePercent < overcommitUsageWarningRate*100 {
+		return overcommitDiagnosticData
+	}
+
+	podUsage := map[string]int64{}
+	for _, metrics := range podMetrics {
+		if node.Resource == "cpu" {
+			podUsage[metrics.Namespace+"/"+metrics.PodName] += metrics.CPUUsage
+		} else {
+			podUsage[metrics.Namespace+"/"+metrics.PodName] += metrics.MemoryUsage
+		}
+	}
+
+	for _, pod := range pods {
+		name := pod.Namespace + "/" + pod.Name
+		requests := pod.CPURequests
+		consequence := "it competes for the cpu of a busy node and may be throttled"
+		if node.Resource == "memory" {
+			requests = pod.MemoryRequests
+			consequence = "it is among the first pods evicted when the node runs out of memory"
+		}
+
+		usage, ok := podUsage[name]
+		if !ok || usage <= requests {
+			continue
+		}
+
+		overcommitDiagnosticData = append(overcommitDiagnosticData, overcommitDiagnosticDatum{
+			HostName: node.HostName,
+			Resource: node.Resource,
+			Pod:      name,
+			Requests: requests,
+			Usage:    usage,
+			Level:    "Warning",
+			Message:  fmt.Sprintf("Pod %s uses %s of %s and requests %s while the node uses %.0f%% of its allocatable %s; %s", name, formatResourceAmount(node.Resource, usage), node.Resource, formatResourceAmount(node.Resource, requests), node.UsagePercent, node.Resource, consequence),
+		})
+	}
+
+	return overcommitDiagnosticData
+}
+
+// formatResourceAmount formats millicores of cpu and bytes of memory
+func formatResourceAmount(resource string, amount int64) string {
+	if resource == "cpu" {
+		return fmt.Sprintf("%dm", amount)
+	}
+	return fmt.Sprintf("%dMi", amount/(1024*1024))
+}
@@ -0,0 +1,65 @@
+package diagnoser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnosePodsOverRequests(t *testing.T) {
+	pods := []collector.NodePodResources{
+		{Namespace: "default", Name: "web-0", CPURequests: 100, MemoryRequests: 256 * 1024 * 1024},
+		{Namespace: "default", Name: "batch-0"},
+		{Namespace: "kube-system", Name: "coredns-0", CPURequests: 100, MemoryRequests: 70 * 1024 * 1024},
+	}
+	podMetrics := []collector.PodMetrics{
+		{Namespace: "default", PodName: "web-0", ContainerName: "web", CPUUsage: 60, MemoryUsage: 200 * 1024 * 1024},
+		{Namespace: "default", PodName: "web-0", ContainerName: "sidecar", CPUUsage: 60, MemoryUsage: 20 * 1024 * 1024},
+		{Namespace: "default", PodName: "batch-0", ContainerName: "batch", CPUUsage: 1500, MemoryUsage: 1024 * 1024 * 1024},
+		{Namespace: "kube-system", PodName: "coredns-0", ContainerName: "coredns", CPUUsage: 5, MemoryUsage: 30 * 1024 * 1024},
+	}
+
+	tests := []struct {
+		name         string
+		node         overcommitDiagnosticDatum
+		wantPods     []string
+		wantMessages []string
+	}{
+		{
+			name:         "cpu of a busy node",
+			node:         overcommitDiagnosticDatum{Resource: "cpu", UsagePercent: 85},
+			wantPods:     []string{"default/web-0", "default/batch-0"},
+			wantMessages: []string{"uses 120m of cpu and requests 100m", "may be throttled"},
+		},
+		{
+			name:         "memory of a busy node",
+			node:         overcommitDiagnosticDatum{Resource: "memory", UsagePercent: 90},
+			wantPods:     []string{"default/batch-0"},
+			wantMessages: []string{"uses 1024Mi of memory and requests 0Mi", "first pods evicted"},
+		},
+		{
+			name: "node which is not busy",
+			node: overcommitDiagnosticDatum{Resource: "cpu", UsagePercent: 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diagnosePodsOverRequests(&tt.node, pods, podMetrics)
+			if len(got) != len(tt.wantPods) {
+				t.Fatalf("diagnosePodsOverRequests() = %+v, want pods %v", got, tt.wantPods)
+			}
+			for i, pod := range tt.wantPods {
+				if got[i].Pod != pod || got[i].Level != "Warning" {
+					t.Errorf("diagnosePodsOverRequests()[%d] = %s %s, want %s Warning", i, got[i].Pod, got[i].Level, pod)
+				}
+			}
+			for i, message := range tt.wantMessages {
+				if !strings.Contains(got[0].Message, message) {
+					t.Errorf("diagnosePodsOverRequests()[0].Message = %q, want message %d containing %q", got[0].Message, i, message)
+				}
+			}
+		})
+	}
+}
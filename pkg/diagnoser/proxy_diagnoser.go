@@ -0,0 +1,140 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+type proxyDiagnosticDatum struct {
+	HostName    string `json:"HostName"`
+	Destination string `json:"Destination"`
+	URL         string `json:"URL"`
+	Proxy       string `json:"Proxy"`
+	Message     string `json:"Message"`
+}
+
+// ProxyDiagnoser defines a Proxy Diagnoser struct
+type ProxyDiagnoser struct {
+	proxyCollector *collector.ProxyCollector
+	data           map[string]string
+}
+
+// NewProxyDiagnoser is a constructor
+func NewProxyDiagnoser(proxyCollector *collector.ProxyCollector) *ProxyDiagnoser {
+	return &ProxyDiagnoser{
+		proxyCollector: proxyCollector,
+		data:           make(map[string]string),
+	}
+}
+
+func (diagnoser *ProxyDiagnoser) GetName() string {
+	return "proxy"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *ProxyDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	var settings collector.ProxySettings
+	if data, ok := diagnoser.proxyCollector.GetData()["proxy"]; ok {
+		if err := json.Unmarshal([]byte(data), &settings); err != nil {
+			return fmt.Errorf("unmarshal proxy settings: %w", err)
+		}
+	}
+
+	proxyDiagnosticData := diagnoseProxy(hostName, &settings)
+
+	dataBytes, err := json.Marshal(proxyDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Proxy Diagnoser: %w", err)
+	}
+
+	diagnoser.data["proxy_diagnostic"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *ProxyDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseProxy reports the in-cluster and Azure platform destinations which NO_PROXY fails to exclude from the proxy
+func diagnoseProxy(hostName string, settings *collector.ProxySettings) []proxyDiagnosticDatum {
+	proxyDiagnosticData := []proxyDiagnosticDatum{}
+	if !settings.Enabled() {
+		return proxyDiagnosticData
+	}
+
+	proxyFunc := settings.ProxyFunc()
+
+	// Every cluster IP in use must be excluded, a NO_PROXY entry covering a single IP or part of the service CIDR
+	// leaves the other services behind the proxy
+	clusterIPs := []string{}
+	for _, clusterIP := range append([]string{settings.KubernetesServiceHost}, settings.ServiceClusterIPs...) {
+		if net.ParseIP(clusterIP) != nil {
+			clusterIPs = appendUnique(clusterIPs, clusterIP)
+		}
+	}
+
+	proxiedIPs := []string{}
+	var proxyURL *url.URL
+	for _, clusterIP := range clusterIPs {
+		if u, err := proxyFunc(&url.URL{Scheme: "https", Host: net.JoinHostPort(clusterIP, "443")}); err == nil && u != nil {
+			proxiedIPs = append(proxiedIPs, clusterIP)
+			proxyURL = u
+		}
+	}
+	if len(proxiedIPs) > 0 {
+		sort.Strings(proxiedIPs)
+		proxyDiagnosticData = append(proxyDiagnosticData, proxyDiagnosticDatum{
+			HostName:    hostName,
+			Destination: "cluster service CIDR",
+			URL:         "https://" + net.JoinHostPort(proxiedIPs[0], "443"),
+			Proxy:       proxyURL.Redacted(),
+			Message:     fmt.Sprintf("NO_PROXY does not exclude the cluster service CIDR, traffic to %d of the %d service cluster IPs is sent to the proxy (%s)", len(proxiedIPs), len(clusterIPs), strings.Join(proxiedIPs, ", ")),
+		})
+	}
+
+	destinations := []struct {
+		name string
+		url  string
+	}{
+		{name: "API server", url: "https://" + settings.APIServerFQDN},
+		{name: ".svc", url: "https://kubernetes.default.svc"},
+		{name: ".cluster.local", url: "https://kubernetes.default.svc.cluster.local"},
+		{name: "Azure Instance Metadata Service", url: "http://169.254.169.254"},
+		{name: "Azure platform wire server", url: "http://168.63.129.16"},
+	}
+
+	for _, destination := range destinations {
+		u, err := url.Parse(destination.url)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		proxyURL, err := proxyFunc(u)
+		if err != nil || proxyURL == nil {
+			continue
+		}
+
+		proxyDiagnosticData = append(proxyDiagnosticData, proxyDiagnosticDatum{
+			HostName:    hostName,
+			Destination: destination.name,
+			URL:         destination.url,
+			Proxy:       proxyURL.Redacted(),
+			Message:     fmt.Sprintf("NO_PROXY does not exclude the %s (%s), traffic to it is sent to the proxy", destination.name, u.Hostname()),
+		})
+	}
+
+	return proxyDiagnosticData
+}
@@ -0,0 +1,58 @@
+package diagnoser
+
+import (
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+func TestDiagnoseProxy(t *testing.T) {
+	tests := []struct {
+		name             string
+		noProxy          string
+		wantDestinations []string
+	}{
+		{
+			name:             "no exclusion",
+			noProxy:          "",
+			wantDestinations: []string{"cluster service CIDR", "API server", ".svc", ".cluster.local", "Azure Instance Metadata Service", "Azure platform wire server"},
+		},
+		{
+			name:             "single service IP excluded",
+			noProxy:          "10.0.0.1,myaks.hcp.eastus.azmk8s.io,.svc,.cluster.local,169.254.169.254,168.63.129.16",
+			wantDestinations: []string{"cluster service CIDR"},
+		},
+		{
+			name:             "part of the service CIDR excluded",
+			noProxy:          "10.0.0.0/24,myaks.hcp.eastus.azmk8s.io,.svc,.cluster.local,169.254.169.254,168.63.129.16",
+			wantDestinations: []string{"cluster service CIDR"},
+		},
+		{
+			name:             "service CIDR excluded",
+			noProxy:          "10.0.0.0/16,myaks.hcp.eastus.azmk8s.io,.svc,.cluster.local,169.254.169.254,168.63.129.16",
+			wantDestinations: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &collector.ProxySettings{
+				ProxyConfig:           utils.ProxyConfig{HTTPSProxy: "http://10.1.0.5:3128", HTTPProxy: "http://10.1.0.5:3128", NoProxy: tt.noProxy},
+				APIServerFQDN:         "myaks.hcp.eastus.azmk8s.io",
+				KubernetesServiceHost: "10.0.0.1",
+				ServiceClusterIPs:     []string{"10.0.0.1", "10.0.0.10", "10.0.42.17", "None"},
+			}
+
+			got := diagnoseProxy("aks-nodepool1-0", settings)
+			if len(got) != len(tt.wantDestinations) {
+				t.Fatalf("diagnoseProxy() = %+v, want %v", got, tt.wantDestinations)
+			}
+			for i, destination := range tt.wantDestinations {
+				if got[i].Destination != destination {
+					t.Errorf("diagnoseProxy()[%d] = %s, want %s", i, got[i].Destination, destination)
+				}
+			}
+		})
+	}
+}
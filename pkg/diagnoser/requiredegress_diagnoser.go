@@ -0,0 +1,115 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+type requiredEgressDiagnosticDatum struct {
+	HostName string `json:"HostName"`
+	Profile  string `json:"Profile"`
+	Version  string `json:"Version"`
+	Rule     string `json:"Rule"`
+	Purpose  string `json:"Purpose"`
+	Endpoint string `json:"Endpoint"`
+	FromNode string `json:"FromNode"`
+	FromPod  string `json:"FromPod"`
+	Message  string `json:"Message"`
+}
+
+// RequiredEgressDiagnoser defines a RequiredEgress Diagnoser struct
+type RequiredEgressDiagnoser struct {
+	networkOutboundCollector *collector.NetworkOutboundCollector
+	data                     map[string]string
+}
+
+// NewRequiredEgressDiagnoser is a constructor
+func NewRequiredEgressDiagnoser(networkOutboundCollector *collector.NetworkOutboundCollector) *RequiredEgressDiagnoser {
+	return &RequiredEgressDiagnoser{
+		networkOutboundCollector: networkOutboundCollector,
+		data:                     make(map[string]string),
+	}
+}
+
+func (diagnoser *RequiredEgressDiagnoser) GetName() string {
+	return "requiredegress"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *RequiredEgressDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	data, ok := diagnoser.networkOutboundCollector.GetData()[collector.NetworkOutboundEgressProfileKey]
+	if !ok {
+		return nil
+	}
+
+	var profileResult collector.EgressProfileResult
+	if err := json.Unmarshal([]byte(data), &profileResult); err != nil {
+		return fmt.Errorf("unmarshal egress profile: %w", err)
+	}
+
+	requiredEgressDiagnosticData := diagnoseRequiredEgress(hostName, &profileResult)
+
+	dataBytes, err := json.Marshal(requiredEgressDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from RequiredEgress Diagnoser: %w", err)
+	}
+
+	diagnoser.data["requiredegress"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *RequiredEgressDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseRequiredEgress lists the rules of the profile which could not be reached from the node or from the pod
+// network, and the rules which could not be checked at all
+func diagnoseRequiredEgress(hostName string, profileResult *collector.EgressProfileResult) []requiredEgressDiagnosticDatum {
+	requiredEgressDiagnosticData := []requiredEgressDiagnosticDatum{}
+
+	for _, rule := range profileResult.Rules {
+		nodeFailed := strings.HasPrefix(rule.FromNode, "Error")
+		podFailed := strings.HasPrefix(rule.FromPod, "Error")
+
+		var message string
+		switch {
+		case strings.HasPrefix(rule.FromNode, "Skipped") && strings.HasPrefix(rule.FromPod, "Skipped"):
+			message = "Required egress rule was not checked, " + strings.TrimPrefix(rule.FromNode, "Skipped: ")
+		case nodeFailed && podFailed:
+			message = "Required egress rule is missing, the endpoint is not reachable from the node nor from the pod network"
+		case strings.HasPrefix(rule.FromNode, "Skipped") && podFailed:
+			message = "Required egress rule is missing for the pod network, the endpoint was not checked from the node, " + strings.TrimPrefix(rule.FromNode, "Skipped: ")
+		case nodeFailed:
+			message = "Required egress rule is missing for the node, the endpoint is only reachable from the pod network"
+		case podFailed:
+			message = "Required egress rule is missing for the pod network, the endpoint is only reachable from the node"
+		default:
+			continue
+		}
+
+		requiredEgressDiagnosticData = append(requiredEgressDiagnosticData, requiredEgressDiagnosticDatum{
+			HostName: hostName,
+			Profile:  profileResult.Profile,
+			Version:  profileResult.Version,
+			Rule:     rule.FQDN + ":" + strconv.Itoa(rule.Port) + "/" + rule.Protocol,
+			Purpose:  rule.Purpose,
+			Endpoint: rule.Endpoint,
+			FromNode: rule.FromNode,
+			FromPod:  rule.FromPod,
+			Message:  message,
+		})
+	}
+
+	return requiredEgressDiagnosticData
+}
@@ -0,0 +1,56 @@
+package diagnoser
+
+import (
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+func TestDiagnoseRequiredEgress(t *testing.T) {
+	rule := func(fqdn string, port int, protocol string, fromNode string, fromPod string) collector.EgressRuleResult {
+		return collector.EgressRuleResult{
+			EgressRule: collector.EgressRule{FQDN: fqdn, Port: port, Protocol: protocol},
+			FromNode:   fromNode,
+			FromPod:    fromPod,
+		}
+	}
+
+	profileResult := &collector.EgressProfileResult{
+		Profile: "aks-required-egress",
+		Version: "2021-10-01",
+		Rules: []collector.EgressRuleResult{
+			rule("mcr.microsoft.com", 443, "TCP", "Connected", "Connected"),
+			rule("{location}.data.mcr.microsoft.com", 443, "TCP", "Skipped: cannot resolve {location}.data.mcr.microsoft.com", "Skipped: cannot resolve {location}.data.mcr.microsoft.com"),
+			rule("management.azure.com", 443, "TCP", "Error: Fail to run command on host: exit status 124", "Error: tcp: dial tcp 20.0.0.1:443: i/o timeout"),
+			rule("login.microsoftonline.com", 443, "TCP", "Skipped: reached through proxy 10.0.0.5:3128, checked from the pod network", "Connected"),
+			rule("packages.microsoft.com", 443, "TCP", "Connected", "Error: tls: x509: certificate signed by unknown authority"),
+			rule("ntp.ubuntu.com", 123, "UDP", "Error: Fail to run command on host: exit status 124", "Connected"),
+			rule("acs-mirror.azureedge.net", 443, "TCP", "Skipped: reached through proxy 10.0.0.5:3128, checked from the pod network", "Error: connect: proxy returned 403 Forbidden"),
+		},
+	}
+
+	want := []struct {
+		rule    string
+		message string
+	}{
+		{"{location}.data.mcr.microsoft.com:443/TCP", "Required egress rule was not checked, cannot resolve {location}.data.mcr.microsoft.com"},
+		{"management.azure.com:443/TCP", "Required egress rule is missing, the endpoint is not reachable from the node nor from the pod network"},
+		{"packages.microsoft.com:443/TCP", "Required egress rule is missing for the pod network, the endpoint is only reachable from the node"},
+		{"ntp.ubuntu.com:123/UDP", "Required egress rule is missing for the node, the endpoint is only reachable from the pod network"},
+		{"acs-mirror.azureedge.net:443/TCP", "Required egress rule is missing for the pod network, the endpoint was not checked from the node, reached through proxy 10.0.0.5:3128, checked from the pod network"},
+	}
+
+	got := diagnoseRequiredEgress("aks-nodepool1-0", profileResult)
+	if len(got) != len(want) {
+		t.Fatalf("diagnoseRequiredEgress() = %+v, want %d findings", got, len(want))
+	}
+
+	for i := range want {
+		if got[i].Rule != want[i].rule || got[i].Message != want[i].message {
+			t.Errorf("diagnoseRequiredEgress()[%d] = %s %q, want %s %q", i, got[i].Rule, got[i].Message, want[i].rule, want[i].message)
+		}
+		if got[i].HostName != "aks-nodepool1-0" || got[i].Profile != "aks-required-egress" {
+			t.Errorf("diagnoseRequiredEgress()[%d] = %+v, want host name and profile set", i, got[i])
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// saturationRate defines the share of a resource in use above which a sample is saturated
+	saturationRate = 0.9
+	// sustainedSaturationSamples defines the number of consecutive saturated samples above which saturation is
+	// sustained rather than a spike
+	sustainedSaturationSamples = 3
+	// topConsumers defines the number of containers and pods reported as the top consumers of each resource
+	topConsumers = 5
+)
+
+type saturationDiagnosticDatum struct {
+	HostName string  `json:"HostName"`
+	Source   string  `json:"Source"`
+	Name     string  `json:"Name,omitempty"`
+	Resource string  `json:"Resource"`
+	Average  float64 `json:"Average"`
+	Peak     float64 `json:"Peak"`
+	Limit    float64 `json:"Limit,omitempty"`
+	Start    string  `json:"Start,omitempty"`
+	End      string  `json:"End,omitempty"`
+	Level    string  `json:"Level"`
+	Message  string  `json:"Message"`
+}
+
+// saturationSeries defines the values of a resource over the sampling window, sorted by time
+type saturationSeries struct {
+	timeStamps []time.Time
+	values     []float64
+	limit      float64
+}
+
+// SaturationDiagnoser defines a Saturation Diagnoser struct
+type SaturationDiagnoser struct {
+	perfSamplesCollector *collector.PerfSamplesCollector
+	data                 map[string]string
+}
+
+// NewSaturationDiagnoser is a constructor
+func NewSaturationDiagnoser(perfSamplesCollector *collector.PerfSamplesCollector) *SaturationDiagnoser {
+	return &SaturationDiagnoser{
+		perfSamplesCollector: perfSamplesCollector,
+		data:                 make(map[string]string),
+	}
+}
+
+func (diagnoser *SaturationDiagnoser) GetName() string {
+	return "saturation"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *SaturationDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	perfSamplesData := diagnoser.perfSamplesCollector.GetData()
+
+	nodeSamples := []collector.NodePerfSample{}
+	if err := unmarshalNDJSON(perfSamplesData["perfsamples_node"], func(line []byte) error {
+		var sample collector.NodePerfSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		nodeSamples = append(nodeSamples, sample)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unmarshal node samples: %w", err)
+	}
+
+	containerSamples := []collector.ContainerPerfSample{}
+	if err := unmarshalNDJSON(perfSamplesData["perfsamples_containers"], func(line []byte) error {
+		var sample collector.ContainerPerfSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		containerSamples = append(containerSamples, sample)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unmarshal container samples: %w", err)
+	}
+
+	podNetworkSamples := []collector.PodNetworkPerfSample{}
+	if err := unmarshalNDJSON(perfSamplesData["perfsamples_podsnetwork"], func(line []byte) error {
+		var sample collector.PodNetworkPerfSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		podNetworkSamples = append(podNetworkSamples, sample)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unmarshal pod network samples: %w", err)
+	}
+
+	saturationDiagnosticData := []saturationDiagnosticDatum{}
+
+	// The node resources are percentages of the node, or rates without a known limit
+	nodeSeries := map[string]*saturationSeries{}
+	for _, resource := range []string{"cpu", "memory", "network-rx", "network-tx", "disk-read", "disk-write"} {
+		nodeSeries[resource] = &saturationSeries{}
+	}
+	nodeSeries["cpu"].limit = 100
+	nodeSeries["memory"].limit = 100
+	for _, sample := range nodeSamples {
+		for resource, value := range map[string]float64{
+			"cpu":        sample.CPUPercent,
+			"memory":     sample.MemoryPercent,
+			"network-rx": sample.NetworkRxBytesPerSecond,
+			"network-tx": sample.NetworkTxBytesPerSecond,
+			"disk-read":  sample.DiskReadBytesPerSecond,
+			"disk-write": sample.DiskWriteBytesPerSecond,
+		} {
+			nodeSeries[resource].add(sample.TimeStamp, value)
+		}
+	}
+
+	for _, resource := range []string{"cpu", "memory", "network-rx", "network-tx", "disk-read", "disk-write"} {
+		series := nodeSeries[resource]
+		if len(series.values) == 0 {
+			continue
+		}
+
+		datum := saturationDiagnosticDatum{
+			HostName: hostName,
+			Source:   "node",
+			Resource: resource,
+			Average:  series.average(),
+			Peak:     series.peak(),
+			Limit:    series.limit,
+			Level:    "Info",
+		}
+
+		if series.limit == 0 {
+			datum.Message = fmt.Sprintf("Node %s averaged %s/s and peaked at %s/s", resource, formatBytes(datum.Average), formatBytes(datum.Peak))
+			saturationDiagnosticData = append(saturationDiagnosticData, datum)
+			continue
+		}
+
+		datum.Message = fmt.Sprintf("Node %s averaged %.0f%% and peaked at %.0f%%", resource, datum.Average, datum.Peak)
+		diagnoseSaturation(&datum, series, func(start time.Time, end time.Time) string {
+			if resource == "memory" {
+				return fmt.Sprintf("the node ran out of memory from %s to %s, pods may be evicted and containers OOM killed", start.Format(time.RFC3339), end.Format(time.RFC3339))
+			}
+			return fmt.Sprintf("the node was saturated from %s to %s, containers compete for CPU", start.Format(time.RFC3339), end.Format(time.RFC3339))
+		})
+		saturationDiagnosticData = append(saturationDiagnosticData, datum)
+	}
+
+	// Containers are saturated when they use most of their limit
+	cpuSeries := map[string]*saturationSeries{}
+	memorySeries := map[string]*saturationSeries{}
+	for _, sample := range containerSamples {
+		name := sample.Namespace + "/" + sample.PodName + "/" + sample.ContainerName
+		if cpuSeries[name] == nil {
+			cpuSeries[name] = &saturationSeries{}
+			memorySeries[name] = &saturationSeries{}
+		}
+		cpuSeries[name].limit = float64(sample.CPULimits)
+		cpuSeries[name].add(sample.TimeStamp, float64(sample.CPUUsage))
+		memorySeries[name].limit = float64(sample.MemoryLimits)
+		memorySeries[name].add(sample.TimeStamp, float64(sample.MemoryUsage))
+	}
+
+	for _, name := range getSortedSeriesNames(cpuSeries) {
+		for _, resource := range []string{"cpu", "memory"} {
+			series := cpuSeries[name]
+			if resource == "memory" {
+				series = memorySeries[name]
+			}
+			if series.limit == 0 {
+				continue
+			}
+
+			datum := saturationDiagnosticDatum{
+				HostName: hostName,
+				Source:   "container",
+				Name:     name,
+				Resource: resource,
+				Average:  series.average(),
+				Peak:     series.peak(),
+				Limit:    series.limit,
+			}
+			datum.Message = fmt.Sprintf("Container %s used %.0f%% of its %s limit on average", name, datum.Average/datum.Limit*100, resource)
+			diagnoseSaturation(&datum, series, func(start time.Time, end time.Time) string {
+				if resource == "memory" {
+					return fmt.Sprintf("it was near its memory limit from %s to %s and may be OOM killed", start.Format(time.RFC3339), end.Format(time.RFC3339))
+				}
+				return fmt.Sprintf("it was near its CPU limit from %s to %s and is throttled", start.Format(time.RFC3339), end.Format(time.RFC3339))
+			})
+
+			// Containers which are not saturated are left to the top consumers
+			if datum.Level != "Info" {
+				saturationDiagnosticData = append(saturationDiagnosticData, datum)
+			}
+		}
+	}
+
+	saturationDiagnosticData = append(saturationDiagnosticData, getTopConsumers(hostName, "container", "cpu", cpuSeries, func(value float64) string {
+		return fmt.Sprintf("%.0fm", value)
+	})...)
+	saturationDiagnosticData = append(saturationDiagnosticData, getTopConsumers(hostName, "container", "memory", memorySeries, formatBytes)...)
+
+	networkSeries := map[string]*saturationSeries{}
+	for _, sample := range podNetworkSamples {
+		name := sample.Namespace + "/" + sample.PodName
+		if networkSeries[name] == nil {
+			networkSeries[name] = &saturationSeries{}
+		}
+		networkSeries[name].add(sample.TimeStamp, sample.RxBytesPerSecond+sample.TxBytesPerSecond)
+	}
+	saturationDiagnosticData = append(saturationDiagnosticData, getTopConsumers(hostName, "pod", "network", networkSeries, func(value float64) string {
+		return formatBytes(value) + "/s"
+	})...)
+
+	dataBytes, err := json.Marshal(saturationDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Saturation Diagnoser: %w", err)
+	}
+
+	diagnoser.data["saturation"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *SaturationDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+func (series *saturationSeries) add(timeStamp time.Time, value float64) {
+	series.timeStamps = append(series.timeStamps, timeStamp)
+	series.values = append(series.values, value)
+}
+
+func (series *saturationSeries) average() float64 {
+	if len(series.values) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, value := range series.values {
+		sum += value
+	}
+	return sum / float64(len(series.values))
+}
+
+func (series *saturationSeries) peak() float64 {
+	peak := 0.0
+	for _, value := range series.values {
+		if value > peak {
+			peak = value
+		}
+	}
+	return peak
+}
+
+// getLongestSaturation returns the longest run of consecutive samples at or above the saturation rate of the limit
+func (series *saturationSeries) getLongestSaturation() (time.Time, time.Time, int) {
+	var start, end time.Time
+	longest, current := 0, 0
+	for i, value := range series.values {
+		if value < series.limit*saturationRate {
+			current = 0
+			continue
+		}
+
+		current++
+		if current > longest {
+			longest = current
+			start = series.timeStamps[i-current+1]
+			end = series.timeStamps[i]
+		}
+	}
+
+	return start, end, longest
+}
+
+// diagnoseSaturation reports the longest saturation of a series, sustained saturation being a warning or an error for
+// memory, which cannot be reclaimed from the containers using it
+func diagnoseSaturation(datum *saturationDiagnosticDatum, series *saturationSeries, describe func(time.Time, time.Time) string) {
+	datum.Level = "Info"
+
+	start, end, samples := series.getLongestSaturation()
+	if samples == 0 {
+		return
+	}
+
+	datum.Start = start.Format(time.RFC3339)
+	datum.End = end.Format(time.RFC3339)
+
+	if samples < sustainedSaturationSamples {
+		datum.Message += fmt.Sprintf("; it spiked above %.0f%% of the limit for %d samples", saturationRate*100, samples)
+		return
+	}
+
+	datum.Level = "Warning"
+	if datum.Resource == "memory" && datum.Source == "node" {
+		datum.Level = "Error"
+	}
+	datum.Message += "; " + describe(start, end)
+}
+
+// getTopConsumers reports the series with the highest average usage of a resource
+func getTopConsumers(hostName string, source string, resource string, series map[string]*saturationSeries, format func(float64) string) []saturationDiagnosticDatum {
+	names := getSortedSeriesNames(series)
+	sort.SliceStable(names, func(i, j int) bool { return series[names[i]].average() > series[names[j]].average() })
+	if len(names) > topConsumers {
+		names = names[:topConsumers]
+	}
+
+	data := []saturationDiagnosticDatum{}
+	for i, name := range names {
+		datum := saturationDiagnosticDatum{
+			HostName: hostName,
+			Source:   "top/" + source,
+			Name:     name,
+			Resource: resource,
+			Average:  series[name].average(),
+			Peak:     series[name].peak(),
+			Limit:    series[name].limit,
+			Level:    "Info",
+		}
+		datum.Message = fmt.Sprintf("%s %s is the #%d %s consumer of the node, averaging %s and peaking at %s", strings.ToUpper(source[:1])+source[1:], name, i+1, resource, format(datum.Average), format(datum.Peak))
+		data = append(data, datum)
+	}
+
+	return data
+}
+
+func getSortedSeriesNames(series map[string]*saturationSeries) []string {
+	names := []string{}
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unmarshalNDJSON calls unmarshal for every non empty line of data
+func unmarshalNDJSON(data string, unmarshal func([]byte) error) error {
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+		if err := unmarshal([]byte(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatBytes formats a number of bytes with a binary unit
+func formatBytes(value float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
@@ -0,0 +1,157 @@
+package diagnoser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSaturationSeries(limit float64, values ...float64) *saturationSeries {
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	series := &saturationSeries{limit: limit}
+	for i, value := range values {
+		series.add(start.Add(time.Duration(i)*10*time.Second), value)
+	}
+	return series
+}
+
+func TestGetLongestSaturation(t *testing.T) {
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(sample int) time.Time { return start.Add(time.Duration(sample) * 10 * time.Second) }
+
+	tests := []struct {
+		name        string
+		series      *saturationSeries
+		wantStart   time.Time
+		wantEnd     time.Time
+		wantSamples int
+	}{
+		{
+			name:   "never saturated",
+			series: newTestSaturationSeries(100, 10, 50, 89.9, 20),
+		},
+		{
+			name:        "saturated at exactly the saturation rate",
+			series:      newTestSaturationSeries(100, 10, 90, 20),
+			wantStart:   at(1),
+			wantEnd:     at(1),
+			wantSamples: 1,
+		},
+		{
+			name:        "longest of two streaks",
+			series:      newTestSaturationSeries(100, 95, 96, 10, 91, 92, 99, 10, 97),
+			wantStart:   at(3),
+			wantEnd:     at(5),
+			wantSamples: 3,
+		},
+		{
+			name:        "first of two streaks of the same length",
+			series:      newTestSaturationSeries(100, 95, 96, 10, 91, 92),
+			wantStart:   at(0),
+			wantEnd:     at(1),
+			wantSamples: 2,
+		},
+		{
+			name:        "streak lasting until the last sample",
+			series:      newTestSaturationSeries(200, 10, 185, 190, 200, 210),
+			wantStart:   at(1),
+			wantEnd:     at(4),
+			wantSamples: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, samples := tt.series.getLongestSaturation()
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) || samples != tt.wantSamples {
+				t.Errorf("getLongestSaturation() = %v, %v, %d, want %v, %v, %d", start, end, samples, tt.wantStart, tt.wantEnd, tt.wantSamples)
+			}
+		})
+	}
+}
+
+func TestDiagnoseSaturation(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		resource    string
+		series      *saturationSeries
+		wantLevel   string
+		wantMessage string
+	}{
+		{
+			name:      "not saturated",
+			source:    "node",
+			resource:  "cpu",
+			series:    newTestSaturationSeries(100, 10, 20, 30),
+			wantLevel: "Info",
+		},
+		{
+			name:        "spike shorter than a sustained saturation",
+			source:      "node",
+			resource:    "cpu",
+			series:      newTestSaturationSeries(100, 10, 95, 95, 10),
+			wantLevel:   "Info",
+			wantMessage: "spiked above 90% of the limit for 2 samples",
+		},
+		{
+			name:        "sustained node cpu saturation",
+			source:      "node",
+			resource:    "cpu",
+			series:      newTestSaturationSeries(100, 95, 95, 95),
+			wantLevel:   "Warning",
+			wantMessage: "saturated",
+		},
+		{
+			name:        "sustained node memory saturation",
+			source:      "node",
+			resource:    "memory",
+			series:      newTestSaturationSeries(100, 95, 95, 95, 95),
+			wantLevel:   "Error",
+			wantMessage: "saturated",
+		},
+		{
+			name:        "sustained container memory saturation",
+			source:      "container",
+			resource:    "memory",
+			series:      newTestSaturationSeries(512, 500, 500, 500),
+			wantLevel:   "Warning",
+			wantMessage: "saturated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datum := saturationDiagnosticDatum{Source: tt.source, Resource: tt.resource}
+			diagnoseSaturation(&datum, tt.series, func(start time.Time, end time.Time) string {
+				return fmt.Sprintf("saturated from %s to %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+			})
+
+			if datum.Level != tt.wantLevel || !strings.Contains(datum.Message, tt.wantMessage) {
+				t.Errorf("diagnoseSaturation() = %s %q, want %s containing %q", datum.Level, datum.Message, tt.wantLevel, tt.wantMessage)
+			}
+			if tt.wantMessage == "" && (datum.Start != "" || datum.End != "") {
+				t.Errorf("diagnoseSaturation() = from %s to %s, want no saturation window", datum.Start, datum.End)
+			}
+		})
+	}
+}
+
+func TestGetTopConsumers(t *testing.T) {
+	series := map[string]*saturationSeries{}
+	for i := 0; i < topConsumers+2; i++ {
+		series[fmt.Sprintf("default/web-%d", i)] = newTestSaturationSeries(0, float64(i*100), float64(i*100+50))
+	}
+
+	got := getTopConsumers("node-0", "pod", "network", series, formatBytes)
+	if len(got) != topConsumers {
+		t.Fatalf("getTopConsumers() = %+v, want %d consumers", got, topConsumers)
+	}
+	if got[0].Name != "default/web-6" || got[topConsumers-1].Name != "default/web-2" {
+		t.Errorf("getTopConsumers() = %s..%s, want default/web-6..default/web-2", got[0].Name, got[topConsumers-1].Name)
+	}
+	if got[0].Source != "top/pod" || !strings.HasPrefix(got[0].Message, "Pod default/web-6 is the #1 network consumer") {
+		t.Errorf("getTopConsumers()[0] = %s %q, want the #1 pod network consumer", got[0].Source, got[0].Message)
+	}
+}
@@ -0,0 +1,423 @@
+package diagnoser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// closestNodes defines the number of nodes reported as the closest to fit a pending pod
+const closestNodes = 3
+
+var (
+	// schedulerMessageRegex matches "0/3 nodes are available: <reasons>." optionally followed by the preemption
+	// attempt of newer schedulers
+	schedulerMessageRegex = regexp.MustCompile(`^\d+/(\d+) nodes are available: (.*?)\.?(?: preemption: .*)?$`)
+	schedulerReasonRegex  = regexp.MustCompile(`^(\d+) (.*)$`)
+)
+
+// schedulingReasonCategories maps the phrases of scheduler messages to the category of the blocking reason, the first
+// matching phrase winning
+var schedulingReasonCategories = []struct {
+	phrase   string
+	category string
+}{
+	{"Insufficient", "resources"},
+	{"Too many pods", "resources"},
+	{"taint", "taints"},
+	{"were unschedulable", "taints"},
+	{"volume node affinity", "volumes"},
+	{"node affinity", "node-affinity"},
+	{"node selector", "node-affinity"},
+	{"pod affinity", "pod-affinity"},
+	{"pod anti-affinity", "pod-affinity"},
+	{"topology spread", "topology-spread"},
+	{"PersistentVolumeClaim", "volumes"},
+	{"persistent volumes", "volumes"},
+	{"max volume count", "volumes"},
+	{"free ports", "ports"},
+}
+
+// nodeSelectorOperators maps the operators of node selector requirements to the operators of label selectors
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+type schedulingReason struct {
+	Category string `json:"Category"`
+	Nodes    int    `json:"Nodes,omitempty"`
+	Reason   string `json:"Reason"`
+}
+
+type schedulingNodeFit struct {
+	Node       string   `json:"Node"`
+	FreeCPU    int64    `json:"FreeCPU"`
+	FreeMemory int64    `json:"FreeMemory"`
+	FreePods   int64    `json:"FreePods"`
+	Blocking   []string `json:"Blocking,omitempty"`
+}
+
+type schedulingDiagnosticDatum struct {
+	HostName       string              `json:"HostName"`
+	Namespace      string              `json:"Namespace"`
+	Pod            string              `json:"Pod"`
+	PendingSince   string              `json:"PendingSince"`
+	CPURequests    int64               `json:"CPURequests"`
+	MemoryRequests int64               `json:"MemoryRequests"`
+	TotalNodes     int                 `json:"TotalNodes,omitempty"`
+	Reasons        []schedulingReason  `json:"Reasons,omitempty"`
+	ClosestNodes   []schedulingNodeFit `json:"ClosestNodes,omitempty"`
+	Level          string              `json:"Level"`
+	Message        string              `json:"Message"`
+}
+
+// SchedulingDiagnoser defines a Scheduling Diagnoser struct
+type SchedulingDiagnoser struct {
+	kubeconfig *restclient.Config
+	data       map[string]string
+}
+
+// NewSchedulingDiagnoser is a constructor
+func NewSchedulingDiagnoser(config *restclient.Config) *SchedulingDiagnoser {
+	return &SchedulingDiagnoser{
+		kubeconfig: config,
+		data:       make(map[string]string),
+	}
+}
+
+func (diagnoser *SchedulingDiagnoser) GetName() string {
+	return "scheduling"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *SchedulingDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(diagnoser.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("getting access to K8S failed: %w", err)
+	}
+
+	// Pending pods are cluster-wide, so a single pod of the DaemonSet diagnoses them
+	if clusterScope, err := utils.IsClusterScopeInstance(clientset); err != nil {
+		log.Printf("Check cluster scope instance failed, pending pods are diagnosed: %v", err)
+	} else if !clusterScope {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	pending, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Pending,spec.nodeName="})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	schedulingDiagnosticData := []schedulingDiagnosticDatum{}
+	if len(pending.Items) == 0 {
+		return diagnoser.setData(schedulingDiagnosticData)
+	}
+
+	events, err := clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "reason=FailedScheduling"})
+	if err != nil {
+		return fmt.Errorf("list events: %w", err)
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes: %w", err)
+	}
+
+	// Like the scheduler, terminated pods do not account for the resources of the nodes
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	nodeRequests := map[string][]collector.NodePodResources{}
+	for i := range pods.Items {
+		if nodeName := pods.Items[i].Spec.NodeName; nodeName != "" {
+			nodeRequests[nodeName] = append(nodeRequests[nodeName], collector.GetNodePodResources(&pods.Items[i]))
+		}
+	}
+
+	// The latest FailedScheduling event of each pod tells why it was not scheduled
+	messages := map[string]v1.Event{}
+	for _, event := range events.Items {
+		key := string(event.InvolvedObject.UID)
+		if latest, ok := messages[key]; !ok || getEventTime(&event).After(getEventTime(&latest)) {
+			messages[key] = event
+		}
+	}
+
+	for i := range pending.Items {
+		pod := &pending.Items[i]
+		requests := collector.GetNodePodResources(pod)
+
+		datum := schedulingDiagnosticDatum{
+			HostName:       hostName,
+			Namespace:      pod.Namespace,
+			Pod:            pod.Name,
+			PendingSince:   pod.CreationTimestamp.UTC().Format(time.RFC3339),
+			CPURequests:    requests.CPURequests,
+			MemoryRequests: requests.MemoryRequests,
+			Level:          "Warning",
+		}
+
+		message := ""
+		if event, ok := messages[string(pod.UID)]; ok {
+			message = event.Message
+		}
+		for _, condition := range pod.Status.Conditions {
+			if message == "" && condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse {
+				message = condition.Message
+			}
+		}
+
+		if message == "" {
+			datum.Message = fmt.Sprintf("Pod %s/%s is pending without a scheduling failure, scheduler %s may not have processed it yet or may not be running", pod.Namespace, pod.Name, pod.Spec.SchedulerName)
+		} else {
+			datum.Level = "Error"
+			datum.TotalNodes, datum.Reasons = parseSchedulerMessage(message)
+			datum.Message = fmt.Sprintf("Pod %s/%s cannot be scheduled: %s", pod.Namespace, pod.Name, message)
+		}
+
+		datum.ClosestNodes = getClosestNodes(pod, requests, nodes.Items, nodeRequests)
+		if len(datum.ClosestNodes) > 0 {
+			closest := datum.ClosestNodes[0]
+			if len(closest.Blocking) == 0 {
+				datum.Message += fmt.Sprintf("; node %s seems to fit now", closest.Node)
+			} else {
+				datum.Message += fmt.Sprintf("; the closest node is %s, blocked by %s", closest.Node, strings.Join(closest.Blocking, ", "))
+			}
+		}
+
+		schedulingDiagnosticData = append(schedulingDiagnosticData, datum)
+	}
+
+	return diagnoser.setData(schedulingDiagnosticData)
+}
+
+func (diagnoser *SchedulingDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+func (diagnoser *SchedulingDiagnoser) setData(schedulingDiagnosticData []schedulingDiagnosticDatum) error {
+	dataBytes, err := json.Marshal(schedulingDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from Scheduling Diagnoser: %w", err)
+	}
+
+	diagnoser.data["scheduling"] = string(dataBytes)
+
+	return nil
+}
+
+// parseSchedulerMessage returns the number of nodes and the reasons a scheduler message gives for each of them, such
+// as "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had taint {key: value}, that the pod didn't tolerate."
+func parseSchedulerMessage(message string) (int, []schedulingReason) {
+	match := schedulerMessageRegex.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return 0, []schedulingReason{{Category: getSchedulingReasonCategory(message), Reason: message}}
+	}
+
+	total, _ := strconv.Atoi(match[1])
+
+	// Reasons are separated by commas, which some reasons contain as well, but every reason starts with its node count
+	reasons := []schedulingReason{}
+	for _, part := range strings.Split(match[2], ", ") {
+		reasonMatch := schedulerReasonRegex.FindStringSubmatch(part)
+		if reasonMatch == nil && len(reasons) > 0 {
+			reasons[len(reasons)-1].Reason += ", " + part
+			continue
+		}
+
+		reason := schedulingReason{Reason: part}
+		if reasonMatch != nil {
+			reason.Nodes, _ = strconv.Atoi(reasonMatch[1])
+			reason.Reason = reasonMatch[2]
+		}
+		reasons = append(reasons, reason)
+	}
+
+	for i := range reasons {
+		reasons[i].Category = getSchedulingReasonCategory(reasons[i].Reason)
+	}
+
+	return total, reasons
+}
+
+func getSchedulingReasonCategory(reason string) string {
+	for _, category := range schedulingReasonCategories {
+		if strings.Contains(reason, category.phrase) {
+			return category.category
+		}
+	}
+	return "other"
+}
+
+// getClosestNodes evaluates the resources, taints, node selector and required node affinity of the pod against every
+// node, and returns the nodes with the fewest blocking reasons and the most room left
+func getClosestNodes(pod *v1.Pod, requests collector.NodePodResources, nodes []v1.Node, nodeRequests map[string][]collector.NodePodResources) []schedulingNodeFit {
+	fits := []schedulingNodeFit{}
+	for i := range nodes {
+		node := &nodes[i]
+
+		fit := schedulingNodeFit{
+			Node:       node.Name,
+			FreeCPU:    node.Status.Allocatable.Cpu().MilliValue(),
+			FreeMemory: node.Status.Allocatable.Memory().Value(),
+			FreePods:   node.Status.Allocatable.Pods().Value(),
+		}
+		for _, resources := range nodeRequests[node.Name] {
+			fit.FreeCPU -= resources.CPURequests
+			fit.FreeMemory -= resources.MemoryRequests
+			fit.FreePods--
+		}
+
+		if requests.CPURequests > fit.FreeCPU {
+			fit.Blocking = append(fit.Blocking, fmt.Sprintf("%dm cpu missing", requests.CPURequests-fit.FreeCPU))
+		}
+		if requests.MemoryRequests > fit.FreeMemory {
+			fit.Blocking = append(fit.Blocking, fmt.Sprintf("%d MiB memory missing", (requests.MemoryRequests-fit.FreeMemory)/1024/1024))
+		}
+		if fit.FreePods < 1 {
+			fit.Blocking = append(fit.Blocking, "no pods left")
+		}
+		if node.Spec.Unschedulable {
+			fit.Blocking = append(fit.Blocking, "node is cordoned")
+		}
+
+		for j := range node.Spec.Taints {
+			taint := &node.Spec.Taints[j]
+			if taint.Effect == v1.TaintEffectPreferNoSchedule || toleratesTaint(pod.Spec.Tolerations, taint) {
+				continue
+			}
+			fit.Blocking = append(fit.Blocking, fmt.Sprintf("taint %s not tolerated", taint.ToString()))
+		}
+
+		if len(pod.Spec.NodeSelector) > 0 && !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+			fit.Blocking = append(fit.Blocking, "node selector not matched")
+		}
+
+		if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			if !matchesNodeSelectorTerms(node, affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) {
+				fit.Blocking = append(fit.Blocking, "required node affinity not matched")
+			}
+		}
+
+		fits = append(fits, fit)
+	}
+
+	sort.SliceStable(fits, func(i, j int) bool {
+		if len(fits[i].Blocking) != len(fits[j].Blocking) {
+			return len(fits[i].Blocking) < len(fits[j].Blocking)
+		}
+		return getFreeShare(fits[i], requests) > getFreeShare(fits[j], requests)
+	})
+
+	if len(fits) > closestNodes {
+		fits = fits[:closestNodes]
+	}
+
+	return fits
+}
+
+// getFreeShare returns the smallest share of the requests of the pod the node has room for
+func getFreeShare(fit schedulingNodeFit, requests collector.NodePodResources) float64 {
+	share := float64(fit.FreeCPU+1) / float64(requests.CPURequests+1)
+	if memoryShare := float64(fit.FreeMemory+1) / float64(requests.MemoryRequests+1); memoryShare < share {
+		share = memoryShare
+	}
+	return share
+}
+
+// matchesNodeSelectorTerms tells whether the node matches any of the terms, the requirements of a term being ANDed
+func matchesNodeSelectorTerms(node *v1.Node, terms []v1.NodeSelectorTerm) bool {
+	for i := range terms {
+		if matchesNodeSelectorTerm(node, &terms[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesNodeSelectorTerm(node *v1.Node, term *v1.NodeSelectorTerm) bool {
+	// Like the scheduler, a term without requirements matches no node
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+
+	for i := range term.MatchExpressions {
+		expression := &term.MatchExpressions[i]
+		operator, ok := nodeSelectorOperators[expression.Operator]
+		if !ok {
+			return false
+		}
+		requirement, err := labels.NewRequirement(expression.Key, operator, expression.Values)
+		if err != nil || !requirement.Matches(labels.Set(node.Labels)) {
+			return false
+		}
+	}
+
+	// metadata.name is the only field nodes can be selected by, with the In and NotIn operators
+	for _, field := range term.MatchFields {
+		found := false
+		for _, value := range field.Values {
+			found = found || value == node.Name
+		}
+
+		switch {
+		case field.Key != "metadata.name":
+			return false
+		case field.Operator == v1.NodeSelectorOpIn && !found:
+			return false
+		case field.Operator == v1.NodeSelectorOpNotIn && found:
+			return false
+		case field.Operator != v1.NodeSelectorOpIn && field.Operator != v1.NodeSelectorOpNotIn:
+			return false
+		}
+	}
+
+	return true
+}
+
+func toleratesTaint(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func getEventTime(event *v1.Event) time.Time {
+	for _, timestamp := range []time.Time{event.LastTimestamp.Time, event.EventTime.Time, event.FirstTimestamp.Time} {
+		if !timestamp.IsZero() {
+			return timestamp
+		}
+	}
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,213 @@
+package diagnoser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseSchedulerMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     string
+		wantTotal   int
+		wantReasons []schedulingReason
+	}{
+		{
+			name:      "resources and taint containing a comma",
+			message:   "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had taint {node.kubernetes.io/unreachable: }, that the pod didn't tolerate.",
+			wantTotal: 3,
+			wantReasons: []schedulingReason{
+				{Category: "resources", Nodes: 1, Reason: "Insufficient cpu"},
+				{Category: "taints", Nodes: 2, Reason: "node(s) had taint {node.kubernetes.io/unreachable: }, that the pod didn't tolerate"},
+			},
+		},
+		{
+			name:      "preemption suffix",
+			message:   "0/5 nodes are available: 2 Insufficient memory, 3 node(s) didn't match Pod's node affinity/selector. preemption: 0/5 nodes are available: 2 No preemption victims found for incoming pod, 3 Preemption is not helpful for scheduling.",
+			wantTotal: 5,
+			wantReasons: []schedulingReason{
+				{Category: "resources", Nodes: 2, Reason: "Insufficient memory"},
+				{Category: "node-affinity", Nodes: 3, Reason: "node(s) didn't match Pod's node affinity/selector"},
+			},
+		},
+		{
+			name:      "volumes",
+			message:   "0/4 nodes are available: 1 node(s) were unschedulable, 3 node(s) had volume node affinity conflict.",
+			wantTotal: 4,
+			wantReasons: []schedulingReason{
+				{Category: "taints", Nodes: 1, Reason: "node(s) were unschedulable"},
+				{Category: "volumes", Nodes: 3, Reason: "node(s) had volume node affinity conflict"},
+			},
+		},
+		{
+			name:      "unbound claims and pod anti-affinity",
+			message:   "0/2 nodes are available: 1 node(s) didn't match pod anti-affinity rules, 1 pod has unbound immediate PersistentVolumeClaims.",
+			wantTotal: 2,
+			wantReasons: []schedulingReason{
+				{Category: "pod-affinity", Nodes: 1, Reason: "node(s) didn't match pod anti-affinity rules"},
+				{Category: "volumes", Nodes: 1, Reason: "pod has unbound immediate PersistentVolumeClaims"},
+			},
+		},
+		{
+			name:    "message which is not a node summary",
+			message: `running PreBind plugin "VolumeBinding": binding volumes: timed out waiting for the condition`,
+			wantReasons: []schedulingReason{
+				{Category: "other", Reason: `running PreBind plugin "VolumeBinding": binding volumes: timed out waiting for the condition`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, reasons := parseSchedulerMessage(tt.message)
+			if total != tt.wantTotal || !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("parseSchedulerMessage() = %d, %+v, want %d, %+v", total, reasons, tt.wantTotal, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestGetClosestNodes(t *testing.T) {
+	newNode := func(name string, cpu string, memory string, nodeLabels map[string]string) v1.Node {
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels},
+			Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+				v1.ResourcePods:   resource.MustParse("30"),
+			}},
+		}
+	}
+	requireZone := func(operator v1.NodeSelectorOperator, values ...string) *v1.Affinity {
+		return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: operator, Values: values}},
+			}},
+		}}}
+	}
+
+	tainted := newNode("gpu-0", "8", "32Gi", map[string]string{"agentpool": "gpu", "topology.kubernetes.io/zone": "westeurope-1"})
+	tainted.Spec.Taints = []v1.Taint{{Key: "sku", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	cordoned := newNode("nodepool1-2", "2", "8Gi", map[string]string{"agentpool": "nodepool1", "topology.kubernetes.io/zone": "westeurope-2"})
+	cordoned.Spec.Unschedulable = true
+
+	nodes := []v1.Node{
+		newNode("nodepool1-0", "2", "8Gi", map[string]string{"agentpool": "nodepool1", "topology.kubernetes.io/zone": "westeurope-1"}),
+		newNode("nodepool1-1", "2", "8Gi", map[string]string{"agentpool": "nodepool1", "topology.kubernetes.io/zone": "westeurope-2"}),
+		cordoned,
+		tainted,
+	}
+	nodeRequests := map[string][]collector.NodePodResources{
+		"nodepool1-0": {{CPURequests: 1800, MemoryRequests: 1024 * 1024 * 1024}},
+		"nodepool1-1": {{CPURequests: 500, MemoryRequests: 1024 * 1024 * 1024}},
+	}
+	requests := collector.NodePodResources{CPURequests: 1000, MemoryRequests: 512 * 1024 * 1024}
+
+	tests := []struct {
+		name string
+		pod  v1.Pod
+		want []schedulingNodeFit
+	}{
+		{
+			// Nodes blocked by as many reasons are sorted by the room they have left
+			name: "resources, cordon and taint",
+			pod:  v1.Pod{},
+			want: []schedulingNodeFit{
+				{Node: "nodepool1-1", Blocking: nil},
+				{Node: "gpu-0", Blocking: []string{"taint sku=gpu:NoSchedule not tolerated"}},
+				{Node: "nodepool1-2", Blocking: []string{"node is cordoned"}},
+			},
+		},
+		{
+			name: "required node affinity",
+			pod:  v1.Pod{Spec: v1.PodSpec{Affinity: requireZone(v1.NodeSelectorOpIn, "westeurope-1")}},
+			want: []schedulingNodeFit{
+				{Node: "gpu-0", Blocking: []string{"taint sku=gpu:NoSchedule not tolerated"}},
+				{Node: "nodepool1-1", Blocking: []string{"required node affinity not matched"}},
+				{Node: "nodepool1-0", Blocking: []string{"800m cpu missing"}},
+			},
+		},
+		{
+			name: "node selector and tolerated taint",
+			pod: v1.Pod{Spec: v1.PodSpec{
+				NodeSelector: map[string]string{"agentpool": "gpu"},
+				Tolerations:  []v1.Toleration{{Key: "sku", Operator: v1.TolerationOpEqual, Value: "gpu", Effect: v1.TaintEffectNoSchedule}},
+				Affinity:     requireZone(v1.NodeSelectorOpNotIn, "westeurope-2"),
+			}},
+			want: []schedulingNodeFit{
+				{Node: "gpu-0", Blocking: nil},
+				{Node: "nodepool1-1", Blocking: []string{"node selector not matched", "required node affinity not matched"}},
+				{Node: "nodepool1-0", Blocking: []string{"800m cpu missing", "node selector not matched"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getClosestNodes(&tt.pod, requests, nodes, nodeRequests)
+			if len(got) != len(tt.want) {
+				t.Fatalf("getClosestNodes() = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].Node != tt.want[i].Node || !reflect.DeepEqual(got[i].Blocking, tt.want[i].Blocking) {
+					t.Errorf("getClosestNodes()[%d] = %s %v, want %s %v", i, got[i].Node, got[i].Blocking, tt.want[i].Node, tt.want[i].Blocking)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchesNodeSelectorTerms(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "nodepool1-0", Labels: map[string]string{"agentpool": "nodepool1", "cores": "4"}}}
+
+	tests := []struct {
+		name  string
+		terms []v1.NodeSelectorTerm
+		want  bool
+	}{
+		{
+			name: "second term matching",
+			terms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "agentpool", Operator: v1.NodeSelectorOpIn, Values: []string{"gpu"}}}},
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "cores", Operator: v1.NodeSelectorOpGt, Values: []string{"2"}}}},
+			},
+			want: true,
+		},
+		{
+			name: "requirements of a term are ANDed",
+			terms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{
+				{Key: "agentpool", Operator: v1.NodeSelectorOpExists},
+				{Key: "cores", Operator: v1.NodeSelectorOpLt, Values: []string{"4"}},
+			}}},
+			want: false,
+		},
+		{
+			name:  "node name field",
+			terms: []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"nodepool1-0"}}}}},
+			want:  true,
+		},
+		{
+			name:  "excluded node name field",
+			terms: []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpNotIn, Values: []string{"nodepool1-0"}}}}},
+			want:  false,
+		},
+		{
+			name:  "empty term",
+			terms: []v1.NodeSelectorTerm{{}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesNodeSelectorTerms(node, tt.terms); got != tt.want {
+				t.Errorf("matchesNodeSelectorTerms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+	"github.com/Azure/aks-periscope/pkg/utils"
+)
+
+const (
+	// conntrackWarningRate defines the share of the conntrack table in use above which the node is reported
+	conntrackWarningRate = 0.9
+	// defaultSNATPortsPerNode defines the SNAT ports the load balancer allocates by default to each node of pools of
+	// up to 50 nodes, shared by all connections of the node to the same destination IP and port
+	defaultSNATPortsPerNode = 1024
+	// snatWarningRate defines the share of the SNAT ports in use for a destination above which it is reported
+	snatWarningRate = 0.8
+)
+
+type snatDiagnosticDatum struct {
+	HostName    string `json:"HostName"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination,omitempty"`
+	Start       string `json:"Start,omitempty"`
+	End         string `json:"End,omitempty"`
+	Level       string `json:"Level"`
+	Message     string `json:"Message"`
+}
+
+// SNATDiagnoser defines a SNAT Diagnoser struct
+type SNATDiagnoser struct {
+	conntrackCollector       *collector.ConntrackCollector
+	networkOutboundDiagnoser *NetworkOutboundDiagnoser
+	data                     map[string]string
+}
+
+// NewSNATDiagnoser is a constructor
+func NewSNATDiagnoser(conntrackCollector *collector.ConntrackCollector, networkOutboundDiagnoser *NetworkOutboundDiagnoser) *SNATDiagnoser {
+	return &SNATDiagnoser{
+		conntrackCollector:       conntrackCollector,
+		networkOutboundDiagnoser: networkOutboundDiagnoser,
+		data:                     make(map[string]string),
+	}
+}
+
+func (diagnoser *SNATDiagnoser) GetName() string {
+	return "snat"
+}
+
+// Diagnose implements the interface method
+func (diagnoser *SNATDiagnoser) Diagnose() error {
+	hostName, err := utils.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	conntrackData := diagnoser.conntrackCollector.GetData()
+
+	samples := []collector.ConntrackSample{}
+	err = unmarshalNDJSON(conntrackData["samples"], func(line []byte) error {
+		var sample collector.ConntrackSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			return err
+		}
+		samples = append(samples, sample)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unmarshal conntrack sample: %w", err)
+	}
+
+	destinations := []collector.ConntrackDestination{}
+	if data, ok := conntrackData["destinations"]; ok {
+		if err := json.Unmarshal([]byte(data), &destinations); err != nil {
+			return fmt.Errorf("unmarshal conntrack destinations: %w", err)
+		}
+	}
+
+	outages := []networkOutboundDiagnosticDatum{}
+	if data, ok := diagnoser.networkOutboundDiagnoser.GetData()["networkoutbound"]; ok {
+		periods := []networkOutboundDiagnosticDatum{}
+		if err := json.Unmarshal([]byte(data), &periods); err != nil {
+			return fmt.Errorf("unmarshal network outbound periods: %w", err)
+		}
+		outages = getNetworkOutboundOutages(periods)
+	}
+
+	snatDiagnosticData := []snatDiagnosticDatum{}
+	newDatum := func(source string, destination string, start time.Time, end time.Time, level string, message string) {
+		datum := snatDiagnosticDatum{
+			HostName:    hostName,
+			Source:      source,
+			Destination: destination,
+			Level:       level,
+			Message:     message,
+		}
+		if !start.IsZero() {
+			datum.Start = start.Format(time.RFC3339)
+			datum.End = end.Format(time.RFC3339)
+		}
+		snatDiagnosticData = append(snatDiagnosticData, datum)
+	}
+
+	diagnoseConntrackSamples(samples, outages, diagnoser.conntrackCollector.GetInterval(), newDatum)
+	diagnoseSNATDestinations(destinations, outages, newDatum)
+
+	dataBytes, err := json.Marshal(snatDiagnosticData)
+	if err != nil {
+		return fmt.Errorf("marshal data from SNAT Diagnoser: %w", err)
+	}
+
+	diagnoser.data["snat"] = string(dataBytes)
+
+	return nil
+}
+
+func (diagnoser *SNATDiagnoser) GetData() map[string]string {
+	return diagnoser.data
+}
+
+// diagnoseConntrackSamples reports a conntrack table near or at its maximum and the connections conntrack dropped or
+// failed to insert, along with the outbound outages they overlap
+func diagnoseConntrackSamples(samples []collector.ConntrackSample, outages []networkOutboundDiagnosticDatum, interval time.Duration, newDatum func(string, string, time.Time, time.Time, string, string)) {
+	if len(samples) == 0 {
+		return
+	}
+
+	peak := samples[0]
+	for _, sample := range samples[1:] {
+		if sample.Count > peak.Count {
+			peak = sample
+		}
+	}
+
+	if peak.Max > 0 {
+		rate := float64(peak.Count) / float64(peak.Max)
+		switch {
+		case rate >= 1:
+			newDatum("conntrack", "", peak.TimeStamp, peak.TimeStamp, "Error", fmt.Sprintf("Conntrack table is full (%d of %d entries), new connections of the node and its pods are dropped", peak.Count, peak.Max))
+		case rate >= conntrackWarningRate:
+			newDatum("conntrack", "", peak.TimeStamp, peak.TimeStamp, "Warning", fmt.Sprintf("Conntrack table is %.0f%% full (%d of %d entries)", rate*100, peak.Count, peak.Max))
+		}
+	}
+
+	for i := 1; i < len(samples); i++ {
+		drops := utils.GetCounterIncrease(samples[i-1].Drop, samples[i].Drop) + utils.GetCounterIncrease(samples[i-1].EarlyDrop, samples[i].EarlyDrop)
+		insertFailed := utils.GetCounterIncrease(samples[i-1].InsertFailed, samples[i].InsertFailed)
+		if drops == 0 && insertFailed == 0 {
+			continue
+		}
+
+		start, end := samples[i-1].TimeStamp, samples[i].TimeStamp
+		message := fmt.Sprintf("Conntrack dropped %d and failed to insert %d connections", drops, insertFailed)
+		if drops == 0 {
+			// Insert failures without drops are clashes of concurrent connections with the same tuple, typically
+			// parallel A and AAAA DNS queries over UDP being translated to the same source port
+			message += ", concurrent connections clash on the same SNAT tuple"
+		}
+
+		level := "Warning"
+		for _, outage := range getOverlappingOutages(outages, start, end, interval) {
+			level = "Error"
+			message += fmt.Sprintf("; %s was unreachable from %s to %s", outage.Type, outage.Start.Format(time.RFC3339), outage.End.Format(time.RFC3339))
+		}
+
+		newDatum("conntrack", "", start, end, level, message)
+	}
+}
+
+// diagnoseSNATDestinations reports public destinations whose connections use most of the SNAT ports the load balancer
+// allocates to a node by default, in particular when outbound probes failed to connect
+func diagnoseSNATDestinations(destinations []collector.ConntrackDestination, outages []networkOutboundDiagnosticDatum, newDatum func(string, string, time.Time, time.Time, string, string)) {
+	connectOutages := []string{}
+	for _, outage := range outages {
+		if outage.FailedStage == "tcp" || outage.FailedStage == "tls" || outage.FailedStage == "connect" {
+			connectOutages = append(connectOutages, outage.Type)
+		}
+	}
+
+	for _, destination := range destinations {
+		rate := float64(destination.Connections) / float64(defaultSNATPortsPerNode)
+		if rate < snatWarningRate {
+			continue
+		}
+
+		message := fmt.Sprintf("%d %s connections to %s use %.0f%% of the %d SNAT ports a node gets by default", destination.Connections, strings.ToUpper(destination.Protocol), destination.Destination, rate*100, defaultSNATPortsPerNode)
+		if destination.TimeWait > 0 {
+			message += fmt.Sprintf(", %d of them in TIME_WAIT, connections are not reused", destination.TimeWait)
+		}
+
+		level := "Warning"
+		if len(connectOutages) > 0 {
+			level = "Error"
+			message += fmt.Sprintf("; outbound connections to %s failed, which matches SNAT port exhaustion", strings.Join(connectOutages, ", "))
+		}
+
+		newDatum("snat", destination.Destination, time.Time{}, time.Time{}, level, message)
+	}
+}
+
+// getNetworkOutboundOutages returns the periods during which the probes of a target failed at one of their stages
+func getNetworkOutboundOutages(periods []networkOutboundDiagnosticDatum) []networkOutboundDiagnosticDatum {
+	outages := []networkOutboundDiagnosticDatum{}
+	for _, period := range periods {
+		if period.FailedStage != "" {
+			outages = append(outages, period)
+		}
+	}
+	return outages
+}
+
+// getOverlappingOutages returns the outages overlapping a window, extended by the interval between two probes
+func getOverlappingOutages(outages []networkOutboundDiagnosticDatum, start time.Time, end time.Time, interval time.Duration) []networkOutboundDiagnosticDatum {
+	overlapping := []networkOutboundDiagnosticDatum{}
+	for _, outage := range outages {
+		if !outage.Start.After(end.Add(interval)) && !outage.End.Before(start.Add(-interval)) {
+			overlapping = append(overlapping, outage)
+		}
+	}
+	return overlapping
+}
@@ -0,0 +1,164 @@
+package diagnoser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-periscope/pkg/collector"
+)
+
+// getTestOutages returns the outages found in the probes of a target, each probe given as the failed stage or "" when
+// it connected
+func getTestOutages(t *testing.T, outboundType string, start time.Time, failedStages ...string) []networkOutboundDiagnosticDatum {
+	t.Helper()
+
+	lines := []string{}
+	for i, failedStage := range failedStages {
+		datum := collector.NetworkOutboundDatum{
+			TimeStamp:   start.Add(time.Duration(i) * 5 * time.Second),
+			Status:      "Connected",
+			FailedStage: failedStage,
+		}
+		datum.Type = outboundType
+		if failedStage != "" {
+			datum.Status = "Error: " + failedStage + ": i/o timeout"
+		}
+
+		line, err := json.Marshal(datum)
+		if err != nil {
+			t.Fatalf("marshal probe: %v", err)
+		}
+		lines = append(lines, string(line))
+	}
+
+	periods := getNetworkOutboundPeriods("aks-nodepool1-0", map[string]string{outboundType: strings.Join(lines, "\n")}, 6*time.Second)
+	return getNetworkOutboundOutages(periods)
+}
+
+func TestDiagnoseConntrackSamples(t *testing.T) {
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	outages := getTestOutages(t, "AKS-API-Server", at(5), "", "tcp", "tcp", "")
+	if len(outages) != 1 || !outages[0].Start.Equal(at(10)) || !outages[0].End.Equal(at(15)) {
+		t.Fatalf("getNetworkOutboundOutages() = %+v, want a single outage from %s to %s", outages, at(10), at(15))
+	}
+
+	tests := []struct {
+		name    string
+		samples []collector.ConntrackSample
+		outages []networkOutboundDiagnosticDatum
+		want    []testFinding
+	}{
+		{
+			name: "healthy table",
+			samples: []collector.ConntrackSample{
+				{TimeStamp: at(0), Count: 1000, Max: 131072},
+				{TimeStamp: at(5), Count: 1200, Max: 131072},
+			},
+			want: []testFinding{},
+		},
+		{
+			name: "table near its maximum",
+			samples: []collector.ConntrackSample{
+				{TimeStamp: at(0), Count: 1000, Max: 131072},
+				{TimeStamp: at(5), Count: 120000, Max: 131072},
+			},
+			want: []testFinding{
+				{"conntrack", "Warning", "Conntrack table is 92% full"},
+			},
+		},
+		{
+			name: "full table dropping connections during an outage",
+			samples: []collector.ConntrackSample{
+				{TimeStamp: at(0), Count: 131072, Max: 131072, Drop: 10},
+				{TimeStamp: at(5), Count: 131072, Max: 131072, Drop: 10},
+				{TimeStamp: at(10), Count: 131072, Max: 131072, Drop: 25, EarlyDrop: 5},
+			},
+			outages: outages,
+			want: []testFinding{
+				{"conntrack", "Error", "Conntrack table is full"},
+				{"conntrack", "Error", "Conntrack dropped 20 and failed to insert 0 connections; AKS-API-Server was unreachable"},
+			},
+		},
+		{
+			name: "insert failures are tuple clashes",
+			samples: []collector.ConntrackSample{
+				{TimeStamp: at(30), Count: 1000, Max: 131072, InsertFailed: 3},
+				{TimeStamp: at(35), Count: 1000, Max: 131072, InsertFailed: 7},
+			},
+			outages: outages,
+			want: []testFinding{
+				{"conntrack", "Warning", "failed to insert 4 connections, concurrent connections clash on the same SNAT tuple"},
+			},
+		},
+		{
+			name: "counters restarting after a reboot",
+			samples: []collector.ConntrackSample{
+				{TimeStamp: at(0), Count: 1000, Max: 131072, Drop: 100, InsertFailed: 50},
+				{TimeStamp: at(5), Count: 1000, Max: 131072},
+			},
+			want: []testFinding{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseConntrackSamples(tt.samples, tt.outages, 5*time.Second, func(source string, destination string, start time.Time, end time.Time, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
+
+func TestDiagnoseSNATDestinations(t *testing.T) {
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	destinations := []collector.ConntrackDestination{
+		{Protocol: "tcp", Destination: "20.1.2.3:443", Connections: 900, TimeWait: 600},
+		{Protocol: "tcp", Destination: "20.1.2.4:443", Connections: 100},
+		{Protocol: "udp", Destination: "20.1.2.5:53", Connections: 1024},
+	}
+
+	tests := []struct {
+		name    string
+		outages []networkOutboundDiagnosticDatum
+		want    []testFinding
+	}{
+		{
+			name: "without outages",
+			want: []testFinding{
+				{"snat", "Warning", "900 TCP connections to 20.1.2.3:443 use 88% of the 1024 SNAT ports a node gets by default, 600 of them in TIME_WAIT"},
+				{"snat", "Warning", "1024 UDP connections to 20.1.2.5:53 use 100%"},
+			},
+		},
+		{
+			name:    "with DNS outages only",
+			outages: getTestOutages(t, "Microsoft-Container-Registry", start, "", "dns"),
+			want: []testFinding{
+				{"snat", "Warning", "20.1.2.3:443"},
+				{"snat", "Warning", "20.1.2.5:53"},
+			},
+		},
+		{
+			name:    "with connect outages",
+			outages: getTestOutages(t, "Microsoft-Container-Registry", start, "", "tcp"),
+			want: []testFinding{
+				{"snat", "Error", "outbound connections to Microsoft-Container-Registry failed"},
+				{"snat", "Error", "outbound connections to Microsoft-Container-Registry failed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []testFinding{}
+			diagnoseSNATDestinations(destinations, tt.outages, func(source string, destination string, start time.Time, end time.Time, level string, message string) {
+				got = append(got, testFinding{source, level, message})
+			})
+			checkFindings(t, got, tt.want)
+		})
+	}
+}
@@ -3,18 +3,29 @@ package exporter
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/aks-periscope/pkg/interfaces"
 	"github.com/Azure/aks-periscope/pkg/utils"
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 )
 
+var (
+	httpSender     pipeline.Factory
+	httpSenderOnce sync.Once
+)
+
 // AzureBlobExporter defines an Azure Blob Exporter
 type AzureBlobExporter struct {
 	hostname     string
@@ -40,7 +51,7 @@ func createContainerURL() (azblob.ContainerURL, error) {
 
 	ctx := context.Background()
 
-	pipeline := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
+	pipeline := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{HTTPSender: getHTTPSender()})
 
 	ses := utils.GetStorageEndpointSuffix()
 	url, err := url.Parse(fmt.Sprintf("https://%s.blob.%s/%s%s", accountName, ses, containerName, sasKey))
@@ -67,6 +78,47 @@ func createContainerURL() (azblob.ContainerURL, error) {
 	return containerURL, nil
 }
 
+// getHTTPSender returns a sender going through the node HTTP proxy and trusting its CA, or nil for the default sender
+func getHTTPSender() pipeline.Factory {
+	httpSenderOnce.Do(func() {
+		proxyConfig := utils.GetProxyConfig()
+		if !proxyConfig.Enabled() {
+			return
+		}
+
+		log.Printf("Export to Azure Storage Account through proxy configured in %s", proxyConfig.Source)
+		proxyFunc := proxyConfig.ProxyFunc()
+		client := &http.Client{
+			Transport: &http.Transport{
+				Proxy: func(request *http.Request) (*url.URL, error) {
+					return proxyFunc(request.URL)
+				},
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSClientConfig:       &tls.Config{RootCAs: proxyConfig.RootCAs()},
+				MaxIdleConnsPerHost:   100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+		}
+
+		httpSender = pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+				response, err := client.Do(request.WithContext(ctx))
+				if err != nil {
+					err = pipeline.NewError(err, "HTTP request failed")
+				}
+				return pipeline.NewHTTPResponse(response), err
+			}
+		})
+	})
+
+	return httpSender
+}
+
 // Export implements the interface method
 func (exporter *AzureBlobExporter) Export(producer interfaces.DataProducer) error {
 	containerURL, err := createContainerURL()
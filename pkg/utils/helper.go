@@ -32,7 +32,8 @@ var GetHostNameFunc = GetHostNameSingleton()
 
 // Azure defines Azure configuration
 type Azure struct {
-	Cloud string `json:"cloud"`
+	Cloud    string `json:"cloud"`
+	Location string `json:"location"`
 }
 
 // AzureStackCloud defines Azure Stack Cloud configuration
@@ -367,3 +368,43 @@ func GetPods(clientset *kubernetes.Clientset, namespace string) (*v1.PodList, er
 
 	return podList, nil
 }
+
+// GetCounterIncrease returns the increase of a cumulative counter, which restarts from zero when the node reboots or
+// its owner, such as a pod, is recreated
+func GetCounterIncrease(previous uint64, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// IsClusterScopeInstance tells whether this pod of the AKS Periscope DaemonSet collects the cluster-wide data, which
+// only the pod running on the first node in name order does, so that data is not exported once per node
+func IsClusterScopeInstance(clientset kubernetes.Interface) (bool, error) {
+	hostName, err := GetHostName()
+	if err != nil {
+		return false, err
+	}
+
+	pods, err := clientset.CoreV1().Pods("aks-periscope").List(context.TODO(), metav1.ListOptions{LabelSelector: "app=aks-periscope"})
+	if err != nil {
+		return false, fmt.Errorf("list AKS Periscope pods: %w", err)
+	}
+
+	return strings.EqualFold(getClusterScopeNodeName(pods.Items), hostName), nil
+}
+
+// getClusterScopeNodeName returns the first node in name order running a pod which is not being deleted
+func getClusterScopeNodeName(pods []v1.Pod) string {
+	nodeName := ""
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if nodeName == "" || pod.Spec.NodeName < nodeName {
+			nodeName = pod.Spec.NodeName
+		}
+	}
+
+	return nodeName
+}
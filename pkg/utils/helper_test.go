@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetClusterScopeNodeName(t *testing.T) {
+	deleted := metav1.Now()
+
+	tests := []struct {
+		name string
+		pods []v1.Pod
+		want string
+	}{
+		{
+			name: "first node in name order",
+			pods: []v1.Pod{
+				{Spec: v1.PodSpec{NodeName: "aks-nodepool1-12345678-vmss000001"}},
+				{Spec: v1.PodSpec{NodeName: "aks-nodepool1-12345678-vmss000000"}},
+				{Spec: v1.PodSpec{NodeName: "aks-userpool-12345678-vmss000000"}},
+			},
+			want: "aks-nodepool1-12345678-vmss000000",
+		},
+		{
+			name: "unscheduled and deleted pods are ignored",
+			pods: []v1.Pod{
+				{Spec: v1.PodSpec{}},
+				{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleted}, Spec: v1.PodSpec{NodeName: "aks-nodepool1-12345678-vmss000000"}},
+				{Spec: v1.PodSpec{NodeName: "aks-nodepool1-12345678-vmss000001"}},
+			},
+			want: "aks-nodepool1-12345678-vmss000001",
+		},
+		{
+			name: "no pods",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getClusterScopeNodeName(tt.pods); got != tt.want {
+				t.Errorf("getClusterScopeNodeName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
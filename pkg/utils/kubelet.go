@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// GetKubeletCommandLine returns the command line of the kubelet running on host
+func GetKubeletCommandLine() (string, error) {
+	return RunCommandOnHost("ps", "-o", "cmd=", "-C", "kubelet")
+}
+
+// ParseKubeletFlags returns the value of each --flag found in a kubelet command line; boolean flags map to "true"
+func ParseKubeletFlags(commandLine string) map[string]string {
+	flags := map[string]string{}
+	fields := strings.Fields(commandLine)
+
+	for i := 0; i < len(fields); i++ {
+		if !strings.HasPrefix(fields[i], "--") {
+			continue
+		}
+
+		flag := strings.TrimPrefix(fields[i], "--")
+		if parts := strings.SplitN(flag, "=", 2); len(parts) == 2 {
+			flags[parts[0]] = parts[1]
+			continue
+		}
+
+		if i+1 < len(fields) && !strings.HasPrefix(fields[i+1], "-") {
+			flags[flag] = fields[i+1]
+			i++
+			continue
+		}
+
+		flags[flag] = "true"
+	}
+
+	return flags
+}
+
+// ReadKubeletConfigFile reads a YAML or JSON kubelet configuration file from host
+func ReadKubeletConfigFile(path string) (map[string]interface{}, error) {
+	content, err := RunCommandOnHost("cat", path)
+	if err != nil {
+		return nil, fmt.Errorf("read kubelet config file %s: %w", path, err)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(content), 4096).Decode(&config); err != nil {
+		return nil, fmt.Errorf("decode kubelet config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// ParseEvictionThresholds parses a kubelet eviction flag such as "memory.available<100Mi,nodefs.available<10%"
+func ParseEvictionThresholds(value string) map[string]string {
+	thresholds := map[string]string{}
+	for _, threshold := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(threshold), "<", 2)
+		if len(parts) == 2 {
+			thresholds[parts[0]] = parts[1]
+		}
+	}
+
+	return thresholds
+}
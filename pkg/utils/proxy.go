@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"crypto/x509"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	// hostEnvironmentFile is where the node HTTP proxy configuration is written
+	hostEnvironmentFile = "/etc/environment"
+	// ProxyTrustedCAFile is where the trusted CA of the node HTTP proxy configuration is installed
+	ProxyTrustedCAFile = "/usr/local/share/ca-certificates/proxyCA.crt"
+)
+
+// ProxyConfig defines an HTTP proxy configuration
+type ProxyConfig struct {
+	HTTPProxy     string `json:"HTTPProxy,omitempty"`
+	HTTPSProxy    string `json:"HTTPSProxy,omitempty"`
+	NoProxy       string `json:"NoProxy,omitempty"`
+	Source        string `json:"Source,omitempty"`
+	TrustedCAFile string `json:"TrustedCAFile,omitempty"`
+	TrustedCA     []byte `json:"-"`
+}
+
+// GetProxyConfig returns the HTTP proxy configuration of the node, falling back to the one of the container
+func GetProxyConfig() *ProxyConfig {
+	config := &ProxyConfig{}
+
+	if content, err := RunCommandOnHost("cat", hostEnvironmentFile); err == nil {
+		env := ParseEnvironmentFile(content)
+		config = newProxyConfig(func(key string) string { return env[key] })
+		config.Source = hostEnvironmentFile
+	}
+
+	if !config.Enabled() {
+		config = newProxyConfig(os.Getenv)
+		config.Source = "container environment"
+	}
+
+	if !config.Enabled() {
+		return &ProxyConfig{}
+	}
+
+	if ca, err := RunCommandOnHost("cat", ProxyTrustedCAFile); err == nil && strings.TrimSpace(ca) != "" {
+		config.TrustedCAFile = ProxyTrustedCAFile
+		config.TrustedCA = []byte(ca)
+	}
+
+	return config
+}
+
+func newProxyConfig(getenv func(string) string) *ProxyConfig {
+	getenvAny := func(keys ...string) string {
+		for _, key := range keys {
+			if value := getenv(key); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	return &ProxyConfig{
+		HTTPProxy:  getenvAny("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: getenvAny("HTTPS_PROXY", "https_proxy"),
+		NoProxy:    getenvAny("NO_PROXY", "no_proxy"),
+	}
+}
+
+// ParseEnvironmentFile returns the variables of an environment file made of KEY=VALUE lines
+func ParseEnvironmentFile(content string) map[string]string {
+	env := map[string]string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		env[strings.TrimSpace(parts[0])] = value
+	}
+
+	return env
+}
+
+// Enabled returns true when an HTTP or HTTPS proxy is configured
+func (config *ProxyConfig) Enabled() bool {
+	return config.HTTPProxy != "" || config.HTTPSProxy != ""
+}
+
+// ProxyFunc returns the proxy to use for a given request URL, or nil when it should be sent directly
+func (config *ProxyConfig) ProxyFunc() func(*url.URL) (*url.URL, error) {
+	return (&httpproxy.Config{
+		HTTPProxy:  config.HTTPProxy,
+		HTTPSProxy: config.HTTPSProxy,
+		NoProxy:    config.NoProxy,
+	}).ProxyFunc()
+}
+
+// RootCAs returns the system roots along with the trusted CA of the proxy configuration
+func (config *ProxyConfig) RootCAs() *x509.CertPool {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	if len(config.TrustedCA) > 0 {
+		roots.AppendCertsFromPEM(config.TrustedCA)
+	}
+
+	return roots
+}
+
+// Redacted returns a copy of the proxy configuration with the proxy passwords removed
+func (config *ProxyConfig) Redacted() *ProxyConfig {
+	redact := func(proxy string) string {
+		u, err := url.Parse(proxy)
+		if err != nil || u.User == nil {
+			return proxy
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		return u.String()
+	}
+
+	redacted := *config
+	redacted.HTTPProxy = redact(config.HTTPProxy)
+	redacted.HTTPSProxy = redact(config.HTTPSProxy)
+
+	return &redacted
+}
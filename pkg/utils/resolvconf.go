@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HostResolvConfFile is the resolv.conf of the node, mounted from its /etc
+	HostResolvConfFile = "/etchostlogs/resolv.conf"
+	// SystemdResolvedResolvConfFile lists the upstream nameservers of the systemd-resolved stub of the node
+	SystemdResolvedResolvConfFile = "/run/systemd/resolve/resolv.conf"
+	// ContainerResolvConfFile is the resolv.conf of the container, pointing at the cluster DNS
+	ContainerResolvConfFile = "/etc/resolv.conf"
+
+	systemdResolvedStubAddress = "127.0.0.53"
+	// maxResolvConfNameservers is the number of nameservers the stub resolver uses, the others are ignored
+	maxResolvConfNameservers = 3
+	maxResolvConfNdots       = 15
+)
+
+// ResolvConf defines the resolver configuration of a resolv.conf file
+type ResolvConf struct {
+	Nameservers             []string    `json:"Nameservers"`
+	IgnoredNameservers      []string    `json:"IgnoredNameservers,omitempty"`
+	Search                  []string    `json:"Search,omitempty"`
+	Ndots                   int         `json:"Ndots"`
+	Options                 []string    `json:"Options,omitempty"`
+	SystemdResolvedUpstream *ResolvConf `json:"SystemdResolvedUpstream,omitempty"`
+}
+
+// ParseResolvConf parses the content of a resolv.conf file the way the stub resolver does
+func ParseResolvConf(content string) *ResolvConf {
+	resolvConf := &ResolvConf{
+		Nameservers: []string{},
+		Ndots:       1,
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if net.ParseIP(fields[1]) == nil {
+				continue
+			}
+			if len(resolvConf.Nameservers) < maxResolvConfNameservers {
+				resolvConf.Nameservers = append(resolvConf.Nameservers, fields[1])
+			} else {
+				resolvConf.IgnoredNameservers = append(resolvConf.IgnoredNameservers, fields[1])
+			}
+		case "domain":
+			// The last of the domain and search keywords wins
+			resolvConf.Search = fields[1:2]
+		case "search":
+			resolvConf.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				resolvConf.Options = append(resolvConf.Options, option)
+				if strings.HasPrefix(option, "ndots:") {
+					if ndots, err := strconv.Atoi(strings.TrimPrefix(option, "ndots:")); err == nil && ndots >= 0 {
+						if ndots > maxResolvConfNdots {
+							ndots = maxResolvConfNdots
+						}
+						resolvConf.Ndots = ndots
+					}
+				}
+			}
+		}
+	}
+
+	return resolvConf
+}
+
+// ReadResolvConf parses the resolv.conf file at path
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	content, err := ReadFileContent(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseResolvConf(content), nil
+}
+
+// ReadNodeResolvConf parses the node resolv.conf, along with the upstream nameservers of systemd-resolved when the node
+// resolves names through its local stub
+func ReadNodeResolvConf() (*ResolvConf, error) {
+	resolvConf, err := ReadResolvConf(HostResolvConfFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolvConf.UsesSystemdResolvedStub() {
+		if upstream, err := ReadResolvConf(SystemdResolvedResolvConfFile); err == nil {
+			resolvConf.SystemdResolvedUpstream = upstream
+		}
+	}
+
+	return resolvConf, nil
+}
+
+// UsesSystemdResolvedStub returns true when names are only resolved through the local systemd-resolved stub
+func (resolvConf *ResolvConf) UsesSystemdResolvedStub() bool {
+	for _, nameserver := range resolvConf.Nameservers {
+		if nameserver != systemdResolvedStubAddress {
+			return false
+		}
+	}
+	return len(resolvConf.Nameservers) > 0
+}
+
+// Effective returns the configuration names are resolved with, following the systemd-resolved stub to its upstream
+func (resolvConf *ResolvConf) Effective() *ResolvConf {
+	if resolvConf.SystemdResolvedUpstream != nil {
+		return resolvConf.SystemdResolvedUpstream
+	}
+	return resolvConf
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *ResolvConf
+	}{
+		{
+			name:    "tabs, repeated spaces and comments",
+			content: "# Generated by NetworkManager\nnameserver\t10.0.0.10\nsearch  default.svc.cluster.local svc.cluster.local  cluster.local\noptions ndots:5 timeout:2 ; comment\n",
+			want: &ResolvConf{
+				Nameservers: []string{"10.0.0.10"},
+				Search:      []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+				Ndots:       5,
+				Options:     []string{"ndots:5", "timeout:2"},
+			},
+		},
+		{
+			name:    "trailing nameserver keyword and invalid address",
+			content: "nameserver 168.63.129.16\nnameserver not-an-ip\nnameserver",
+			want: &ResolvConf{
+				Nameservers: []string{"168.63.129.16"},
+				Ndots:       1,
+			},
+		},
+		{
+			name:    "more nameservers than the resolver uses",
+			content: "nameserver 10.1.0.4\nnameserver 10.1.0.5\nnameserver 10.1.0.6\nnameserver 10.1.0.7\n",
+			want: &ResolvConf{
+				Nameservers:        []string{"10.1.0.4", "10.1.0.5", "10.1.0.6"},
+				IgnoredNameservers: []string{"10.1.0.7"},
+				Ndots:              1,
+			},
+		},
+		{
+			name:    "last of domain and search wins and ndots is capped",
+			content: "search a.example b.example\ndomain c.example\noptions ndots:20\n",
+			want: &ResolvConf{
+				Nameservers: []string{},
+				Search:      []string{"c.example"},
+				Ndots:       15,
+				Options:     []string{"ndots:20"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseResolvConf(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseResolvConf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvConfEffective(t *testing.T) {
+	stub := ParseResolvConf("nameserver 127.0.0.53\noptions edns0\nsearch reddog.microsoft.com\n")
+	if !stub.UsesSystemdResolvedStub() {
+		t.Fatalf("UsesSystemdResolvedStub() = false, want true")
+	}
+
+	if got := stub.Effective(); got != stub {
+		t.Errorf("Effective() without upstream = %+v, want the stub configuration", got)
+	}
+
+	stub.SystemdResolvedUpstream = ParseResolvConf("nameserver 168.63.129.16\nsearch reddog.microsoft.com\n")
+	if got := stub.Effective().Nameservers; !reflect.DeepEqual(got, []string{"168.63.129.16"}) {
+		t.Errorf("Effective().Nameservers = %v, want [168.63.129.16]", got)
+	}
+
+	if ParseResolvConf("nameserver 127.0.0.53\nnameserver 10.1.0.4\n").UsesSystemdResolvedStub() {
+		t.Errorf("UsesSystemdResolvedStub() = true with another nameserver, want false")
+	}
+}